@@ -0,0 +1,137 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+// A line-based control interface for scripts, set with -admin-port. Every command is answered with
+// zero or more lines followed by a line starting with "OK" or "ERR".
+type AdminServer struct {
+	forwardAddr string
+	startedAt   time.Time
+}
+
+const adminHelp = `help: this list
+status: uptime, connections, the forward address and the last player the server disconnected
+connections: name, address, connection time, experience level and client of every logged in player
+reload: reload the config file
+disconnect <player>: disconnect a logged in player
+quit: close this connection`
+
+func newAdminServer(forwardAddr string) *AdminServer {
+	return &AdminServer{forwardAddr: forwardAddr, startedAt: time.Now()}
+}
+
+func (a *AdminServer) serve(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Println("Admin listener failed:", err)
+			}
+			return
+		}
+		go a.handleConn(conn)
+	}
+}
+
+func (a *AdminServer) handleConn(conn net.Conn) {
+	defer conn.Close()
+	log.Printf("Admin connection from %s", conn.RemoteAddr())
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		command := strings.ToLower(fields[0])
+		if command == "quit" {
+			fmt.Fprintln(conn, "OK")
+			return
+		}
+
+		if err := a.runCommand(command, fields[1:], conn); err != nil {
+			_, err = fmt.Fprintln(conn, "ERR", err)
+			if err != nil {
+				return
+			}
+		} else if _, err := fmt.Fprintln(conn, "OK"); err != nil {
+			return
+		}
+	}
+}
+
+func (a *AdminServer) runCommand(command string, args []string, w io.Writer) error {
+	switch command {
+	case "help":
+		fmt.Fprintln(w, adminHelp)
+	case "status":
+		sessionsMutex.Lock()
+		connections := len(sessions)
+		sessionsMutex.Unlock()
+		fmt.Fprintf(w, "uptime %s\n", time.Since(a.startedAt).Truncate(time.Second))
+		fmt.Fprintf(w, "connections %d\n", connections)
+		fmt.Fprintf(w, "forwarding %s\n", a.forwardAddr)
+		lastDisconnectMutex.Lock()
+		if lastDisconnect != nil {
+			fmt.Fprintf(w, "last-disconnect %s %s %s\n", lastDisconnect.username, time.Since(lastDisconnect.at).Truncate(time.Second), lastDisconnect.reason)
+		}
+		lastDisconnectMutex.Unlock()
+	case "connections":
+		sessionsMutex.Lock()
+		lines := make([]string, 0, len(sessions))
+		for _, p := range sessions {
+			line := fmt.Sprintf("%s %s %s", p.username, p.clientConn.RemoteAddr(), time.Since(p.connectedAt).Truncate(time.Second))
+			p.inventoryMutex.RLock()
+			if p.experience.known {
+				line += fmt.Sprintf(" level %d (%.2f, %d total)", p.experience.level, p.experience.bar, p.experience.total)
+			}
+			p.inventoryMutex.RUnlock()
+			if client := p.describeClient(); client != "" {
+				line += " client " + client
+			}
+			lines = append(lines, line)
+		}
+		sessionsMutex.Unlock()
+		slices.Sort(lines)
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
+		}
+	case "reload":
+		if err := reloadConfig(); err != nil {
+			return err
+		}
+		log.Println("Reloaded the config file from the admin interface")
+	case "disconnect":
+		if len(args) != 1 {
+			return errors.New("Usage: disconnect <player>")
+		}
+		sessionsMutex.Lock()
+		p, ok := sessions[strings.ToLower(args[0])]
+		sessionsMutex.Unlock()
+		if !ok {
+			return fmt.Errorf("%s is not connected", args[0])
+		}
+		log.Printf("Disconnecting %s from the admin interface", p.username)
+		if err := p.disconnectClient(p.clientConn, "§cGoMCProxy: Disconnected by the proxy's administrator"); err != nil {
+			log.Println("Failed to send the disconnect reason to the client:", err)
+		}
+		p.close()
+	default:
+		return fmt.Errorf("Unknown command %q, see help", command)
+	}
+	return nil
+}
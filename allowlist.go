@@ -0,0 +1,91 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Packet IDs that are forwarded by state and direction, from "allowlist" in the config file, e.g.
+//
+//	"allowlist": {"play": {"serverbound": [0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25]}}
+//
+// Other packets in a state and direction that is in the allowlist are dropped before the rules and
+// the built-in handlers see them. A state and direction that isn't in it forwards every packet.
+type packetAllowlist map[allowlistKey]map[int]bool
+
+type allowlistKey struct {
+	state          State
+	clientToServer bool
+}
+
+var allowlist packetAllowlist
+var allowlistMutex sync.RWMutex
+
+// Parses the allowlist from the config file, keyed by state name and then direction
+func parseAllowlist(raw map[string]map[string][]int) (packetAllowlist, error) {
+	parsed := make(packetAllowlist)
+	for stateName, directions := range raw {
+		state, ok := ruleStates[strings.ToLower(stateName)]
+		if !ok {
+			return nil, fmt.Errorf("allowlist: invalid state %q", stateName)
+		}
+		for direction, packetIDs := range directions {
+			if direction != "serverbound" && direction != "clientbound" {
+				return nil, fmt.Errorf("allowlist: invalid direction %q", direction)
+			}
+			allowed := make(map[int]bool, len(packetIDs))
+			for _, packetID := range packetIDs {
+				if packetID < 0 {
+					return nil, fmt.Errorf("allowlist: invalid %s %s packet ID %d", stateName, direction, packetID)
+				}
+				allowed[packetID] = true
+			}
+			parsed[allowlistKey{state, direction == "serverbound"}] = allowed
+		}
+	}
+	// The proxy can't tell the client's version and the next state without it
+	if allowed, ok := parsed[allowlistKey{StateHandshaking, true}]; ok && !allowed[0x00] {
+		return nil, fmt.Errorf("allowlist: the handshaking serverbound packets must include the Handshake, 0")
+	}
+	return parsed, nil
+}
+
+// Returns whether the allowlist lets the packet through
+func packetAllowed(state State, clientToServer bool, packetID int) bool {
+	allowlistMutex.RLock()
+	defer allowlistMutex.RUnlock()
+
+	allowed, ok := allowlist[allowlistKey{state, clientToServer}]
+	return !ok || allowed[packetID]
+}
+
+// Logs a packet the allowlist dropped, only the first of every packet ID per connection so a
+// client sending many can't flood the log
+func (p *Proxy) logDisallowedPacket(state State, clientToServer bool, packetID int) {
+	key := allowlistKey{state, clientToServer}
+
+	p.droppedMutex.Lock()
+	if p.droppedPackets == nil {
+		p.droppedPackets = make(map[allowlistKey]map[int]bool)
+	}
+	if p.droppedPackets[key] == nil {
+		p.droppedPackets[key] = make(map[int]bool)
+	}
+	logged := p.droppedPackets[key][packetID]
+	p.droppedPackets[key][packetID] = true
+	p.droppedMutex.Unlock()
+
+	if logged {
+		return
+	}
+	direction := "clientbound"
+	if clientToServer {
+		direction = "serverbound"
+	}
+	p.logger.Printf("Dropped %s packet 0x%02X, it isn't on the allowlist. Further ones are dropped without logging", direction, packetID)
+}
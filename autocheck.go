@@ -0,0 +1,108 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Chat line Hypixel sends when a Bedwars game starts, the teams are final by then
+const gameStartMessage = "Protect your bed and destroy the enemy beds."
+
+var teamColorNames = map[byte]string{
+	'c': "Red",
+	'9': "Blue",
+	'a': "Green",
+	'e': "Yellow",
+	'b': "Aqua",
+	'f': "White",
+	'd': "Pink",
+	'8': "Gray",
+}
+
+// Starts checking the other teams with -auto-check, message is a clientbound chat message as text
+func (p *Proxy) startAutoCheck(message string, w io.Writer) {
+	if !getConfig().AutoCheck || p.services.hypixel == nil || message != gameStartMessage {
+		return
+	}
+	bedwarsType, ok := p.currentBedwarsType()
+	if !ok {
+		return
+	}
+	p.runAPICommand(func() { p.autoCheck(bedwarsType, w) }, w)
+}
+
+// Checks the players on every team but the player's own one after the other so it only takes up one
+// API worker, stopping when the lookups are rate limited
+func (p *Proxy) autoCheck(bedwarsType BedwarsType, w io.Writer) {
+	start := time.Now()
+	defer p.logIfSlow(start, "-auto-check")
+
+	ownColor, _ := p.teamColor(p.username)
+	teams := make(map[byte][]string)
+	for color, players := range p.playersByTeamColor() {
+		if color == ownColor {
+			continue
+		}
+		// Scoreboard lines are team entries as well
+		for _, player := range players {
+			if playerNameRegex.MatchString(player) {
+				teams[color] = append(teams[color], player)
+			}
+		}
+	}
+	if len(teams) == 0 {
+		if err := p.writeChatMessageToClient("§bGoMCProxy StatCheck: "+p.translate("autocheck.no_teams"), ChatTypeChat, w); err != nil {
+			p.errorChecker(err)
+		}
+		return
+	}
+
+	colors := make([]byte, 0, len(teams))
+	for color := range teams {
+		colors = append(colors, color)
+	}
+	slices.Sort(colors)
+
+	lines := []string{"§bGoMCProxy StatCheck: " + p.translate("autocheck.header", capitaliseFirst(string(bedwarsType)))}
+teams:
+	for _, color := range colors {
+		name, ok := teamColorNames[color]
+		if !ok {
+			name = "Team"
+		}
+		lines = append(lines, fmt.Sprintf("§%c§l%s", color, name))
+
+		players := teams[color]
+		slices.Sort(players)
+		for _, player := range players {
+			playerUuid, _, err := p.services.resolvePlayer(player)
+			if err != nil {
+				lines = append(lines, "§7"+player+": "+p.translate(playerProfileErrorKey(err)))
+				continue
+			}
+			stats, err := p.services.hypixel.getBedwarsStats(playerUuid, bedwarsType)
+			if err != nil {
+				lines = append(lines, "§7"+player+": "+p.translate(hypixelErrorKey(err)))
+				// The rest would be rate limited as well
+				if errors.Is(err, RateLimited) {
+					break teams
+				}
+				continue
+			}
+			lines = append(lines, p.translate("autocheck.stats",
+				stats.Rank, player, stats.Stars, stats.FinalKD, stats.WL, stats.Winstreak))
+		}
+	}
+
+	if err := p.writePagedMessage(strings.Join(lines, "\n"), w); err != nil {
+		p.errorChecker(err)
+	}
+}
@@ -0,0 +1,108 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type cacheEntry[V any] struct {
+	key      string
+	value    V
+	storedAt time.Time
+}
+
+// Map of API responses that counts its hits and misses. Entries older than the ttl passed to get
+// are stale, they are kept until replaced or evicted but never returned. The least recently used
+// entries are evicted first.
+type Cache[V any] struct {
+	entries map[string]*list.Element
+	order   *list.List // Of *cacheEntry[V], most recently used at the front
+	mutex   sync.Mutex
+	hits    atomic.Int64
+	misses  atomic.Int64
+}
+
+func newCache[V any]() *Cache[V] {
+	return &Cache[V]{entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// A ttl of 0 or less means entries never go stale
+func (c *Cache[V]) get(key string, ttl time.Duration) (V, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok || (ttl > 0 && time.Since(element.Value.(*cacheEntry[V]).storedAt) > ttl) {
+		c.misses.Add(1)
+		var zero V
+		return zero, false
+	}
+	c.hits.Add(1)
+	c.order.MoveToFront(element)
+	return element.Value.(*cacheEntry[V]).value, true
+}
+
+// Stores value under key, evicting the least recently used entries beyond maxEntries.
+// A maxEntries of 0 or less means there is no limit.
+func (c *Cache[V]) put(key string, value V, maxEntries int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = &cacheEntry[V]{key, value, time.Now()}
+		c.order.MoveToFront(element)
+	} else {
+		c.entries[key] = c.order.PushFront(&cacheEntry[V]{key, value, time.Now()})
+	}
+
+	for maxEntries > 0 && c.order.Len() > maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry[V]).key)
+	}
+}
+
+// Returns:
+// int: amount of entries
+// int: amount of entries older than ttl
+// int64: hits
+// int64: misses
+func (c *Cache[V]) stats(ttl time.Duration) (int, int, int64, int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stale := 0
+	if ttl > 0 {
+		for _, element := range c.entries {
+			if time.Since(element.Value.(*cacheEntry[V]).storedAt) > ttl {
+				stale++
+			}
+		}
+	}
+	return len(c.entries), stale, c.hits.Load(), c.misses.Load()
+}
+
+// Describes the profile and stats caches for /gmccache
+func (s *Services) cacheStatsMessage() string {
+	line := func(name string, size int, stale int, hits int64, misses int64) string {
+		return fmt.Sprintf("\n§7%s: §f%d §7entries (§f%d §7stale), §a%d §7hits, §c%d §7misses", name, size, stale, hits, misses)
+	}
+
+	message := "§bGoMCProxy Cache:"
+	size, stale, hits, misses := s.profiles.stats(0)
+	message += line("Profiles", size, stale, hits, misses)
+	if ttl := getConfig().StatsCacheTTL; s.hypixel != nil && ttl > 0 {
+		size, stale, hits, misses = s.hypixel.stats.stats(ttl)
+		message += line("Stats", size, stale, hits, misses)
+	} else {
+		message += "\n§7Stats: §fdisabled"
+	}
+	return message
+}
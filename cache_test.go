@@ -0,0 +1,125 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// Returns the keys from most to least recently used
+func (c *Cache[V]) keys() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var keys []string
+	for element := c.order.Front(); element != nil; element = element.Next() {
+		keys = append(keys, element.Value.(*cacheEntry[V]).key)
+	}
+	return keys
+}
+
+// Makes the entry under key look like it was stored age ago
+func (c *Cache[V]) age(key string, age time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries[key].Value.(*cacheEntry[V]).storedAt = time.Now().Add(-age)
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newCache[int]()
+	c.put("a", 1, 3)
+	c.put("b", 2, 3)
+	c.put("c", 3, 3)
+
+	// A hit makes a the most recently used, so b is evicted next
+	if v, ok := c.get("a", 0); !ok || v != 1 {
+		t.Fatalf("get(a) = %d, %v", v, ok)
+	}
+	c.put("d", 4, 3)
+	if want := []string{"d", "a", "c"}; !slices.Equal(c.keys(), want) {
+		t.Errorf("keys %q, want %q", c.keys(), want)
+	}
+	if _, ok := c.get("b", 0); ok {
+		t.Error("b wasn't evicted")
+	}
+
+	// Replacing a value doesn't grow the cache and makes it the most recently used
+	c.put("c", 30, 3)
+	if want := []string{"c", "d", "a"}; !slices.Equal(c.keys(), want) {
+		t.Errorf("keys %q, want %q", c.keys(), want)
+	}
+	if v, _ := c.get("c", 0); v != 30 {
+		t.Errorf("get(c) = %d, want the replaced value 30", v)
+	}
+
+	// A miss doesn't change the order
+	c.get("missing", 0)
+	c.put("e", 5, 3)
+	if want := []string{"e", "c", "d"}; !slices.Equal(c.keys(), want) {
+		t.Errorf("keys %q, want %q", c.keys(), want)
+	}
+
+	size, _, hits, misses := c.stats(0)
+	if size != 3 || hits != 2 || misses != 2 {
+		t.Errorf("stats = %d entries, %d hits, %d misses, want 3, 2, 2", size, hits, misses)
+	}
+}
+
+func TestCacheCapacityOne(t *testing.T) {
+	c := newCache[string]()
+	c.put("a", "1", 1)
+	c.put("b", "2", 1)
+	if _, ok := c.get("a", 0); ok {
+		t.Error("a wasn't evicted")
+	}
+	if v, ok := c.get("b", 0); !ok || v != "2" {
+		t.Errorf("get(b) = %q, %v", v, ok)
+	}
+	c.put("b", "3", 1)
+	if keys := c.keys(); !slices.Equal(keys, []string{"b"}) {
+		t.Errorf("keys %q, want only b", keys)
+	}
+}
+
+func TestCacheUnbounded(t *testing.T) {
+	c := newCache[int]()
+	for i := range 100 {
+		c.put(string(rune('a'+i)), i, 0)
+	}
+	if size, _, _, _ := c.stats(0); size != 100 {
+		t.Errorf("%d entries, want all 100 without a limit", size)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	c := newCache[int]()
+	c.put("fresh", 1, 0)
+	c.put("stale", 2, 0)
+	c.age("stale", 2*time.Minute)
+
+	if v, ok := c.get("fresh", time.Minute); !ok || v != 1 {
+		t.Errorf("get(fresh) = %d, %v", v, ok)
+	}
+	if _, ok := c.get("stale", time.Minute); ok {
+		t.Error("a stale entry was returned")
+	}
+	// A ttl of 0 never goes stale
+	if v, ok := c.get("stale", 0); !ok || v != 2 {
+		t.Errorf("get(stale) without a ttl = %d, %v", v, ok)
+	}
+
+	size, stale, _, _ := c.stats(time.Minute)
+	if size != 2 || stale != 1 {
+		t.Errorf("stats = %d entries, %d stale, want 2, 1", size, stale)
+	}
+
+	// Storing it again makes it fresh
+	c.put("stale", 3, 0)
+	if v, ok := c.get("stale", time.Minute); !ok || v != 3 {
+		t.Errorf("get(stale) after put = %d, %v", v, ok)
+	}
+}
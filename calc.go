@@ -0,0 +1,132 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Every prestige of 100 stars takes the same experience, the first 4 stars of one are cheaper
+var prestigeStarExperience = [...]int{500, 1000, 2000, 3500}
+
+const starExperience = 5000
+
+// Bounds of /calc, far beyond any player so the experience and games can't overflow
+const maxCalcStars = 10000
+const minExperiencePerGame = 1
+
+// The experience of a whole prestige, 487,000
+var prestigeExperience = func() int {
+	total := (100 - len(prestigeStarExperience)) * starExperience
+	for _, experience := range prestigeStarExperience {
+		total += experience
+	}
+	return total
+}()
+
+// Returns the Bedwars experience needed to go from 0 to stars stars
+func experienceForStars(stars int) int {
+	experience := stars / 100 * prestigeExperience
+	for star := range stars % 100 {
+		if star < len(prestigeStarExperience) {
+			experience += prestigeStarExperience[star]
+		} else {
+			experience += starExperience
+		}
+	}
+	return experience
+}
+
+// Handles /calc <stars> <target> [experience per game], without the experience per game the
+// player's own average is fetched
+func (p *Proxy) handleCalc(message string, w io.Writer) {
+	start := time.Now()
+	writeMessage := func(text string) {
+		if err := p.writeChatMessageToClient("§bGoMCProxy Calc: "+text, ChatTypeChat, w); err != nil {
+			p.errorChecker(err)
+		}
+	}
+
+	args := strings.Fields(message)[1:]
+	if len(args) != 2 && len(args) != 3 {
+		writeMessage(p.translate("calc.usage"))
+		logCommand(message, start, false)
+		return
+	}
+	stars, err := strconv.Atoi(args[0])
+	if err != nil || stars < 0 || stars >= maxCalcStars {
+		writeMessage(p.translate("calc.invalid_stars", args[0]))
+		logCommand(message, start, false)
+		return
+	}
+	target, err := strconv.Atoi(args[1])
+	if err != nil || target <= stars {
+		writeMessage(p.translate("calc.target_too_low", args[0]))
+		logCommand(message, start, false)
+		return
+	}
+	if target > maxCalcStars {
+		writeMessage(p.translate("calc.target_too_high", maxCalcStars))
+		logCommand(message, start, false)
+		return
+	}
+
+	if len(args) == 3 {
+		perGame, err := strconv.ParseFloat(args[2], 64)
+		// Written so NaN, which every comparison is false for, is rejected too
+		if err != nil || !(perGame >= minExperiencePerGame) || math.IsInf(perGame, 0) {
+			writeMessage(p.translate("calc.invalid_experience", args[2]))
+			logCommand(message, start, false)
+			return
+		}
+		writeMessage(p.formatCalc(stars, target, perGame, "calc.result"))
+		logCommand(message, start, true)
+		return
+	}
+
+	if p.services.hypixel == nil {
+		writeMessage(p.translate("error.api_disabled") + p.translate("calc.give_experience"))
+		logCommand(message, start, false)
+		return
+	}
+	if p.uuid == "" {
+		writeMessage(p.translate("calc.offline_mode"))
+		logCommand(message, start, false)
+		return
+	}
+	p.runAPICommand(func() {
+		succeeded := false
+		defer func() { logCommand(message, start, succeeded) }()
+
+		playerStats, err := p.services.hypixel.getPlayerStats(p.uuid)
+		if err != nil {
+			writeMessage(p.translate(hypixelErrorKey(err)))
+			return
+		}
+		bedwars := playerStats.Player.Stats.Bedwars
+		if bedwars.GamesPlayed == 0 || bedwars.Experience/float64(bedwars.GamesPlayed) < minExperiencePerGame {
+			writeMessage(p.translate("calc.no_games"))
+			return
+		}
+		succeeded = true
+		writeMessage(p.formatCalc(stars, target, bedwars.Experience/float64(bedwars.GamesPlayed), "calc.result_average"))
+	}, w)
+}
+
+// Formats the experience and games needed from stars to target with the message for key, which
+// describes where perGame came from. Callers keep target at most maxCalcStars and perGame at least
+// minExperiencePerGame.
+func (p *Proxy) formatCalc(stars int, target int, perGame float64, key string) string {
+	if !(perGame >= minExperiencePerGame) {
+		perGame = minExperiencePerGame
+	}
+	needed := experienceForStars(target) - experienceForStars(stars)
+	games := int(math.Ceil(float64(needed) / perGame))
+	return p.translate(key, stars, target, needed, games, perGame)
+}
@@ -0,0 +1,71 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestExperienceForStars(t *testing.T) {
+	tests := []struct {
+		stars int
+		want  int
+	}{
+		{0, 0},
+		{1, 500},
+		{4, 7000},
+		{5, 12000},
+		{100, 487000},
+		{104, 494000},
+		{maxCalcStars, maxCalcStars / 100 * 487000},
+	}
+	for _, tt := range tests {
+		if got := experienceForStars(tt.stars); got != tt.want {
+			t.Errorf("experienceForStars(%d) = %d, want %d", tt.stars, got, tt.want)
+		}
+	}
+}
+
+func TestFormatCalc(t *testing.T) {
+	p := &Proxy{}
+	got := p.formatCalc(100, 104, 700, "calc.result")
+	if !strings.Contains(got, "§b7000 experience") || !strings.Contains(got, "§a10 games") {
+		t.Errorf("formatCalc = %q", got)
+	}
+
+	// At the bounds the games stay a plain count, below the minimum the minimum is used
+	for _, perGame := range []float64{minExperiencePerGame, 1e-300, 0} {
+		got := p.formatCalc(0, maxCalcStars, perGame, "calc.result")
+		if !strings.Contains(got, "§a48700000 games") {
+			t.Errorf("formatCalc with %g per game = %q", perGame, got)
+		}
+	}
+}
+
+func TestHandleCalcInvalidExperience(t *testing.T) {
+	for _, perGame := range []string{"NaN", "nan", "Inf", "-Inf", "0.5", "-10", "abc"} {
+		p := &Proxy{logger: log.New(io.Discard, "", 0)}
+		p.setClientThreshold(-1)
+		p.setState(StatePlay)
+		w := &bytes.Buffer{}
+		p.handleCalc("/calc 0 100 "+perGame, w)
+
+		packets := readAllPackets(t, w.Bytes())
+		if len(packets) != 1 || !bytes.Contains(packets[0], []byte("Invalid experience per game: "+perGame)) {
+			t.Errorf("/calc 0 100 %s answered %q", perGame, packets)
+		}
+	}
+
+	// formatCalc doesn't divide by NaN either
+	p := &Proxy{}
+	if got := p.formatCalc(0, 100, math.NaN(), "calc.result"); strings.Contains(got, "NaN") {
+		t.Errorf("formatCalc with NaN per game = %q", got)
+	}
+}
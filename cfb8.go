@@ -8,6 +8,9 @@ import "crypto/cipher"
 
 // CFB stream with 8 bit segment size
 // See http://csrc.nist.gov/publications/nistpubs/800-38a/sp800-38a.pdf
+//
+// Every byte needs its own block encryption of the previous ciphertext, so this can't be batched.
+// Profiling shows the time is spent in AES itself, shifting the register is only a few percent.
 type cfb8 struct {
 	b         cipher.Block
 	blockSize int
@@ -0,0 +1,127 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+// CFB8 straight from SP 800-38A, one block encryption of the shift register per byte
+func referenceCFB8(block cipher.Block, iv []byte, src []byte, decrypt bool) []byte {
+	register := bytes.Clone(iv)
+	out := make([]byte, block.BlockSize())
+	dst := make([]byte, len(src))
+	for i, b := range src {
+		block.Encrypt(out, register)
+		dst[i] = b ^ out[0]
+		cipherByte := dst[i]
+		if decrypt {
+			cipherByte = b
+		}
+		register = append(register[1:], cipherByte)
+	}
+	return dst
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// Example vectors from SP 800-38A F.3.7 and F.3.8
+func TestCFB8Vectors(t *testing.T) {
+	key := mustHex(t, "2b7e151628aed2a6abf7158809cf4f3c")
+	iv := mustHex(t, "000102030405060708090a0b0c0d0e0f")
+	plaintext := mustHex(t, "6bc1bee22e409f96e93d7e117393172aae2d")
+	ciphertext := mustHex(t, "3b79424c9c0dd436bace9e0ed4586a4f32b9")
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := make([]byte, len(plaintext))
+	newCFB8Encrypter(block, iv).XORKeyStream(encrypted, plaintext)
+	if !bytes.Equal(encrypted, ciphertext) {
+		t.Errorf("encrypted %x, want %x", encrypted, ciphertext)
+	}
+	decrypted := make([]byte, len(ciphertext))
+	newCFB8Decrypter(block, iv).XORKeyStream(decrypted, ciphertext)
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("decrypted %x, want %x", decrypted, plaintext)
+	}
+}
+
+func TestCFB8MatchesReference(t *testing.T) {
+	// Like the login, the shared secret is both the key and the IV
+	secret := []byte("0123456789abcdef")
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, length := range []int{0, 1, 15, 16, 17, 31, 32, 33, 1000} {
+		plaintext := make([]byte, length)
+		for i := range plaintext {
+			plaintext[i] = byte(i*31 + 7)
+		}
+		want := referenceCFB8(block, secret, plaintext, false)
+
+		encrypted := make([]byte, length)
+		newCFB8Encrypter(block, secret).XORKeyStream(encrypted, plaintext)
+		if !bytes.Equal(encrypted, want) {
+			t.Errorf("%d bytes: encryption differs from the reference", length)
+		}
+		if !bytes.Equal(referenceCFB8(block, secret, want, true), plaintext) {
+			t.Fatalf("%d bytes: the reference doesn't round trip", length)
+		}
+
+		// Packets are decrypted as they arrive, in pieces that don't line up with the blocks, and in place
+		decrypter := newCFB8Decrypter(block, secret)
+		decrypted := bytes.Clone(encrypted)
+		for start := 0; start < length; {
+			end := min(start+start%7+1, length)
+			decrypter.XORKeyStream(decrypted[start:end], decrypted[start:end])
+			start = end
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("%d bytes: decrypting in pieces doesn't round trip", length)
+		}
+	}
+}
+
+func BenchmarkCFB8(b *testing.B) {
+	secret := []byte("0123456789abcdef")
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, size := range []int{64, 1024, 32 * 1024} {
+		buf := make([]byte, size)
+		b.Run(fmt.Sprintf("encrypt %d", size), func(b *testing.B) {
+			stream := newCFB8Encrypter(block, secret)
+			b.SetBytes(int64(size))
+			for range b.N {
+				stream.XORKeyStream(buf, buf)
+			}
+		})
+		b.Run(fmt.Sprintf("decrypt %d", size), func(b *testing.B) {
+			stream := newCFB8Decrypter(block, secret)
+			b.SetBytes(int64(size))
+			for range b.N {
+				stream.XORKeyStream(buf, buf)
+			}
+		})
+	}
+}
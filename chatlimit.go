@@ -0,0 +1,77 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Limits the chat messages the proxy writes to the player, set with -chat-rate-limit and -chat-rate-window.
+// Messages over the limit are dropped and counted in one message when the window ends. The action bar
+// isn't limited since it doesn't fill the chat box.
+type chatLimiter struct {
+	windowStart time.Time
+	sent        int
+	dropped     int
+	timer       *time.Timer // Writes the dropped count, set while messages are being dropped
+	mutex       sync.Mutex
+}
+
+// Returns false if a message to w has to be dropped
+func (p *Proxy) allowChatMessage(w io.Writer) bool {
+	cfg := getConfig()
+	if cfg.ChatRateLimit == 0 {
+		return true
+	}
+
+	l := &p.chatLimiter
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.windowStart) >= cfg.ChatRateWindow {
+		l.windowStart = now
+		l.sent = 0
+	}
+	if l.sent < cfg.ChatRateLimit {
+		l.sent++
+		return true
+	}
+
+	l.dropped++
+	if l.timer == nil {
+		l.timer = time.AfterFunc(time.Until(l.windowStart.Add(cfg.ChatRateWindow)), func() {
+			p.writeDroppedChatCount(w)
+		})
+	}
+	return false
+}
+
+// Tells the player how many messages were dropped in the window that ended
+func (p *Proxy) writeDroppedChatCount(w io.Writer) {
+	l := &p.chatLimiter
+	l.mutex.Lock()
+	dropped := l.dropped
+	l.dropped = 0
+	l.timer = nil
+	l.mutex.Unlock()
+
+	message := "§bGoMCProxy: " + p.translate("chatlimit.dropped", dropped)
+	if err := p.writeChatMessageToClient(message, ChatTypeChat, w); err != nil {
+		p.errorChecker(err)
+	}
+}
+
+func (p *Proxy) stopChatLimiter() {
+	l := &p.chatLimiter
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+}
@@ -0,0 +1,125 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// What is known about the client, for diagnostics and to gate workarounds for specific clients.
+// All of 1.8.x is protocol 47 and Client Settings didn't change within it, so the exact version is
+// only known when a Forge client lists MCP in its mod list.
+type clientInfo struct {
+	brand   string // From MC|Brand, e.g. "vanilla" or "lunarclient:v2.16.0-2426"
+	flavor  string // See clientFlavors, empty if the brand isn't known
+	version string // Minecraft version e.g. "1.8.9", empty if it isn't known
+}
+
+// Brands clients send by the client's name, matched case-insensitively on the start of the brand
+var clientFlavors = []struct {
+	prefix string
+	flavor string
+}{
+	{"vanilla", "Vanilla"},
+	{"fml,forge", "Forge"},
+	{"lunarclient", "Lunar Client"},
+	{"badlion", "Badlion Client"},
+	{"feather", "Feather Client"},
+	{"labymod", "LabyMod"},
+}
+
+// Minecraft versions by the MCP version Forge lists as the "mcp" mod
+var mcpVersions = map[string]string{
+	"9.10": "1.8",
+	"9.18": "1.8.8",
+	"9.19": "1.8.9",
+}
+
+// Returns the client's name from its brand, Forge clients that don't send one are known from the handshake
+func detectClientFlavor(brand string, isForge bool) string {
+	lowerBrand := strings.ToLower(brand)
+	for _, f := range clientFlavors {
+		if strings.HasPrefix(lowerBrand, f.prefix) {
+			return f.flavor
+		}
+	}
+	if isForge {
+		return "Forge"
+	}
+	return ""
+}
+
+// Records the brand the client sent on MC|Brand
+func (p *Proxy) setClientBrand(brand string) {
+	flavor := detectClientFlavor(brand, p.isForge)
+
+	p.clientInfoMutex.Lock()
+	p.clientInfo.brand = brand
+	p.clientInfo.flavor = flavor
+	p.clientInfoMutex.Unlock()
+
+	if flavor == "" {
+		flavor = "an unknown client"
+	}
+	p.logger.Printf("Client brand %q, detected %s", brand, flavor)
+}
+
+// Reads the Minecraft version from a Forge client's FML|HS ModList
+func (p *Proxy) detectForgeVersion(payload []byte) error {
+	// ModList
+	if len(payload) == 0 || payload[0] != 0x02 {
+		return nil
+	}
+	r := bytes.NewReader(payload[1:])
+	mods, _, err := readVarInt(r)
+	if err != nil {
+		return err
+	}
+	for range mods {
+		modID, err := readPrefixedBytes(r)
+		if err != nil {
+			return err
+		}
+		modVersion, err := readPrefixedBytes(r)
+		if err != nil {
+			return err
+		}
+		if string(modID) != "mcp" {
+			continue
+		}
+
+		version, ok := mcpVersions[string(modVersion)]
+		if !ok {
+			p.logger.Printf("Forge mod list has the unknown MCP version %q", modVersion)
+			return nil
+		}
+		p.clientInfoMutex.Lock()
+		p.clientInfo.version = version
+		if p.clientInfo.flavor == "" {
+			p.clientInfo.flavor = "Forge"
+		}
+		p.clientInfoMutex.Unlock()
+		p.logger.Printf("Forge mod list reports Minecraft %s", version)
+		return nil
+	}
+	return nil
+}
+
+// Describes the client like "Forge 1.8.9" or "Vanilla", empty if nothing is known
+func (p *Proxy) describeClient() string {
+	p.clientInfoMutex.Lock()
+	defer p.clientInfoMutex.Unlock()
+
+	description := p.clientInfo.flavor
+	if description == "" && p.clientInfo.brand != "" {
+		description = fmt.Sprintf("%q", p.clientInfo.brand)
+	}
+	if p.clientInfo.version != "" {
+		description = strings.TrimSpace(description + " " + p.clientInfo.version)
+	}
+	return description
+}
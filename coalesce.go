@@ -0,0 +1,96 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bufio"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const coalesceBufferSize = 16 * 1024
+
+// Buffers the writes to a connection and flushes them after a delay, so packets written shortly
+// after each other go out together. Set with -write-coalesce.
+type coalescingConn struct {
+	net.Conn
+	delay  time.Duration
+	writer *bufio.Writer
+	timer  *time.Timer // Pending flush, nil if nothing is buffered
+	err    error       // From a flush on the timer, returned by the next Write
+	mutex  sync.Mutex
+}
+
+func newCoalescingConn(conn net.Conn, delay time.Duration) *coalescingConn {
+	return &coalescingConn{Conn: conn, delay: delay, writer: bufio.NewWriterSize(conn, coalesceBufferSize)}
+}
+
+func (c *coalescingConn) Write(b []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	// A full buffer is written right away
+	n, err := c.writer.Write(b)
+	if err != nil {
+		c.err = err
+		return n, err
+	}
+	if c.writer.Buffered() > 0 && c.timer == nil {
+		c.timer = time.AfterFunc(c.delay, c.flushOnTimer)
+	}
+	return n, nil
+}
+
+func (c *coalescingConn) flushOnTimer() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.timer = nil
+	if c.err == nil {
+		c.err = c.writer.Flush()
+	}
+}
+
+// Flushes what is buffered, like a disconnect reason, and closes the connection
+func (c *coalescingConn) Close() error {
+	// A Write can be stuck on a peer that stopped reading, closing the connection is what unblocks it
+	if c.mutex.TryLock() {
+		if c.timer != nil {
+			c.timer.Stop()
+			c.timer = nil
+		}
+		if c.err == nil && c.writer.Buffered() > 0 {
+			c.Conn.SetWriteDeadline(time.Now().Add(time.Second))
+			c.writer.Flush()
+		}
+		c.err = net.ErrClosed
+		c.mutex.Unlock()
+	}
+	return c.Conn.Close()
+}
+
+// Applies -nodelay, -bandwidth-limit, -latency and -write-coalesce to a new client or backend connection
+func tuneConn(conn net.Conn, cfg Config) net.Conn {
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		if err := tcpConn.SetNoDelay(cfg.NoDelay); err != nil {
+			log.Println("Failed to set TCP_NODELAY:", err)
+		}
+	}
+	// Coalesced writes are delayed and paced as well
+	if cfg.BandwidthLimit > 0 {
+		conn = newThrottledConn(conn, cfg.BandwidthLimit)
+	}
+	if cfg.Latency > 0 || cfg.LatencyJitter > 0 {
+		conn = newDelayedConn(conn, time.Duration(cfg.Latency)*time.Millisecond, time.Duration(cfg.LatencyJitter)*time.Millisecond)
+	}
+	if cfg.WriteCoalesce > 0 {
+		return newCoalescingConn(conn, cfg.WriteCoalesce)
+	}
+	return conn
+}
@@ -0,0 +1,97 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"encoding/csv"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Records which proxy commands get used, set with -command-log. Only the command, the amount of
+// arguments, whether it succeeded and how long it took are recorded, never the arguments or who ran it.
+type CommandLog struct {
+	file   *os.File
+	writer *csv.Writer // nil writes to the standard log instead
+	mutex  sync.Mutex
+}
+
+// Nil unless -command-log is set
+var commandLog *CommandLog
+
+var commandLogHeader = []string{"time", "command", "arguments", "success", "latency_ms"}
+
+// Appends to the CSV file at path, writing the header if the file is new. A path of "-" logs
+// every command with the standard log instead.
+func openCommandLog(path string) (*CommandLog, error) {
+	if path == "-" {
+		return &CommandLog{}, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	cl := &CommandLog{file: file, writer: csv.NewWriter(file)}
+	if info.Size() == 0 {
+		cl.writer.Write(commandLogHeader)
+		cl.writer.Flush()
+		if err := cl.writer.Error(); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return cl, nil
+}
+
+func (cl *CommandLog) close() error {
+	if cl.file == nil {
+		return nil
+	}
+	return cl.file.Close()
+}
+
+func (cl *CommandLog) record(command string, arguments int, success bool, latency time.Duration) {
+	if cl.writer == nil {
+		log.Printf("Command %s (%d arguments) success: %t, took %s", command, arguments, success, latency)
+		return
+	}
+
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+	cl.writer.Write([]string{
+		time.Now().UTC().Format(time.RFC3339),
+		command,
+		strconv.Itoa(arguments),
+		strconv.FormatBool(success),
+		strconv.FormatInt(latency.Milliseconds(), 10),
+	})
+	cl.writer.Flush()
+	if err := cl.writer.Error(); err != nil {
+		log.Println("Failed to write to the command log:", err)
+	}
+}
+
+// Records the proxy command in message that started at start, if -command-log is set
+func logCommand(message string, start time.Time, success bool) {
+	if commandLog == nil {
+		return
+	}
+	fields := strings.Fields(message)
+	if len(fields) == 0 {
+		return
+	}
+	commandLog.record(strings.ToLower(fields[0]), len(fields)-1, success, time.Since(start))
+}
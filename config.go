@@ -0,0 +1,330 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Settings shared by every connection, filled in from the flags and config file in main.
+// Reloading the config file (SIGHUP or /gmcreload) updates everything except APIWorkers and
+// ClientCompressionThreshold. Of what it updates, MaxLookups, NoDelay, WriteCoalesce, BandwidthLimit,
+// Latency and LatencyJitter only apply to new connections.
+type Config struct {
+	CommandQueueSize     int
+	CommandQueueMaxAge   time.Duration
+	InjectDelay          time.Duration
+	InjectJitter         time.Duration
+	DuplicateSessions    string
+	SlowHandlerThreshold time.Duration
+	APIWorkers           int
+	MaxLookups           int
+	BedAlerts            bool
+	AutoRequeueDelay     time.Duration
+	MaxRequeues          int
+	StatsCacheTTL        time.Duration
+	CacheSize            int
+	StatusCacheTTL       time.Duration
+	CompressionLevel     int
+	NoDelay              bool
+	WriteCoalesce        time.Duration
+	BandwidthLimit       int // Bytes per second written to the client and to the backend, 0 is unlimited
+	Latency              int // Milliseconds every write to the client and to the backend is delayed by
+	LatencyJitter        int // Milliseconds of random delay added to Latency
+	DebugEncryption      bool
+	DebugForge           bool
+	OverlayAutoHide      bool
+	ClientBrand          string // Sent to the server instead of the client's MC|Brand, empty forwards it
+	AutoCheck            bool
+	AutoPartyAccept      bool
+	GameRecap            bool
+	PartyAcceptFrom      string // Comma-separated players whose party invites are accepted, empty accepts everyone's
+	NoAutoLocraw         bool
+	LogPlayerText        bool
+	ChatRateLimit        int // Chat messages the proxy writes to the player per ChatRateWindow, 0 is unlimited
+	ChatRateWindow       time.Duration
+	// Shown to clients that aren't on 1.8, as the disconnect reason or in the server list
+	UnsupportedVersionMessage string
+	// Disconnect reason for players the server dropped without kicking them, empty just closes the connection
+	BackendLostMessage string
+	// Threshold used towards the client instead of the server's, nil follows the server
+	ClientCompressionThreshold *int
+}
+
+var config = Config{
+	CommandQueueSize:   16,
+	CommandQueueMaxAge: 30 * time.Second,
+	DuplicateSessions:  "replace",
+	APIWorkers:         4,
+	MaxLookups:         1,
+	MaxRequeues:        10,
+	StatsCacheTTL:      time.Minute,
+	CacheSize:          1000,
+	CompressionLevel:   zlib.DefaultCompression,
+	NoDelay:            true,
+	ChatRateWindow:     5 * time.Second,
+
+	UnsupportedVersionMessage: "§cThis proxy requires Minecraft 1.8.9.",
+	BackendLostMessage:        "§cGoMCProxy: The server closed the connection",
+}
+var configMutex sync.RWMutex
+
+// Path of the -config file, empty if there is none
+var configFilePath string
+
+// Flags given on the command line, these take precedence over the config file
+var commandLineFlags = make(map[string]bool)
+
+// Returns a copy of the current settings
+func getConfig() Config {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return config
+}
+
+func (c *Config) registerFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&c.OverlayAutoHide, "overlay-auto-hide", c.OverlayAutoHide, "Only show \"Waiting for a game\" in the overlay outside of Bedwars games")
+
+	fs.BoolVar(&c.NoAutoLocraw, "no-auto-locraw", c.NoAutoLocraw, "Don't send /locraw when the player changes worlds on Hypixel. The Bedwars mode then isn't detected on its own anymore, use /scupdate or /scmode after joining a game")
+	fs.BoolVar(&c.BedAlerts, "bed-alerts", c.BedAlerts, "Announce beds being destroyed, detected from block changes")
+
+	fs.DurationVar(&c.AutoRequeueDelay, "auto-requeue", c.AutoRequeueDelay, "Requeue into the same Bedwars mode this long after a game ends, 0 disables")
+	fs.IntVar(&c.MaxRequeues, "max-requeues", c.MaxRequeues, "Maximum amount of automatic requeues per connection")
+
+	fs.IntVar(&c.CommandQueueSize, "command-queue-size", c.CommandQueueSize, "Maximum amount of injected commands waiting for the Play state")
+	fs.DurationVar(&c.CommandQueueMaxAge, "command-queue-max-age", c.CommandQueueMaxAge, "Injected commands that couldn't be sent for this long after they were due are dropped instead of sent")
+	fs.DurationVar(&c.InjectDelay, "inject-delay", c.InjectDelay, "Wait this long before sending a command the proxy injects, like /locraw or an -auto-requeue")
+	fs.DurationVar(&c.InjectJitter, "inject-jitter", c.InjectJitter, "Wait up to this much longer on top of -inject-delay, picked at random for every injected command")
+
+	fs.IntVar(&c.ChatRateLimit, "chat-rate-limit", c.ChatRateLimit, "Maximum amount of chat messages the proxy writes to the player per -chat-rate-window, the rest are dropped and counted in one message when the window ends. 0 disables")
+	fs.DurationVar(&c.ChatRateWindow, "chat-rate-window", c.ChatRateWindow, "Window of -chat-rate-limit")
+
+	fs.IntVar(&c.APIWorkers, "api-workers", c.APIWorkers, "Maximum amount of commands calling the Hypixel or Mojang API at the same time")
+
+	fs.IntVar(&c.MaxLookups, "max-lookups", c.MaxLookups, "Maximum amount of in-flight API commands per connection")
+
+	fs.DurationVar(&c.StatsCacheTTL, "stats-cache-ttl", c.StatsCacheTTL, "How long Hypixel stats are reused for repeated lookups of the same player, 0 disables the cache")
+
+	fs.IntVar(&c.CacheSize, "cache-size", c.CacheSize, "Maximum amount of entries in the profile and stats caches each, the least recently used are evicted first")
+
+	fs.DurationVar(&c.StatusCacheTTL, "status-cache-ttl", c.StatusCacheTTL, "Answer server list pings with the backend's status for this long before fetching it again, 0 forwards every ping")
+
+	fs.IntVar(&c.CompressionLevel, "compression-level", c.CompressionLevel, "zlib level (0-9) of the packets the proxy compresses, higher levels use more CPU for less bandwidth. -1 is zlib's default, level 6")
+
+	fs.BoolVar(&c.NoDelay, "nodelay", c.NoDelay, "Set TCP_NODELAY on the client and backend connections so packets are sent right away, -nodelay=false lets Nagle's algorithm combine small packets")
+	fs.IntVar(&c.BandwidthLimit, "bandwidth-limit", c.BandwidthLimit, "Pace the writes to the client and to the backend to this many bytes per second each, to simulate a slow link. 0 disables")
+	fs.IntVar(&c.Latency, "latency", c.Latency, "Testing tool: delay the packets written to the client and to the backend by this many milliseconds each way, to simulate lag. 0 disables")
+	fs.IntVar(&c.LatencyJitter, "latency-jitter", c.LatencyJitter, "Add up to this many milliseconds of random delay on top of -latency, packets stay in order")
+	fs.DurationVar(&c.WriteCoalesce, "write-coalesce", c.WriteCoalesce, "Buffer the packets written to the client and backend for this long (e.g. 2ms) and send them together, trading latency for fewer TCP segments. 0 disables")
+
+	fs.BoolVar(&c.DebugEncryption, "debug-encryption", c.DebugEncryption, "Log the encryption negotiation with the server: server ID, public key fingerprint and the Mojang join result. The shared secret is never logged")
+
+	fs.BoolVar(&c.DebugForge, "debug-forge", c.DebugForge, "Log the Forge plugin messages (FML|HS, FML, FML|MP and FORGE) going through the proxy")
+
+	fs.DurationVar(&c.SlowHandlerThreshold, "slow-handler-threshold", c.SlowHandlerThreshold, "Log packet and command handlers that take at least this long, 0 disables")
+
+	fs.BoolVar(&c.LogPlayerText, "log-player-text", c.LogPlayerText, "Log the lines of the signs and the pages of the books the player writes, the packets are forwarded untouched")
+
+	fs.BoolVar(&c.AutoCheck, "auto-check", c.AutoCheck, "Check the stats of the players on the other teams when a Bedwars game starts, one after the other until the Hypixel API rate limits them")
+
+	fs.BoolVar(&c.GameRecap, "game-recap", c.GameRecap, "Show a recap of Hypixel's end of game summary in chat: the result, the winners and the top killers")
+
+	fs.BoolVar(&c.AutoPartyAccept, "auto-party-accept", c.AutoPartyAccept, "Accept Hypixel party invites by sending /party accept")
+	fs.StringVar(&c.PartyAcceptFrom, "party-accept-from", c.PartyAcceptFrom, "Comma-separated players whose party invites -auto-party-accept accepts, empty accepts everyone's")
+
+	fs.StringVar(&c.ClientBrand, "client-brand", c.ClientBrand, "Report this brand (e.g. \"vanilla\") to the server instead of the client's own, empty forwards the client's brand")
+
+	fs.StringVar(&c.UnsupportedVersionMessage, "unsupported-version-message", c.UnsupportedVersionMessage, "Disconnect reason and server list description for clients that aren't on 1.8")
+	fs.StringVar(&c.BackendLostMessage, "backend-lost-message", c.BackendLostMessage, "Disconnect reason shown when the server drops the connection during the login or in game without kicking the player, empty closes the connection without one")
+
+	fs.StringVar(&c.DuplicateSessions, "duplicate-sessions", c.DuplicateSessions, "What to do when an account that is already connected connects again: \"replace\" the old session or \"reject\" the new one")
+}
+
+func (c *Config) validate() error {
+	if c.DuplicateSessions != "replace" && c.DuplicateSessions != "reject" {
+		return errors.New("Invalid -duplicate-sessions value, must be \"replace\" or \"reject\"")
+	}
+	if c.MaxRequeues < 1 {
+		return errors.New("The maximum amount of requeues must be at least 1")
+	}
+	if c.APIWorkers < 1 {
+		return errors.New("The amount of API workers must be at least 1")
+	}
+	if c.MaxLookups < 1 {
+		return errors.New("The maximum amount of lookups per connection must be at least 1")
+	}
+	if c.CacheSize < 1 {
+		return errors.New("The cache size must be at least 1")
+	}
+	if c.CompressionLevel < zlib.DefaultCompression || c.CompressionLevel > zlib.BestCompression {
+		return errors.New("The compression level must be between 0 and 9, or -1 for the default")
+	}
+	if c.WriteCoalesce < 0 {
+		return errors.New("The write coalescing delay can't be negative")
+	}
+	if c.Latency < 0 || c.LatencyJitter < 0 {
+		return errors.New("The latency and its jitter can't be negative")
+	}
+	if c.BandwidthLimit < 0 {
+		return errors.New("The bandwidth limit can't be negative")
+	}
+	if _, err := parsePartyAcceptFrom(c.PartyAcceptFrom); err != nil {
+		return err
+	}
+	if c.ChatRateLimit < 0 {
+		return errors.New("The chat rate limit can't be negative")
+	}
+	if c.ChatRateWindow <= 0 {
+		return errors.New("The chat rate window must be positive")
+	}
+	if c.CommandQueueSize < 1 {
+		return errors.New("The command queue size must be at least 1")
+	}
+	if c.InjectDelay < 0 || c.InjectJitter < 0 {
+		return errors.New("The injected command delay and jitter can't be negative")
+	}
+	return nil
+}
+
+// Parts of the config file that aren't flags
+type configFileData struct {
+	rules       []Rule
+	messages    map[string]map[string]string // By lowercase locale and message key
+	statLayouts map[BedwarsType][]string
+	allowlist   packetAllowlist
+}
+
+// Swaps in the rules, allowlist, messages and stat layouts
+func (d *configFileData) apply() {
+	rulesMutex.Lock()
+	rules = d.rules
+	rulesMutex.Unlock()
+
+	allowlistMutex.Lock()
+	allowlist = d.allowlist
+	allowlistMutex.Unlock()
+
+	statLayoutsMutex.Lock()
+	statLayouts = d.statLayouts
+	statLayoutsMutex.Unlock()
+
+	catalog.setOverrides(d.messages)
+}
+
+// Reads the JSON config file at path into the flags of fs. Keys are flag names without the dash,
+// plus "rules" for the packet rules, "allowlist" for the forwarded packet IDs, "messages" for
+// translations by locale and "layouts" for the stat lines of /sc by mode. Flags given on the
+// command line and flags fs doesn't have are skipped.
+func loadConfigFile(path string, fs *flag.FlagSet) (*configFileData, error) {
+	var file map[string]json.RawMessage
+	if err := readJSONFile(path, &file); err != nil {
+		return nil, err
+	}
+
+	fileData := &configFileData{messages: make(map[string]map[string]string)}
+	for name, raw := range file {
+		switch name {
+		case "rules":
+			if err := json.Unmarshal(raw, &fileData.rules); err != nil {
+				return nil, fmt.Errorf("rules: %w", err)
+			}
+			if err := validateRules(fileData.rules); err != nil {
+				return nil, err
+			}
+			continue
+		case "allowlist":
+			var rawAllowlist map[string]map[string][]int
+			if err := json.Unmarshal(raw, &rawAllowlist); err != nil {
+				return nil, fmt.Errorf("allowlist: %w", err)
+			}
+			allowlist, err := parseAllowlist(rawAllowlist)
+			if err != nil {
+				return nil, err
+			}
+			fileData.allowlist = allowlist
+			continue
+		case "layouts":
+			var rawLayouts map[string][]string
+			if err := json.Unmarshal(raw, &rawLayouts); err != nil {
+				return nil, fmt.Errorf("layouts: %w", err)
+			}
+			layouts, err := parseStatLayouts(rawLayouts)
+			if err != nil {
+				return nil, err
+			}
+			fileData.statLayouts = layouts
+			continue
+		case "messages":
+			var localeMessages map[string]map[string]string
+			if err := json.Unmarshal(raw, &localeMessages); err != nil {
+				return nil, fmt.Errorf("messages: %w", err)
+			}
+			for locale, localeMessages := range localeMessages {
+				fileData.messages[strings.ToLower(locale)] = localeMessages
+			}
+			continue
+		}
+
+		if name == "config" || flag.Lookup(name) == nil {
+			return nil, fmt.Errorf("Unknown setting %q", name)
+		}
+		if commandLineFlags[name] || fs.Lookup(name) == nil {
+			continue
+		}
+
+		// Going through the flag keeps the parsing the same, e.g. "5s" for durations
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		var value any
+		if err := decoder.Decode(&value); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if err := fs.Set(name, fmt.Sprint(value)); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return fileData, nil
+}
+
+// Re-reads the config file and swaps in its settings, rules, allowlist, messages and stat layouts, nothing changes if it is invalid.
+// Settings that are no longer in the file keep their current value.
+func reloadConfig() error {
+	if configFilePath == "" {
+		return errors.New("No config file has been provided")
+	}
+
+	current := getConfig()
+	next := current
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	next.registerFlags(fs)
+
+	fileData, err := loadConfigFile(configFilePath, fs)
+	if err != nil {
+		return err
+	}
+
+	// Only used at startup
+	next.APIWorkers = current.APIWorkers
+	next.ClientCompressionThreshold = current.ClientCompressionThreshold
+
+	if err := next.validate(); err != nil {
+		return err
+	}
+
+	configMutex.Lock()
+	config = next
+	configMutex.Unlock()
+
+	fileData.apply()
+	return nil
+}
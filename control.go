@@ -0,0 +1,203 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"strings"
+)
+
+// Plugin channel a companion client mod can control the proxy on instead of using chat commands.
+// Messages on it are never forwarded to the server.
+//
+// The client sends a VarInt request ID followed by a String with a command line, the proxy answers
+// every request on the same channel with the request ID, a Boolean that is true if the command
+// succeeded and a String. The commands are:
+//
+//	mode <mode|clear>          like /scmode, answers with the mode that is used now, empty if none is
+//	statcheck [mode] <player>  like /sc, answers with a JSON object with "player", "mode" and "stats",
+//	                           the stats are keyed like "final_kills" and "final_kd"
+//	overlay <show|hide|toggle> answers with "shown" or "hidden", fails if the overlay isn't running
+//
+// A failed command answers with the reason as plain text.
+const controlChannel = "GMCPROXY|CMD"
+
+// Handles a payload the client sent on controlChannel
+func (p *Proxy) handleControlMessage(payload []byte, clientConn io.Writer) error {
+	payloadReader := bytes.NewReader(payload)
+	requestID, _, err := readVarInt(payloadReader)
+	if err != nil {
+		p.logger.Println("Failed to parse a control message:", err)
+		return nil
+	}
+	commandLine, err := readPrefixedBytes(payloadReader)
+	if err != nil {
+		p.logger.Println("Failed to parse a control message:", err)
+		return nil
+	}
+
+	reply := func(success bool, message string) error {
+		return p.injectClientbound(createControlReplyPacket(requestID, success, message), clientConn)
+	}
+
+	args := strings.Fields(string(commandLine))
+	if len(args) == 0 {
+		return reply(false, "Empty command")
+	}
+	switch strings.ToLower(args[0]) {
+	case "mode":
+		if len(args) != 2 {
+			return reply(false, "Usage: mode <mode|clear>")
+		}
+		if strings.ToLower(args[1]) == "clear" {
+			p.setModeOverride(nil)
+		} else if bedwarsType, ok := GetBedwarsType(strings.ToLower(args[1])); ok {
+			p.setModeOverride(&bedwarsType)
+		} else {
+			return reply(false, "Invalid bedwars type")
+		}
+		bedwarsType, _ := p.currentBedwarsType()
+		return reply(true, string(bedwarsType))
+	case "statcheck":
+		return p.controlStatCheck(args[1:], reply)
+	case "overlay":
+		if len(args) != 2 {
+			return reply(false, "Usage: overlay <show|hide|toggle>")
+		}
+		if !overlayRunning.Load() {
+			return reply(false, "The overlay isn't running")
+		}
+		switch strings.ToLower(args[1]) {
+		case "show":
+			overlayHidden.Store(false)
+		case "hide":
+			overlayHidden.Store(true)
+		case "toggle":
+			overlayHidden.Store(!overlayHidden.Load())
+		default:
+			return reply(false, "Usage: overlay <show|hide|toggle>")
+		}
+		if overlayHidden.Load() {
+			return reply(true, "hidden")
+		}
+		return reply(true, "shown")
+	default:
+		return reply(false, fmt.Sprintf("Unknown command %q", args[0]))
+	}
+}
+
+// Looks up the stats for the statcheck control command on the API worker pool
+func (p *Proxy) controlStatCheck(args []string, reply func(bool, string) error) error {
+	if p.services.hypixel == nil {
+		return reply(false, "Hypixel API features have been disabled")
+	}
+	if len(args) != 1 && len(args) != 2 {
+		return reply(false, "Usage: statcheck [mode] <player>")
+	}
+
+	var bedwarsType BedwarsType
+	var ok bool
+	if len(args) == 2 {
+		bedwarsType, ok = GetBedwarsType(strings.ToLower(args[0]))
+		if !ok {
+			return reply(false, "Invalid bedwars type")
+		}
+	} else if bedwarsType, ok = p.currentBedwarsType(); !ok {
+		return reply(false, "The mode isn't known, give it with the command")
+	}
+	player := args[len(args)-1]
+
+	err := p.submitAPICommand(func() {
+		var err error
+		playerUuid, playerName, lookupErr := p.services.resolvePlayer(player)
+		if lookupErr != nil {
+			err = reply(false, lookupErr.Error())
+		} else if stats, statsErr := p.services.hypixel.getBedwarsStats(playerUuid, bedwarsType); statsErr != nil {
+			err = reply(false, statsErr.Error())
+		} else {
+			if playerName == "" {
+				playerName = stats.DisplayName
+			}
+			result, marshalErr := json.Marshal(map[string]any{"player": playerName, "mode": bedwarsType, "stats": controlStats(stats)})
+			if marshalErr != nil {
+				err = reply(false, marshalErr.Error())
+			} else {
+				err = reply(true, string(result))
+			}
+		}
+		if err != nil {
+			p.errorChecker(err)
+		}
+	})
+	if err != nil {
+		return reply(false, err.Error())
+	}
+	return nil
+}
+
+// Returns the stats for the statcheck control command, ratios without a denominator are null since
+// JSON has no NaN or infinity
+func controlStats(stats *BedwarsStats) map[string]any {
+	ratio := func(r float32) any {
+		if math.IsNaN(float64(r)) || math.IsInf(float64(r), 0) {
+			return nil
+		}
+		return r
+	}
+	return map[string]any{
+		"stars":        stats.Stars,
+		"kills":        stats.Kills,
+		"deaths":       stats.Deaths,
+		"kd":           ratio(stats.KD),
+		"final_kills":  stats.FinalKills,
+		"final_deaths": stats.FinalDeaths,
+		"final_kd":     ratio(stats.FinalKD),
+		"wins":         stats.Wins,
+		"losses":       stats.Losses,
+		"wl":           ratio(stats.WL),
+		"winstreak":    stats.Winstreak,
+		"beds_broken":  stats.BedsBroken,
+		"beds_lost":    stats.BedsLost,
+		"bblr":         ratio(stats.BBLR),
+		"games_played": stats.GamesPlayed,
+	}
+}
+
+// Creates a **Clientbound** plugin message packet on controlChannel (packet ID + data)
+func createControlReplyPacket(requestID int, success bool, message string) []byte {
+	var packetBody bytes.Buffer
+
+	// Packet ID
+	if err := writeVarInt(&packetBody, 0x3F); err != nil {
+		log.Panic(err)
+	}
+
+	// Channel length + Channel
+	if err := writeVarInt(&packetBody, len(controlChannel)); err != nil {
+		log.Panic(err)
+	}
+	packetBody.WriteString(controlChannel)
+
+	// Request ID, success, message length + message
+	if err := writeVarInt(&packetBody, requestID); err != nil {
+		log.Panic(err)
+	}
+	if success {
+		packetBody.WriteByte(1)
+	} else {
+		packetBody.WriteByte(0)
+	}
+	if err := writeVarInt(&packetBody, len(message)); err != nil {
+		log.Panic(err)
+	}
+	packetBody.WriteString(message)
+
+	return packetBody.Bytes()
+}
@@ -0,0 +1,78 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The last time the server disconnected a player, shown by the admin interface's status
+type disconnectData struct {
+	username string
+	reason   string
+	at       time.Time
+}
+
+var lastDisconnect *disconnectData
+var lastDisconnectMutex sync.Mutex
+
+// Reads the reason of a Play Disconnect sent by the server, the packet is still forwarded
+func (p *Proxy) handleServerDisconnect(packetReader *bytes.Reader) error {
+	reasonBytes, err := readPrefixedBytes(packetReader)
+	if err != nil {
+		return err
+	}
+	reason := chatComponentText(string(reasonBytes))
+
+	p.commandMutex.Lock()
+	p.disconnectReason = reason
+	p.commandMutex.Unlock()
+
+	lastDisconnectMutex.Lock()
+	lastDisconnect = &disconnectData{p.username, reason, time.Now()}
+	lastDisconnectMutex.Unlock()
+
+	p.logger.Println("Disconnected by the server:", reason)
+	return nil
+}
+
+// Returns the text of a chat component on one line without formatting, or the component itself if
+// it isn't valid JSON
+func chatComponentText(component string) string {
+	text, ok := componentText([]byte(component))
+	if !ok {
+		return component
+	}
+	return strings.Join(strings.Fields(colorCodeRegex.ReplaceAllString(text, "")), " ")
+}
+
+// Joins the text of a chat component, a plain string or an object whose extra holds more components
+// Returns:
+// bool: false if it isn't a chat component
+func componentText(component []byte) (string, bool) {
+	var text string
+	if err := json.Unmarshal(component, &text); err == nil {
+		return text, true
+	}
+	var chatMessage struct {
+		Text  string            `json:"text"`
+		Extra []json.RawMessage `json:"extra"`
+	}
+	if err := json.Unmarshal(component, &chatMessage); err != nil {
+		return "", false
+	}
+	var builder strings.Builder
+	builder.WriteString(chatMessage.Text)
+	for _, e := range chatMessage.Extra {
+		if extraText, ok := componentText(e); ok {
+			builder.WriteString(extraText)
+		}
+	}
+	return builder.String(), true
+}
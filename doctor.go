@@ -0,0 +1,163 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// Checks that an access token and UUID have been provided, without asking Mojang
+func validateAccount(accessToken string, uuid string) error {
+	if accessToken == "" {
+		return errors.New("No Mojang Access Token has been provided")
+	}
+	if !isJWT(accessToken) {
+		return errors.New("The Mojang Access Token is invalid, it should be a JWT: three parts separated by dots, starting with \"eyJ\"")
+	}
+	if uuid == "" {
+		return errors.New("No UUID has been provided")
+	}
+	if !uuidRegex.MatchString(uuid) {
+		return errors.New("An invalid UUID has been provided")
+	}
+	return nil
+}
+
+// Removes the "Bearer " prefix in any capitalisation
+func trimBearerPrefix(accessToken string) string {
+	const prefix = "Bearer "
+	accessToken = strings.TrimSpace(accessToken)
+	if len(accessToken) >= len(prefix) && strings.EqualFold(accessToken[:len(prefix)], prefix) {
+		return strings.TrimSpace(accessToken[len(prefix):])
+	}
+	return accessToken
+}
+
+// Access tokens are JWTs: a base64url JSON header, payload and signature separated by dots
+func isJWT(token string) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		return false
+	}
+	header, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[0], "="))
+	return err == nil && json.Valid(header)
+}
+
+func validateHypixelAPIURL(apiURL string) error {
+	if u, err := url.Parse(apiURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("Invalid Hypixel API URL, must be an http or https URL")
+	}
+	return nil
+}
+
+// Looks up the account the access token belongs to
+func getOwnProfile(accessToken string) (*APIProfile, error) {
+	req, err := http.NewRequest("GET", "https://api.minecraftservices.com/minecraft/profile", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to reach Mojang: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return nil, errors.New("The access token has been rejected, it has probably expired. Get a new one, see https://kqzz.github.io/mc-bearer-token/")
+	case http.StatusNotFound:
+		return nil, errors.New("The account of the access token doesn't own Minecraft")
+	default:
+		return nil, fmt.Errorf("Unexpected response from Mojang: %s", resp.Status)
+	}
+
+	apiProfile := APIProfile{}
+	if err := json.NewDecoder(resp.Body).Decode(&apiProfile); err != nil {
+		return nil, err
+	}
+	return &apiProfile, nil
+}
+
+type doctorCheck struct {
+	name string
+	// Returns details to show when the check passes
+	run func() (string, error)
+}
+
+// Runs every check for -doctor and prints whether it passed
+// Returns:
+// bool: true if every check passed
+func runDoctor(accessToken string, uuid string, offline bool, hypixelAPIKey string, hypixelAPIURL string, forwardAddr string) bool {
+	checks := []doctorCheck{
+		{"Mojang account", func() (string, error) {
+			if offline && accessToken == "" && uuid == "" {
+				return "not needed, the backend is in offline mode", nil
+			}
+			if err := validateAccount(accessToken, uuid); err != nil {
+				return "", err
+			}
+			profile, err := getOwnProfile(accessToken)
+			if err != nil {
+				return "", err
+			}
+			if !strings.EqualFold(profile.Id, strings.ReplaceAll(uuid, "-", "")) {
+				return "", fmt.Errorf("The UUID doesn't belong to the access token's account %s, whose UUID is %s", profile.Name, profile.Id)
+			}
+			return "logged in as " + profile.Name, nil
+		}},
+		{"Hypixel API Key", func() (string, error) {
+			if hypixelAPIKey == "" {
+				return "none provided, Hypixel API features will be disabled", nil
+			}
+			if err := validateHypixelAPIURL(hypixelAPIURL); err != nil {
+				return "", err
+			}
+			err := newHypixel(hypixelAPIKey, hypixelAPIURL).testKey()
+			if errors.Is(err, InvalidKey) {
+				return "", errors.New("Invalid Hypixel API Key, create a new one on the Hypixel Developer Dashboard")
+			} else if err != nil {
+				return "", fmt.Errorf("Failed to reach the Hypixel API at %s: %w", hypixelAPIURL, err)
+			}
+			return "valid", nil
+		}},
+		{"Backend", func() (string, error) {
+			conn, err := dialBackend(forwardAddr)
+			if err != nil {
+				return "", fmt.Errorf("Could not connect to %s, check -forwardhost and -forwardport: %w", forwardAddr, err)
+			}
+			conn.Close()
+
+			pinger := &Proxy{forwardAddr: forwardAddr, logger: log.Default()}
+			if _, err := pinger.fetchBackendStatus(); err != nil {
+				return "", fmt.Errorf("%s accepts connections but didn't answer a 1.8 server list ping: %w", forwardAddr, err)
+			}
+			return forwardAddr + " answers server list pings", nil
+		}},
+	}
+
+	passed := true
+	for _, check := range checks {
+		details, err := check.run()
+		if err != nil {
+			color.Red("✖ %s: %v", check.name, err)
+			passed = false
+		} else {
+			color.Green("✔ %s: %s", check.name, details)
+		}
+	}
+	return passed
+}
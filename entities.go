@@ -0,0 +1,84 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Metadata index of the custom name every entity has, Hypixel names its NPCs and holograms with it
+const metadataCustomName = 2
+
+// Reads an Entity Metadata packet and keeps track of the entity's custom name
+func (p *Proxy) handleEntityMetadata(packetReader *bytes.Reader) error {
+	entityID, _, err := readVarInt(packetReader)
+	if err != nil {
+		return err
+	}
+	metadata, err := readEntityMetadata(packetReader)
+	if err != nil {
+		return err
+	}
+	name, ok := metadata[metadataCustomName].(string)
+	if !ok {
+		return nil
+	}
+
+	p.nametagsMutex.Lock()
+	defer p.nametagsMutex.Unlock()
+	if name == "" {
+		delete(p.nametags, int32(entityID))
+	} else {
+		p.nametags[int32(entityID)] = name
+	}
+	return nil
+}
+
+// Reads a Destroy Entities packet and forgets the nametags of the entities
+func (p *Proxy) handleDestroyEntities(packetReader *bytes.Reader) error {
+	count, _, err := readVarInt(packetReader)
+	if err != nil {
+		return err
+	}
+
+	p.nametagsMutex.Lock()
+	defer p.nametagsMutex.Unlock()
+	for range count {
+		entityID, _, err := readVarInt(packetReader)
+		if err != nil {
+			return err
+		}
+		delete(p.nametags, int32(entityID))
+	}
+	return nil
+}
+
+// Returns the custom names of the entities the server has sent, which are the ones near the player,
+// sorted without their color codes
+func (p *Proxy) nearbyNametags() []string {
+	p.nametagsMutex.Lock()
+	names := make([]string, 0, len(p.nametags))
+	for _, name := range p.nametags {
+		names = append(names, name)
+	}
+	p.nametagsMutex.Unlock()
+
+	slices.SortFunc(names, func(a string, b string) int {
+		return strings.Compare(colorCodeRegex.ReplaceAllString(a, ""), colorCodeRegex.ReplaceAllString(b, ""))
+	})
+	return names
+}
+
+// Handles /nametags
+func (p *Proxy) handleNametags(w io.Writer) error {
+	names := p.nearbyNametags()
+	if len(names) == 0 {
+		return p.writeChatMessageToClient("§bGoMCProxy: "+p.translate("nametags.none"), ChatTypeChat, w)
+	}
+	return p.writePagedMessage("§bGoMCProxy Nametags: "+p.translate("nametags.header", len(names))+"\n§r"+strings.Join(names, "\n§r"), w)
+}
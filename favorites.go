@@ -0,0 +1,213 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Favorite struct {
+	UUID string `json:"uuid"` // Without dashes, names can change
+	Name string `json:"name"` // Last known name
+}
+
+// Players to check with /sc fav, kept in a JSON file
+type Favorites struct {
+	path      string
+	favorites []Favorite
+	mutex     sync.Mutex
+}
+
+const maxFavorites = 32
+
+var AlreadyFavorite = errors.New("Already a favorite")
+var TooManyFavorites = errors.New("Too many favorites")
+
+// Reads the favorites at path, a missing file has none
+func loadFavorites(path string) (*Favorites, error) {
+	f := &Favorites{path: path}
+	err := readJSONFile(path, &f.favorites)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Callers hold the mutex
+func (f *Favorites) saveLocked() error {
+	return writeJSONFile(f.path, f.favorites)
+}
+
+func (f *Favorites) add(profile *APIProfile) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	uuid := strings.ToLower(strings.ReplaceAll(profile.Id, "-", ""))
+	for _, favorite := range f.favorites {
+		if favorite.UUID == uuid {
+			return AlreadyFavorite
+		}
+	}
+	if len(f.favorites) >= maxFavorites {
+		return TooManyFavorites
+	}
+	f.favorites = append(f.favorites, Favorite{uuid, profile.Name})
+	return f.saveLocked()
+}
+
+// Removes the favorite with the last known name, case-insensitively
+// Returns:
+// *Favorite: the removed favorite, nil if there was no favorite with the name
+func (f *Favorites) remove(name string) (*Favorite, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for i, favorite := range f.favorites {
+		if strings.EqualFold(favorite.Name, name) {
+			f.favorites = append(f.favorites[:i], f.favorites[i+1:]...)
+			return &favorite, f.saveLocked()
+		}
+	}
+	return nil, nil
+}
+
+func (f *Favorites) list() []Favorite {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]Favorite(nil), f.favorites...)
+}
+
+// Remembers a new name of a favorite, which Hypixel reports when checking their stats
+func (f *Favorites) rename(uuid string, name string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for i, favorite := range f.favorites {
+		if favorite.UUID == uuid && favorite.Name != name {
+			f.favorites[i].Name = name
+			return f.saveLocked()
+		}
+	}
+	return nil
+}
+
+// Handles /scfav add and remove, which look up the player and write the file
+func (p *Proxy) handleFavorites(message string, w io.Writer) {
+	start := time.Now()
+	defer p.logIfSlow(start, "/scfav")
+	succeeded := false
+	defer func() { logCommand(message, start, succeeded) }()
+
+	writeMessage := func(text string) {
+		if err := p.writeChatMessageToClient("§bGoMCProxy StatCheck: "+text, ChatTypeChat, w); err != nil {
+			p.errorChecker(err)
+		}
+	}
+
+	messageSplit := strings.Fields(message)
+	if len(messageSplit) != 3 {
+		writeMessage(p.translate("favorites.usage"))
+		return
+	}
+	name := messageSplit[2]
+
+	switch strings.ToLower(messageSplit[1]) {
+	case "add":
+		apiProfile, err := p.services.getPlayerProfile(name)
+		if err != nil {
+			writeMessage(p.translate(playerProfileErrorKey(err)))
+			return
+		}
+		err = p.services.favorites.add(apiProfile)
+		if errors.Is(err, AlreadyFavorite) {
+			writeMessage(p.translate("favorites.already_favorite", apiProfile.Name))
+			return
+		} else if errors.Is(err, TooManyFavorites) {
+			writeMessage(p.translate("favorites.too_many", maxFavorites))
+			return
+		} else if err != nil {
+			writeMessage(p.translate("favorites.save_failed", err.Error()))
+			return
+		}
+		succeeded = true
+		writeMessage(p.translate("favorites.added", apiProfile.Name))
+	case "remove":
+		removed, err := p.services.favorites.remove(name)
+		if removed == nil {
+			writeMessage(p.translate("favorites.not_favorite", name))
+			return
+		} else if err != nil {
+			writeMessage(p.translate("favorites.save_failed", err.Error()))
+			return
+		}
+		succeeded = true
+		writeMessage(p.translate("favorites.removed", removed.Name))
+	default:
+		writeMessage(p.translate("favorites.usage"))
+	}
+}
+
+// Handles /scfav list
+func (p *Proxy) writeFavoritesList(w io.Writer) error {
+	favorites := p.services.favorites.list()
+	if len(favorites) == 0 {
+		return p.writeChatMessageToClient("§bGoMCProxy StatCheck: "+p.translate("favorites.none"), ChatTypeChat, w)
+	}
+
+	names := make([]string, len(favorites))
+	for i, favorite := range favorites {
+		names[i] = favorite.Name
+	}
+	return p.writeChatMessageToClient("§bGoMCProxy StatCheck: "+p.translate("favorites.list", strings.Join(names, "§r, §6")), ChatTypeChat, w)
+}
+
+// Handles /sc [mode] fav, checking every favorite one after the other so it only takes up one API worker
+// Returns:
+// bool: true if the stats of every favorite were shown
+func (p *Proxy) statCheckFavorites(bedwarsType BedwarsType, w io.Writer) bool {
+	favorites := p.services.favorites.list()
+	if len(favorites) == 0 {
+		if err := p.writeChatMessageToClient("§bGoMCProxy StatCheck: "+p.translate("favorites.none"), ChatTypeChat, w); err != nil {
+			p.errorChecker(err)
+		}
+		return false
+	}
+
+	lines := []string{"§bGoMCProxy StatCheck: " + p.translate("favorites.header", capitaliseFirst(string(bedwarsType)))}
+	succeeded := true
+	for _, favorite := range favorites {
+		stats, err := p.services.hypixel.getBedwarsStats(favorite.UUID, bedwarsType)
+		if err != nil {
+			lines = append(lines, "§7"+favorite.Name+": "+p.translate(hypixelErrorKey(err)))
+			succeeded = false
+			// The rest would be rate limited as well
+			if errors.Is(err, RateLimited) {
+				break
+			}
+			continue
+		}
+
+		if stats.DisplayName != "" && stats.DisplayName != favorite.Name {
+			if err := p.services.favorites.rename(favorite.UUID, stats.DisplayName); err != nil {
+				p.logger.Println("Failed to save the favorites:", err)
+			}
+			favorite.Name = stats.DisplayName
+		}
+		lines = append(lines, p.translate("favorites.stats",
+			stats.Rank, favorite.Name, stats.Stars, stats.FinalKD, stats.WL, stats.Winstreak))
+	}
+
+	if err := p.writePagedMessage(strings.Join(lines, "\n"), w); err != nil {
+		p.errorChecker(err)
+	}
+	return succeeded
+}
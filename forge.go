@@ -0,0 +1,48 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"strings"
+)
+
+// Forge 1.8 clients append this to the server address of the handshake, servers only start the
+// FML handshake when they see it
+const fmlMarker = "\x00FML\x00"
+
+// The first byte of FML|HS messages
+var fmlHandshakeMessages = map[byte]string{
+	0x00: "ServerHello",
+	0x01: "ClientHello",
+	0x02: "ModList",
+	0x03: "RegistryData",
+	0xFE: "HandshakeReset",
+	0xFF: "HandshakeAck",
+}
+
+// Plugin channels used by Forge, these are forwarded untouched
+func isForgeChannel(channel string) bool {
+	return strings.HasPrefix(channel, "FML") || channel == "FORGE"
+}
+
+// Logs a Forge plugin message with -debug-forge
+func (p *Proxy) logForgeMessage(channel string, payload []byte, clientToServer bool) {
+	if !getConfig().DebugForge {
+		return
+	}
+	direction := "server -> client"
+	if clientToServer {
+		direction = "client -> server"
+	}
+	if channel == "FML|HS" && len(payload) > 0 {
+		name, ok := fmlHandshakeMessages[payload[0]]
+		if !ok {
+			name = "Unknown"
+		}
+		p.logger.Printf("Forge %s: %s %s (0x%02X), %d bytes", direction, channel, name, payload[0], len(payload))
+		return
+	}
+	p.logger.Printf("Forge %s: %s, %d bytes", direction, channel, len(payload))
+}
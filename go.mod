@@ -5,6 +5,7 @@ go 1.24.4
 require (
 	github.com/fatih/color v1.18.0
 	github.com/gen2brain/raylib-go/raylib v0.55.1
+	golang.org/x/crypto v0.40.0
 )
 
 require (
@@ -12,5 +13,5 @@ require (
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	golang.org/x/exp v0.0.0-20240506185415-9bf2ced13842 // indirect
-	golang.org/x/sys v0.25.0 // indirect
+	golang.org/x/sys v0.34.0 // indirect
 )
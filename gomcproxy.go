@@ -12,6 +12,7 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/binary"
 	"encoding/json"
@@ -23,10 +24,14 @@ import (
 	"math/big"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -51,8 +56,11 @@ const (
 )
 
 type Proxy struct {
-	state           State
-	threshold       int
+	state atomic.Int32 // A State, changed by one proxyTraffic goroutine while the other reads it
+	// Set by the clientbound goroutine on Set Compression and read by both directions, the flush timers
+	// and the API workers, so they are atomic like state
+	serverThreshold atomic.Int32
+	clientThreshold atomic.Int32
 	sharedSecret    []byte
 	serverPublicKey *rsa.PublicKey
 	serverDecrypt   cipher.Stream
@@ -60,14 +68,94 @@ type Proxy struct {
 	serverReader    *cipher.StreamReader
 	serverWriter    *cipher.StreamWriter
 	wg              sync.WaitGroup
+	services        *Services
 	forwardAddr     string
 	accessToken     string
 	uuid            string
-	isHypixel       bool
-	bedwarsType     *BedwarsType
+	isHypixel       atomic.Bool  // Set by the clientbound goroutine from the server brand, read by /scupdate
+	isForge         bool         // The client sent fmlMarker in its handshake
+	bedwarsType     *BedwarsType // Guarded by commandMutex
+	modeOverride    *BedwarsType // Set with /scmode, takes precedence over bedwarsType, guarded by commandMutex
+	locrawMode      string       // Mode of the current Bedwars game as reported by /locraw, used to requeue
+	inventory       [45]*ItemStack
+	heldSlot        int
+	shopWindow      byte     // Window ID of the open Quick Buy page, 0 if it isn't open
+	quickBuy        []string // Item names of the Quick Buy layout, nil until the item shop was opened
+	quickBuyAt      time.Time
+	experience      experienceData // Guarded by inventoryMutex
+	inventoryMutex  sync.RWMutex
+	commandQueue    []queuedPacket
+	commandMutex    sync.Mutex
+	clientConn      net.Conn
+	serverConn      net.Conn
+	username        string
+	// Held while writing a packet so injected packets never interleave with forwarded ones,
+	// the server stream also can't be encrypted by two goroutines at once
+	clientWriteMutex sync.Mutex
+	serverWriteMutex sync.Mutex
+	clientboundQueue [][]byte // Injected clientbound packets, see injectClientbound
+	clientboundMutex sync.Mutex
+	pagedHeader      string
+	pagedLines       []string
+	pagedPage        int
+	pagedMutex       sync.Mutex
+	lookupSlots      chan struct{}              // Semaphore bounding this connection's in-flight API commands
+	beds             map[BlockPosition]struct{} // Bed heads in the loaded chunks, only tracked with -bed-alerts
+	requeueTimer     *time.Timer                // Pending -auto-requeue, guarded by commandMutex
+	flushTimer       *time.Timer                // Sends the command queue once a delayed command is due, guarded by commandMutex
+	refreshTimer     *time.Timer                // Running out while /scupdate waits for /locraw, guarded by commandMutex
+	requeues         int
+	locale           string // From Client Settings, lowercase e.g. "en_us"
+	localeMutex      sync.Mutex
+	session          map[BedwarsType]*SessionStats // Guarded by commandMutex
+	gameRecorded     bool                          // The current game's result is in session, guarded by commandMutex
+	gameServer       string                        // The server of the current game from /locraw, guarded by commandMutex
+	partyInvites     map[string]string             // Leader by lowercase inviter and leader of invites being accepted, guarded by commandMutex
+	summaryLines     []string                      // Lines of the game summary being read, nil outside of one. Only used by the clientbound proxyTraffic
+	nametags         map[int32]string              // Custom names by entity ID
+	nametagsMutex    sync.Mutex
+	teams            map[string]*Team  // By team name
+	playerTeams      map[string]string // Team name by player name
+	teamsMutex       sync.Mutex
+	clientGone       atomic.Bool // Reading from the client failed
+	closeOnce        sync.Once   // For sideClosed
+	connectedAt      time.Time
+	disconnectReason string      // From the server's Play Disconnect, guarded by commandMutex
+	chatLimiter      chatLimiter // See -chat-rate-limit
+	clientInfo       clientInfo  // Guarded by clientInfoMutex
+	clientInfoMutex  sync.Mutex
+	droppedPackets   map[allowlistKey]map[int]bool // Packet IDs the allowlist dropped that have been logged, guarded by droppedMutex
+	droppedMutex     sync.Mutex
+	logger           *log.Logger // Prefixes every line with the client's address, and its username once logged in
 }
 
-var hypixel *Hypixel
+type queuedPacket struct {
+	packet []byte    // Packet ID + data, framed when sent since the threshold can change in the meantime
+	sendAt time.Time // Not sent before this, see -inject-delay
+}
+
+// The APIs used by the connections of a proxy instance, passed to handleClient so that several
+// instances can run in one process
+type Services struct {
+	hypixel   *Hypixel            // nil when no Hypixel API Key has been provided
+	profiles  *Cache[*APIProfile] // Mojang profiles keyed by lowercase name, names are case-insensitive
+	favorites *Favorites
+	snapshots *Snapshots
+}
+
+func newServices(hypixel *Hypixel, favorites *Favorites, snapshots *Snapshots) *Services {
+	return &Services{hypixel, newCache[*APIProfile](), favorites, snapshots}
+}
+
+// Runs commands that call the Hypixel or Mojang API
+var apiWorkers *WorkerPool
+
+// Maximum amount of API commands waiting for a worker across all connections
+const apiWorkerQueueSize = 64
+
+// Active sessions by lowercase login username
+var sessions = make(map[string]*Proxy)
+var sessionsMutex sync.Mutex
 
 var colorCodeRegex = regexp.MustCompile(`§([0-9a-fk-or*])`)
 var purchasedRegex = regexp.MustCompile(`purchased ([a-zA-Z ]*)$`)
@@ -84,44 +172,224 @@ func main() {
 
 	uuid := flag.String("uuid", "", "Your Minecraft account's UUID")
 
+	offline := flag.Bool("offline", false, "The forward address is an offline mode server, which never asks for the account, so -accesstoken and -uuid aren't needed")
+
 	hak := flag.String("hypixel-api-key", "", "Hypixel API Key")
+	hypixelAPIURL := flag.String("hypixel-api-url", defaultHypixelAPIURL, "Base URL of the Hypixel API, for using a mirror. The API Key is sent to it as well")
 
 	overlay := flag.Bool("overlay", false, "Show the overlay")
+	debugOverlay := flag.Bool("overlay-debug", false, "Fill the overlay with sample data from key presses to test its layout: U buys an upgrade, T buys a trap, S sets one off, G toggles being in a game and C clears everything")
+
+	mirrorAddr := flag.String("mirror-addr", "", "Address to accept read-only observers on, which receive a copy of every clientbound packet. Meant for a single connected client")
+
+	adminPort := flag.Int("admin-port", 0, "Port of a line-based control interface for scripts (status, connections, reload, disconnect), 0 disables it")
+	adminHost := flag.String("admin-host", "127.0.0.1", "Host the control interface of -admin-port listens on, it has no authentication so keep it local")
+
+	metricsAddr := flag.String("metrics-addr", "", "Address to serve Prometheus histograms of packet sizes and Hypixel and Mojang request durations on, under /metrics. Disabled by default")
+
+	commandLogPath := flag.String("command-log", "", "CSV file to append proxy command usage to (command, argument count, success and latency), \"-\" logs it instead. Disabled by default")
+
+	highlightsPath := flag.String("highlights", "", "CSV file to append a timeline of the player's highlights to (time, event, player, detail, mode and map), \"-\" logs them instead. Disabled by default")
+	highlightEventsList := flag.String("highlight-events", strings.Join(highlightEvents, ","), "Comma separated events -highlights records, out of kill, final_kill, bed and win")
+
+	favoritesPath := flag.String("favorites", "favorites.json", "JSON file the players added with /scfav are kept in, gzipped if the name ends in .gz")
+
+	snapshotsPath := flag.String("snapshots", "", "JSON file the stats saved with /sc snap are kept in, gzipped if the name ends in .gz. By default they are lost when the proxy stops")
+
+	configPath := flag.String("config", "", "JSON file with settings keyed by flag name, packet rewriting rules under \"rules\", the forwarded packet IDs under \"allowlist\" and translations by locale under \"messages\"")
+
+	doctor := flag.Bool("doctor", false, "Check the access token and UUID, the Hypixel API Key and the backend, report what is wrong and exit")
+
+	noColor := flag.Bool("no-color", false, "Disable colored output, also disabled automatically when stdout is not a terminal")
+
+	config.registerFlags(flag.CommandLine)
+
+	compressionThreshold := flag.Int("compression-threshold", -1, "Compression threshold towards the client instead of the server's, -1 disables compression and 0 compresses every packet (default: follow the server)")
+
+	sshTunnelTarget := flag.String("ssh-tunnel", "", "SSH server to dial the forward address through, as user@host:port. The SSH server resolves the forward address, so 127.0.0.1 is the SSH server itself")
+	sshKey := flag.String("ssh-key", "", "Unencrypted private key file to log in to -ssh-tunnel with")
+	sshPassword := flag.String("ssh-password", "", "Password to log in to -ssh-tunnel with, tried after -ssh-key")
+	sshKnownHosts := flag.String("ssh-known-hosts", "", "known_hosts file with the host key of -ssh-tunnel (default ~/.ssh/known_hosts)")
 
 	flag.Parse()
+	flag.Visit(func(f *flag.Flag) {
+		commandLineFlags[f.Name] = true
+	})
+
+	// The color package already disables itself when stdout is not a terminal or TERM=dumb.
+	// Applied before loading the config file so its errors aren't colored, and again after since
+	// the file can set it too.
+	if *noColor {
+		color.NoColor = true
+	}
+
+	if *configPath != "" {
+		configFilePath = *configPath
+		fileData, err := loadConfigFile(configFilePath, flag.CommandLine)
+		if err != nil {
+			color.Red("Failed to load the config file: %s", err)
+			return
+		}
+		fileData.apply()
+		if *noColor {
+			color.NoColor = true
+		}
+	}
+
+	listenAddr, err := joinHostPort(*listenHost, *listenPort, "listenhost", "listenport")
+	if err != nil {
+		color.Red("%v", err)
+		return
+	}
+	if *forwardHost == "" {
+		color.Red("-forwardhost can't be empty")
+		return
+	}
+	forwardAddr, err := joinHostPort(*forwardHost, *forwardPort, "forwardhost", "forwardport")
+	if err != nil {
+		color.Red("%v", err)
+		return
+	}
+
+	if *sshTunnelTarget != "" {
+		tunnel, err := newSSHTunnel(*sshTunnelTarget, *sshKey, *sshPassword, *sshKnownHosts)
+		if err != nil {
+			color.Red("%v", err)
+			return
+		}
+		sshTunnel = tunnel
+	}
 
-	listenAddr := *listenHost + ":" + *listenPort
-	forwardAddr := *forwardHost + ":" + *forwardPort
+	// Tokens copied from an Authorization header start with "Bearer "
+	*accessToken = trimBearerPrefix(*accessToken)
 
-	if *accessToken == "" {
-		color.Red("No Mojang Access Token has been provided")
+	if *doctor {
+		if !runDoctor(*accessToken, *uuid, *offline, *hak, *hypixelAPIURL, forwardAddr) {
+			os.Exit(1)
+		}
 		return
 	}
 
-	uuidRegex := regexp.MustCompile(`[0-9a-fA-F]{8}\b-[0-9a-fA-F]{4}\b-[0-9a-fA-F]{4}\b-[0-9a-fA-F]{4}\b-[0-9a-fA-F]{12}`)
-	if *uuid == "" {
-		color.Red("No UUID has been provided")
+	// An account given with -offline is still checked, it is used if the server asks for it after all
+	if !*offline || *accessToken != "" || *uuid != "" {
+		if err := validateAccount(*accessToken, *uuid); err != nil {
+			color.Red("%v", err)
+			return
+		}
+		*uuid = normalizeUUID(*uuid)
+	}
+
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "compression-threshold" {
+			config.ClientCompressionThreshold = compressionThreshold
+		}
+	})
+	if *compressionThreshold < -1 {
+		color.Red("The compression threshold must be -1 (disabled) or higher")
 		return
 	}
-	if !uuidRegex.Match([]byte(*uuid)) {
-		color.Red("An invalid UUID has been provided")
+
+	if err := config.validate(); err != nil {
+		color.Red("%v", err)
 		return
 	}
+	apiWorkers = newWorkerPool(config.APIWorkers, apiWorkerQueueSize)
 
+	var hypixel *Hypixel
 	if *hak == "" {
 		color.Yellow("No Hypixel API Key has been provided, Hypixel API features will be disabled")
 	} else {
-		hypixel = newHypixel(*hak)
+		if err := validateHypixelAPIURL(*hypixelAPIURL); err != nil {
+			color.Red("%v", err)
+			return
+		}
+		hypixel = newHypixel(*hak, *hypixelAPIURL)
+
+		if err := hypixel.testKey(); errors.Is(err, InvalidKey) {
+			color.Red("Invalid Hypixel API Key")
+			return
+		} else if err != nil {
+			color.Red("An error occurred while testing the Hypixel API Key: %v", err)
+			return
+		}
+	}
+
+	favorites, err := loadFavorites(*favoritesPath)
+	if err != nil {
+		color.Red("Failed to load the favorites: %v", err)
+		return
+	}
+	snapshots, err := loadSnapshots(*snapshotsPath)
+	if err != nil {
+		color.Red("Failed to load the snapshots: %v", err)
+		return
+	}
+	services := newServices(hypixel, favorites, snapshots)
 
-		valid, err := hypixel.testKey()
+	if *commandLogPath != "" {
+		cl, err := openCommandLog(*commandLogPath)
 		if err != nil {
-			color.Red("An error occurred while testing the Hypixel API Key: ", err)
+			color.Red("Failed to open the command log: %v", err)
 			return
 		}
-		if !valid {
-			color.Red("Invalid Hypixel API Key")
+		defer cl.close()
+		commandLog = cl
+	}
+
+	if *highlightsPath != "" {
+		hl, err := openHighlightLog(*highlightsPath, *highlightEventsList)
+		if err != nil {
+			color.Red("Failed to open the highlight log: %v", err)
+			return
+		}
+		defer hl.close()
+		highlightLog = hl
+	}
+
+	if *mirrorAddr != "" {
+		mirrorLn, err := net.Listen("tcp", *mirrorAddr)
+		if err != nil {
+			color.Red("Failed to listen on the mirror address %s: %v", *mirrorAddr, err)
+			return
+		}
+		defer mirrorLn.Close()
+		log.Printf("Mirroring clientbound packets to observers on %s", *mirrorAddr)
+
+		mirror = newMirror()
+		go mirror.serve(mirrorLn)
+	}
+
+	if *adminPort != 0 {
+		adminAddr := net.JoinHostPort(*adminHost, strconv.Itoa(*adminPort))
+		adminLn, err := net.Listen("tcp", adminAddr)
+		if err != nil {
+			color.Red("Failed to listen on the admin address %s: %v", adminAddr, err)
 			return
 		}
+		defer adminLn.Close()
+		log.Printf("Accepting admin connections on %s", adminAddr)
+
+		go newAdminServer(forwardAddr).serve(adminLn)
+	}
+
+	if *metricsAddr != "" {
+		metricsLn, err := net.Listen("tcp", *metricsAddr)
+		if err != nil {
+			color.Red("Failed to listen on the metrics address %s: %v", *metricsAddr, err)
+			return
+		}
+		defer metricsLn.Close()
+		log.Printf("Serving metrics on http://%s/metrics", metricsLn.Addr())
+
+		metricsEnabled = true
+		http.DefaultClient.Transport = timedTransport{http.DefaultTransport}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", serveMetrics)
+		go func() {
+			if err := http.Serve(metricsLn, mux); err != nil && !errors.Is(err, net.ErrClosed) {
+				log.Println("Metrics server failed:", err)
+			}
+		}()
 	}
 
 	ln, err := net.Listen("tcp", listenAddr)
@@ -131,164 +399,529 @@ func main() {
 	defer ln.Close()
 	log.Printf("Proxy listening on %s, forwarding to %s", listenAddr, forwardAddr)
 
+	if configFilePath != "" {
+		reload := make(chan os.Signal, 1)
+		signal.Notify(reload, syscall.SIGHUP)
+		go func() {
+			for range reload {
+				if err := reloadConfig(); err != nil {
+					log.Println("Failed to reload the config file:", err)
+				} else {
+					log.Println("Reloaded the config file")
+				}
+			}
+		}()
+	}
+
 	go func() {
+		var acceptDelay time.Duration
 		for {
 			clientConn, err := ln.Accept()
 			if err != nil {
-				log.Panic(err)
+				if errors.Is(err, net.ErrClosed) {
+					log.Println("Listener closed, no longer accepting connections")
+					return
+				}
+
+				// Transient errors like running out of file descriptors, back off and try again
+				if acceptDelay == 0 {
+					acceptDelay = 5 * time.Millisecond
+				} else {
+					acceptDelay = min(acceptDelay*2, time.Second)
+				}
+				log.Printf("Failed to accept a connection, retrying in %s: %v", acceptDelay, err)
+				time.Sleep(acceptDelay)
 				continue
 			}
-			go handleClient(clientConn, forwardAddr, *accessToken, *uuid)
+			acceptDelay = 0
+			go handleClient(clientConn, services, forwardAddr, *accessToken, *uuid)
 		}
 	}()
 
+	// Closed on SIGINT or SIGTERM so the overlay can close its window before main returns
+	shutdown := make(chan struct{})
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-stop
+		log.Printf("Received %s, shutting down", sig)
+		close(shutdown)
+	}()
+
 	if *overlay {
-		runOverlay()
+		runOverlay(*debugOverlay, shutdown)
 	} else {
-		select {}
+		<-shutdown
 	}
 }
 
-func handleClient(clientConn net.Conn, forwardAddr string, accessToken string, uuid string) {
-	serverConn, err := net.Dial("tcp", forwardAddr)
-	if err != nil {
-		clientConn.Close()
-		log.Panic(err)
-	}
+func handleClient(clientConn net.Conn, services *Services, forwardAddr string, accessToken string, uuid string) {
+	cfg := getConfig()
+	clientConn = tuneConn(clientConn, cfg)
 
 	proxy := Proxy{
-		state:           StateHandshaking,
-		threshold:       -1,
 		sharedSecret:    nil,
 		serverPublicKey: nil,
 		serverDecrypt:   nil,
 		serverEncrypt:   nil,
 		serverReader:    nil,
 		serverWriter:    nil,
+		services:        services,
 		forwardAddr:     forwardAddr,
 		accessToken:     accessToken,
 		uuid:            uuid,
-		isHypixel:       false,
 		bedwarsType:     nil,
+		lookupSlots:     make(chan struct{}, cfg.MaxLookups),
+		beds:            make(map[BlockPosition]struct{}),
+		session:         make(map[BedwarsType]*SessionStats),
+		partyInvites:    make(map[string]string),
+		nametags:        make(map[int32]string),
+		teams:           make(map[string]*Team),
+		playerTeams:     make(map[string]string),
+		connectedAt:     time.Now(),
+		logger:          log.New(log.Writer(), fmt.Sprintf("[%s] ", clientConn.RemoteAddr()), log.Flags()|log.Lmsgprefix),
+	}
+	proxy.setServerThreshold(-1)
+	proxy.setClientThreshold(-1)
+
+	if cfg.StatusCacheTTL > 0 {
+		proxiedConn := proxy.answerFromStatusCache(clientConn)
+		if proxiedConn == nil {
+			clientConn.Close()
+			return
+		}
+		clientConn = proxiedConn
+	}
+
+	serverConn, err := dialBackend(forwardAddr)
+	if err != nil {
+		proxy.logger.Printf("Failed to connect to %s: %v", forwardAddr, err)
+		proxy.rejectClient(clientConn, "§cGoMCProxy: Backend unreachable, could not connect to "+forwardAddr)
+		clientConn.Close()
+		return
 	}
+	serverConn = tuneConn(serverConn, cfg)
+
+	proxy.clientConn = clientConn
+	proxy.serverConn = serverConn
 
 	proxy.wg.Add(2)
 	go proxy.proxyTraffic(clientConn, serverConn, true)
 	go proxy.proxyTraffic(serverConn, clientConn, false)
 
 	proxy.wg.Wait()
+	proxy.saveSession()
+	proxy.unregisterSession()
+	proxy.cancelRequeue()
+	proxy.stopFlushTimer()
+	proxy.stopChatLimiter()
 	serverConn.Close()
 	clientConn.Close()
 
-	log.Println("Cleared proxy state and closed all connections")
+	proxy.logger.Println("Cleared proxy state and closed all connections")
+}
+
+const backendDialAttempts = 3
+
+// Dials the backend once, through the SSH server of -ssh-tunnel if there is one
+func dialBackendOnce(forwardAddr string) (net.Conn, error) {
+	if sshTunnel != nil {
+		return sshTunnel.dial(forwardAddr)
+	}
+	return net.DialTimeout("tcp", forwardAddr, 10*time.Second)
+}
+
+// Dials the backend with dialBackendOnce, retrying with exponential backoff since DNS or the network
+// can fail transiently
+func dialBackend(forwardAddr string) (net.Conn, error) {
+	backoff := 500 * time.Millisecond
+	var err error
+	for attempt := 1; attempt <= backendDialAttempts; attempt++ {
+		var conn net.Conn
+		conn, err = dialBackendOnce(forwardAddr)
+		if err == nil {
+			return conn, nil
+		}
+		if attempt < backendDialAttempts {
+			log.Printf("Failed to connect to %s (attempt %d/%d), retrying in %s: %v", forwardAddr, attempt, backendDialAttempts, backoff, err)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return nil, err
+}
+
+// Reads the client's handshake and answers with reason, as a Login Disconnect if the client is
+// logging in or as the server list description if it is pinging. Only usable before any packet
+// has been proxied.
+func (p *Proxy) rejectClient(clientConn net.Conn, reason string) {
+	clientConn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	threshold := p.getClientThreshold()
+	_, intent, err := readHandshake(clientConn, &threshold)
+	if err != nil {
+		return
+	}
+
+	p.rejectAfterHandshake(clientConn, intent, reason)
+}
+
+// Reads the client's handshake
+// Returns:
+// int: the protocol version
+// int: the intent
+func readHandshake(r io.Reader, threshold *int) (int, int, error) {
+	_, packetData, err := readPacket(r, threshold)
+	if err != nil {
+		return 0, 0, err
+	}
+	packetReader := bytes.NewReader(packetData)
+	packetID, _, err := readVarInt(packetReader)
+	if err != nil {
+		return 0, 0, err
+	}
+	if packetID != 0x00 {
+		return 0, 0, fmt.Errorf("Expected a handshake, got packet 0x%02X", packetID)
+	}
+
+	// Protocol version
+	protocol, _, err := readVarInt(packetReader)
+	if err != nil {
+		return 0, 0, err
+	}
+	// Server address
+	if _, err := readPrefixedBytes(packetReader); err != nil {
+		return 0, 0, err
+	}
+	// Server port
+	if _, err := io.CopyN(io.Discard, packetReader, 2); err != nil {
+		return 0, 0, err
+	}
+	// Intent
+	intent, _, err := readVarInt(packetReader)
+	if err != nil {
+		return 0, 0, err
+	}
+	return protocol, intent, nil
+}
+
+// Answers with reason after the client's handshake with intent has been read
+func (p *Proxy) rejectAfterHandshake(clientConn io.ReadWriter, intent int, reason string) {
+	switch intent {
+	case 1:
+		p.setState(StateStatus)
+	// Transfers continue like logins
+	case 2, 3:
+		p.setState(StateLogin)
+	default:
+		// There is no state the client would understand the reason in
+		return
+	}
+	if p.getState() == StateLogin {
+		// Login Start, closing with it unread would reset the connection before the client reads the reason
+		threshold := p.getClientThreshold()
+		if _, _, err := readPacket(clientConn, &threshold); err != nil {
+			return
+		}
+	}
+	if err := p.disconnectClient(clientConn, reason); err != nil {
+		p.logger.Println("Failed to send the disconnect reason to the client:", err)
+	}
+}
+
+// Tells the client why it is being disconnected in the way the current state allows
+func (p *Proxy) disconnectClient(clientConn io.ReadWriter, reason string) error {
+	switch p.getState() {
+	case StateLogin:
+		packet, err := createDisconnectPacket(0x00, reason)
+		if err != nil {
+			return err
+		}
+		p.clientWriteMutex.Lock()
+		defer p.clientWriteMutex.Unlock()
+		return writePacket(clientConn, packet, p.getClientThreshold())
+	case StatePlay:
+		packet, err := createDisconnectPacket(0x40, reason)
+		if err != nil {
+			return err
+		}
+		p.clientWriteMutex.Lock()
+		defer p.clientWriteMutex.Unlock()
+		return writePacket(clientConn, packet, p.getClientThreshold())
+	case StateStatus:
+		return p.answerStatus(clientConn, reason)
+	}
+	return nil
+}
+
+type StatusResponse struct {
+	Version struct {
+		Name     string `json:"name"`
+		Protocol int    `json:"protocol"`
+	} `json:"version"`
+	Players struct {
+		Max    int `json:"max"`
+		Online int `json:"online"`
+	} `json:"players"`
+	Description ChatMessageData `json:"description"`
+}
+
+// Answers the Status Request with description as the MOTD, then answers the Ping
+func (p *Proxy) answerStatus(clientConn io.ReadWriter, description string) error {
+	status := StatusResponse{}
+	status.Version.Name = "1.8.9"
+	status.Version.Protocol = 47
+	status.Description.Text = description
+	statusJSON, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return p.answerStatusJSON(clientConn, statusJSON)
+}
+
+// Answers the Status Request with statusJSON as the Status Response, then answers the Ping
+func (p *Proxy) answerStatusJSON(clientConn io.ReadWriter, statusJSON []byte) error {
+	threshold := p.getClientThreshold()
+	// Status Request
+	if _, _, err := readPacket(clientConn, &threshold); err != nil {
+		return err
+	}
+
+	var packetBody bytes.Buffer
+	// Packet ID
+	if err := writeVarInt(&packetBody, 0x00); err != nil {
+		return err
+	}
+	// JSON response length + JSON response
+	if err := writeVarInt(&packetBody, len(statusJSON)); err != nil {
+		return err
+	}
+	packetBody.Write(statusJSON)
+
+	if err := writePacket(clientConn, packetBody.Bytes(), threshold); err != nil {
+		return err
+	}
+
+	// Ping, the Pong is an exact copy
+	_, ping, err := readPacket(clientConn, &threshold)
+	if err != nil {
+		return err
+	}
+	return writePacket(clientConn, ping, threshold)
 }
 
 func (p *Proxy) proxyTraffic(src net.Conn, dst net.Conn, clientToServer bool) {
 	defer p.wg.Done()
+
+	// The previous packet is timed from after it was read until the next read starts
+	var handleStart time.Time
+	var handledPacketID int
 	for {
+		if !handleStart.IsZero() {
+			p.logIfSlow(handleStart, "Handling packet 0x%02X (clientToServer: %t)", handledPacketID, clientToServer)
+		}
+
 		var r io.Reader = src
 		if p.serverReader != nil && !clientToServer {
 			r = p.serverReader
 		}
 
-		packetLength, packetData, err := p.readPacket(r)
+		srcThreshold := p.getServerThreshold
+		if clientToServer {
+			srcThreshold = p.getClientThreshold
+		}
+
+		packetLength, packetData, forwarded, err := p.readPacketOrForward(r, srcThreshold, dst, clientToServer)
 		if err != nil {
-			if p.errorChecker(err) {
+			if clientToServer {
+				p.clientGone.Store(true)
+			}
+			// Anything but the connection closing means the backend sent something that isn't a packet
+			if !clientToServer && p.getState() == StateLogin && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				p.rejectBackend(dst, err)
 				return
 			}
+			p.errorChecker(err)
+			p.sideClosed(err, clientToServer)
+			return
 		}
 		if packetLength == 0 {
-			log.Println("Packet length is 0")
+			p.logger.Println("Packet length is 0")
+			continue
+		}
+		if metricsEnabled {
+			observePacketSize(clientToServer, packetLength)
+		}
+		if forwarded {
 			continue
 		}
 
 		packetReader := bytes.NewReader(packetData)
 		packetID, _, err := readVarInt(packetReader)
 		if err != nil {
-			log.Panic(err)
+			p.logger.Panic(err)
+		}
+		handleStart = time.Now()
+		handledPacketID = packetID
+
+		// The server only has packets 0x00 to 0x03 during login
+		if !clientToServer && p.getState() == StateLogin && packetID > 0x03 {
+			p.rejectBackend(dst, fmt.Errorf("Unexpected packet 0x%02X during login", packetID))
+			return
+		}
+		cfg := getConfig()
+
+		if !packetAllowed(p.getState(), clientToServer, packetID) {
+			p.logDisallowedPacket(p.getState(), clientToServer, packetID)
+			continue
+		}
+
+		// Rules from the config file go before the built-in handlers, which then see the rewritten packet
+		var drop bool
+		packetData, drop = applyRules(p.logger, p.getState(), clientToServer, packetID, packetData)
+		if drop {
+			continue
+		}
+		packetReader = bytes.NewReader(packetData)
+		if _, _, err := readVarInt(packetReader); err != nil {
+			p.logger.Panic(err)
 		}
 
 		// Handshake
-		if p.state == StateHandshaking && packetID == 0 && clientToServer {
+		if p.getState() == StateHandshaking && packetID == 0 && clientToServer {
 			// Protocol version
 			protocolVersion, _, err := readVarInt(packetReader)
 			if err != nil {
-				log.Panic(err)
-			}
-			if protocolVersion != 47 {
-				log.Panic("This proxy only supports protocol version 47 (1.8.*)")
+				p.logger.Panic(err)
 			}
 
 			// Server address
-			_, err = readPrefixedBytes(packetReader)
+			serverAddress, err := readPrefixedBytes(packetReader)
 			if err != nil {
-				log.Panic(err)
+				p.logger.Panic(err)
 			}
+			p.isForge = strings.HasSuffix(string(serverAddress), fmlMarker)
 
 			// Server port
 			_, err = io.CopyN(io.Discard, packetReader, 2)
 			if err != nil {
-				log.Panic(err)
+				p.logger.Panic(err)
 			}
 
 			// Intent
 			intent, _, err := readVarInt(packetReader)
 			if err != nil {
-				log.Panic(err)
+				p.logger.Panic(err)
+			}
+
+			if protocolVersion != 47 {
+				p.logger.Printf("Rejected a client with protocol version %d, only 47 (1.8.*) is supported", protocolVersion)
+				p.rejectAfterHandshake(src, intent, cfg.UnsupportedVersionMessage)
+				p.close()
+				return
+			}
+
+			if intent != 1 && intent != 2 {
+				p.logger.Printf("Rejected a client with unexpected intent %d", intent)
+				p.rejectAfterHandshake(src, intent, "§cGoMCProxy: Unsupported handshake intent")
+				p.close()
+				return
 			}
 
 			handshakePacket, err := p.createHandshakePacket(State(intent))
 			if err != nil {
-				log.Panic(err)
+				p.logger.Panic(err)
 			}
 
 			_, err = dst.Write(handshakePacket)
 			if err != nil {
-				if p.errorChecker(err) {
-					return
-				}
+				p.errorChecker(err)
+				return
 			}
 
 			switch intent {
 			case 1:
-				p.state = StateStatus
-				log.Println("Switched to the Status state")
+				p.setState(StateStatus)
+				p.logger.Println("Switched to the Status state")
 			case 2:
-				p.state = StateLogin
-				log.Println("Switched to the Login state")
-			default:
-				log.Panic("Unhandled intent")
-				return
+				p.setState(StateLogin)
+				p.logger.Println("Switched to the Login state")
+				if p.isForge {
+					p.logger.Println("The client is a Forge client, the FML handshake is forwarded untouched")
+				}
 			}
 			continue
 		}
 
+		// Login Start
+		if p.getState() == StateLogin && packetID == 0 && clientToServer {
+			name, err := readPrefixedBytes(packetReader)
+			if err != nil {
+				p.logger.Panic(err)
+			}
+			if !p.registerSession(string(name)) {
+				p.logger.Printf("Rejected a duplicate session for %s", name)
+				if err := p.disconnectClient(src, "§cGoMCProxy: This account is already connected through the proxy"); err != nil {
+					p.logger.Println("Failed to send the disconnect reason to the client:", err)
+				}
+				p.close()
+				return
+			}
+		}
+
 		// Login Success
-		if p.state == StateLogin && packetID == 2 && !clientToServer {
-			p.state = StatePlay
-			log.Println("Login success, switched to the Play state")
+		if p.getState() == StateLogin && packetID == 2 && !clientToServer {
+			p.setState(StatePlay)
+			p.logger.Println("Login success, switched to the Play state")
+
+			if err := p.flushCommandQueue(src); err != nil {
+				p.errorChecker(err)
+				return
+			}
 		}
 
 		// Encryption Request
-		if p.state == StateLogin && packetID == 1 && !clientToServer {
+		if p.getState() == StateLogin && packetID == 1 && !clientToServer {
+			if p.closeIfClientGone() {
+				return
+			}
+			// Started with -offline and no account
+			if p.accessToken == "" {
+				p.logger.Println("The server asked for the account but no access token has been provided")
+				if err := p.disconnectClient(dst, "§cGoMCProxy: "+p.forwardAddr+" is in online mode, start the proxy with -accesstoken and -uuid"); err != nil {
+					p.logger.Println("Failed to send the disconnect reason to the client:", err)
+				}
+				p.close()
+				return
+			}
 			encryptionResponse, err := p.handleEncryptionRequest(packetReader)
-			if err != nil {
-				log.Panic(err)
+			if errors.Is(err, NotJavaServer) {
+				p.rejectBackend(dst, err)
+				return
+			} else if err != nil {
+				p.logger.Panic(err)
+			}
+			// The client can leave while joining the server with Mojang
+			if p.closeIfClientGone() {
+				return
 			}
 
 			// Respond with an encryption response of our own, this way we never tell the client that encryption is enabled.
 			// This makes it so that we only have to deal with decrypting and encrypting from and to the server respectively
 			// while communication with the client stays unencrypted.
 			if _, err := src.Write(encryptionResponse); err != nil {
-				if p.errorChecker(err) {
-					return
+				p.logger.Println("The backend closed the connection during the encryption setup:", err)
+				if err := p.disconnectClient(dst, "§cGoMCProxy: The server closed the connection during the login"); err != nil {
+					p.logger.Println("Failed to send the disconnect reason to the client:", err)
 				}
+				p.close()
+				return
 			}
 
 			// Initialise encryption
 			block, err := aes.NewCipher(p.sharedSecret)
 			if err != nil {
-				log.Panic(err)
+				p.logger.Panic(err)
 			}
 
 			p.serverDecrypt = newCFB8Decrypter(block, p.sharedSecret)
@@ -296,196 +929,423 @@ func (p *Proxy) proxyTraffic(src net.Conn, dst net.Conn, clientToServer bool) {
 
 			p.serverReader = &cipher.StreamReader{S: p.serverDecrypt, R: src}
 			p.serverWriter = &cipher.StreamWriter{S: p.serverEncrypt, W: src}
-			log.Println("Enabled encryption")
+			p.logEncryption("Cipher: AES-%d in CFB8 mode, the shared secret is the key and the IV, client side stays unencrypted", len(p.sharedSecret)*8)
+			p.logger.Println("Enabled encryption")
 			continue
 		}
 
 		// Plugin message
-		if p.state == StatePlay && packetID == 0x3F && !clientToServer {
+		if p.getState() == StatePlay && packetID == 0x3F && !clientToServer {
 			channel, err := readPrefixedBytes(packetReader)
 			if err != nil {
-				log.Panic(err)
+				p.logger.Panic(err)
 			}
-			data, err := readPrefixedBytes(packetReader)
-			if err != nil {
-				if !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
-					log.Panic(err)
+			if isForgeChannel(string(channel)) {
+				payload, err := io.ReadAll(packetReader)
+				if err != nil {
+					p.logger.Panic(err)
+				}
+				p.logForgeMessage(string(channel), payload, clientToServer)
+			} else if string(channel) == "MC|Brand" {
+				// The payload is the rest of the packet
+				payload, err := io.ReadAll(packetReader)
+				if err != nil {
+					p.logger.Panic(err)
+				}
+				brand, err := parseBrand(payload)
+				if err != nil {
+					p.logger.Println("Failed to parse the server brand:", err)
+				}
+				// BungeeCord sends the brand again when switching servers
+				isHypixel := strings.HasPrefix(brand, "Hypixel ")
+				p.isHypixel.Store(isHypixel)
+				if isHypixel {
+					continue
 				}
 			}
-			if string(channel) == "MC|Brand" && strings.Contains(string(data), "Hypixel") {
-				p.isHypixel = true
+		}
+
+		// Serverbound plugin message, Forge's and books are logged and the client's brand is detected and replaced with -client-brand
+		if p.getState() == StatePlay && packetID == 0x17 && clientToServer {
+			channel, err := readPrefixedBytes(packetReader)
+			var payload []byte
+			if err == nil {
+				// The payload is the rest of the packet
+				payload, err = io.ReadAll(packetReader)
+			}
+			if err != nil {
+				// Forwarded as it is, it's up to the server to reject it
+				p.logger.Println("Failed to parse the serverbound Plugin Message:", err)
+			} else if p.isForge && isForgeChannel(string(channel)) {
+				p.logForgeMessage(string(channel), payload, clientToServer)
+				if string(channel) == "FML|HS" {
+					if err := p.detectForgeVersion(payload); err != nil {
+						p.logger.Println("Failed to parse the Forge mod list:", err)
+					}
+				}
+			} else if isBookChannel(string(channel)) && getConfig().LogPlayerText {
+				if err := p.logBookEdit(string(channel), payload); err != nil {
+					p.logger.Println("Failed to parse the book:", err)
+				}
+			} else if string(channel) == controlChannel {
+				if err := p.handleControlMessage(payload, src); err != nil {
+					p.errorChecker(err)
+					return
+				}
+				// Meant for the proxy only
 				continue
+			} else if string(channel) == "MC|Brand" {
+				brand, err := parseBrand(payload)
+				if err != nil {
+					p.logger.Println("Failed to parse the client brand:", err)
+				} else {
+					p.setClientBrand(brand)
+				}
+				if clientBrand := getConfig().ClientBrand; clientBrand != "" {
+					p.logger.Printf("Replacing the client brand %q with %q", brand, clientBrand)
+					packetData = createServerboundBrandPacket(clientBrand)
+				}
+			}
+		}
+
+		// Update Sign, only looked at to log the lines
+		if p.getState() == StatePlay && packetID == 0x12 && clientToServer && getConfig().LogPlayerText {
+			if err := p.logSignUpdate(packetReader); err != nil {
+				p.logger.Println("Failed to parse Update Sign:", err)
 			}
 		}
 
 		// Serverbound chat message
-		if p.state == StatePlay && packetID == 0x01 && clientToServer {
+		if p.getState() == StatePlay && packetID == 0x01 && clientToServer {
 			messageBytes, err := readPrefixedBytes(packetReader)
 			if err != nil {
-				log.Panic(err)
+				// It can't be told apart from a proxy command, so it is dropped
+				p.logger.Println("Failed to parse the chat message, dropping it:", err)
+				continue
 			}
 			message := string(messageBytes)
+			if strings.HasPrefix(message, "/") && p.cancelRequeue() {
+				if err := p.writeChatMessageToClient("§bGoMCProxy: "+p.translate("requeue.cancelled"), ChatTypeChat, src); err != nil {
+					p.errorChecker(err)
+					return
+				}
+			}
+			start := time.Now()
+			// Commands are matched exactly, anything else like /scoreboard goes to the server
+			command := ""
+			if fields := strings.Fields(message); len(fields) > 0 {
+				command = fields[0]
+			}
 			if strings.TrimSpace(message) == "/ping" {
-				go func() {
-					start := time.Now()
-					conn, err := net.DialTimeout("tcp", p.forwardAddr, 10*time.Second)
-					if err != nil {
-						_ = p.writeChatMessageToClient("§bGoMCProxy: §cAn error occurred while trying to ping", ChatTypeChat, src)
-						return
-					}
-					defer conn.Close()
+				go p.handlePing(src)
+				continue
+			} else if strings.TrimSpace(message) == "/gmcreload" {
+				reply := "§bGoMCProxy: " + p.translate("reload.done")
+				reloadErr := reloadConfig()
+				if reloadErr != nil {
+					reply = "§bGoMCProxy: " + p.translate("reload.failed", reloadErr)
+				}
+				if err := p.writeChatMessageToClient(reply, ChatTypeChat, src); err != nil {
+					p.errorChecker(err)
+					return
+				}
+				logCommand(message, start, reloadErr == nil)
+				continue
+			} else if strings.TrimSpace(message) == "/gmccache" {
+				if err := p.writeChatMessageToClient(p.services.cacheStatsMessage(), ChatTypeChat, src); err != nil {
+					p.errorChecker(err)
+					return
+				}
+				logCommand(message, start, true)
+				continue
+			} else if strings.TrimSpace(message) == "/session" {
+				if err := p.handleSession(src); err != nil {
+					p.errorChecker(err)
+					return
+				}
+				logCommand(message, start, true)
+				continue
+			} else if strings.TrimSpace(message) == "/nametags" {
+				if err := p.handleNametags(src); err != nil {
+					p.errorChecker(err)
+					return
+				}
+				logCommand(message, start, true)
+				continue
+			} else if strings.TrimSpace(message) == "/scupdate" {
+				if err := p.handleRefresh(dst, src); err != nil {
+					p.errorChecker(err)
+					return
+				}
+				logCommand(message, start, true)
+				continue
+			} else if strings.TrimSpace(message) == "/quickbuy" {
+				if err := p.handleQuickBuy(src); err != nil {
+					p.errorChecker(err)
+					return
+				}
+				logCommand(message, start, true)
+				continue
+			} else if strings.TrimSpace(message) == "/iteminfo" {
+				err = p.writeChatMessageToClient(p.heldItemInfo(), ChatTypeChat, src)
+				if err != nil {
+					p.errorChecker(err)
+					return
+				}
+				logCommand(message, start, true)
+				continue
+			} else if command == "/compare" {
+				p.runAPICommand(func() { p.handleCompare(message, src) }, src)
+				continue
+			} else if command == "/status" && strings.TrimSpace(message) != "/status" {
+				// A bare /status is Hypixel's own command
+				p.runAPICommand(func() { p.handleStatus(message, src) }, src)
+				continue
+			} else if command == "/recent" {
+				p.runAPICommand(func() { p.handleRecentGames(message, src) }, src)
+				continue
+			} else if command == "/calc" {
+				p.handleCalc(message, src)
+				continue
+			} else if strings.TrimSpace(message) == "/scnext" {
+				if err := p.writeNextPage(src); err != nil {
+					p.errorChecker(err)
+					return
+				}
+				logCommand(message, start, true)
+				continue
+			} else if command == "/scmode" {
+				messageSplit := strings.Fields(message)
+				var reply string
+				modeSet := false
+				if len(messageSplit) != 2 {
+					reply = "§bGoMCProxy StatCheck: " + p.translate("scmode.usage")
+				} else if strings.ToLower(messageSplit[1]) == "clear" {
+					p.setModeOverride(nil)
+					modeSet = true
+					reply = "§bGoMCProxy StatCheck: " + p.translate("scmode.cleared")
+				} else if bedwarsType, ok := GetBedwarsType(strings.ToLower(messageSplit[1])); ok {
+					p.setModeOverride(&bedwarsType)
+					modeSet = true
+					reply = "§bGoMCProxy StatCheck: " + p.translate("scmode.set", capitaliseFirst(string(bedwarsType)))
+				} else {
+					reply = "§bGoMCProxy StatCheck: " + p.translate("statcheck.invalid_type")
+				}
+				if err := p.writeChatMessageToClient(reply, ChatTypeChat, src); err != nil {
+					p.errorChecker(err)
+					return
+				}
+				logCommand(message, start, modeSet)
+				continue
+			} else if strings.TrimSpace(message) == "/scfav list" {
+				if err := p.writeFavoritesList(src); err != nil {
+					p.errorChecker(err)
+					return
+				}
+				logCommand(message, start, true)
+				continue
+			} else if command == "/scfav" {
+				p.runAPICommand(func() { p.handleFavorites(message, src) }, src)
+				continue
+			} else if command == "/sc" {
+				p.runAPICommand(func() { p.handleStatCheck(message, src) }, src)
+				continue
+			}
+		}
 
-					var pingReader io.Reader = conn
+		// Client Settings
+		if p.getState() == StatePlay && packetID == 0x15 && clientToServer {
+			if err := p.handleClientSettings(packetReader); err != nil {
+				p.logger.Println("Failed to parse Client Settings:", err)
+			}
+		}
 
-					handshakePacket, err := p.createHandshakePacket(StateStatus)
-					if err != nil {
-						_ = p.writeChatMessageToClient("§bGoMCProxy: §cAn error occurred while trying to ping", ChatTypeChat, src)
-						return
-					}
+		// Serverbound Held Item Change
+		if p.getState() == StatePlay && packetID == 0x09 && clientToServer {
+			var slot int16
+			if err := binary.Read(packetReader, binary.BigEndian, &slot); err == nil && slot >= 0 && slot < 9 {
+				p.inventoryMutex.Lock()
+				p.heldSlot = int(slot)
+				p.inventoryMutex.Unlock()
+			}
+		}
 
-					_, err = conn.Write(handshakePacket)
-					if err != nil {
-						log.Panic(err)
-					}
+		// Clientbound Held Item Change
+		if p.getState() == StatePlay && packetID == 0x09 && !clientToServer {
+			var slot int8
+			if err := binary.Read(packetReader, binary.BigEndian, &slot); err == nil && slot >= 0 && slot < 9 {
+				p.inventoryMutex.Lock()
+				p.heldSlot = int(slot)
+				p.inventoryMutex.Unlock()
+			}
+		}
 
-					// Ping Request (status)
-					var requestPacket bytes.Buffer
-					if err := writeVarInt(&requestPacket, 1); err != nil {
-						log.Panic(err)
-					}
-					if err := writeVarInt(&requestPacket, 0x00); err != nil {
-						log.Panic(err)
-					}
-					_, err = conn.Write(requestPacket.Bytes())
-					if err != nil {
-						log.Panic(err)
-					}
+		// Spawn Position
+		if p.getState() == StatePlay && packetID == 0x05 && !clientToServer {
+			x, _, z, err := readPosition(packetReader)
+			if err == nil {
+				navigationMutex.Lock()
+				navigation.hasSpawn = true
+				navigation.spawnX = x
+				navigation.spawnZ = z
+				navigationMutex.Unlock()
+			}
+		}
 
-					_, _, err = p.readPacket(pingReader)
-					if err != nil {
-						_ = p.writeChatMessageToClient("§bGoMCProxy: §cAn error occurred while trying to ping", ChatTypeChat, src)
-						return
-					}
+		// Set Experience
+		if p.getState() == StatePlay && packetID == 0x1F && !clientToServer {
+			if err := p.handleSetExperience(packetReader); err != nil {
+				p.logger.Println("Failed to parse Set Experience:", err)
+			}
+		}
 
-					elapsed := time.Since(start)
-					ping := elapsed.Milliseconds()
-					var colorCode string
-					if ping <= 20 {
-						colorCode = "§2"
-					} else if ping <= 50 {
-						colorCode = "§a"
-					} else if ping <= 100 {
-						colorCode = "§e"
-					} else if ping <= 150 {
-						colorCode = "§6"
-					} else {
-						colorCode = "§c"
-					}
-					err = p.writeChatMessageToClient(fmt.Sprintf("§bGoMCProxy: §rPong! %s%d ms", colorCode, elapsed.Milliseconds()), ChatTypeChat, src)
-					if err != nil {
-						if p.errorChecker(err) {
-							return
-						}
-					}
-				}()
-				continue
-			} else if strings.HasPrefix(message, "/sc") && p.isHypixel {
-				go func() {
-					if hypixel == nil {
-						err = p.writeChatMessageToClient("§bGoMCProxy StatCheck: §cHypixel API features have been disabled", ChatTypeChat, src)
-						if err != nil {
-							log.Panic(err)
-						}
-						return
-					}
-					messageSplit := strings.Split(message, " ")
-					if len(messageSplit) != 2 && len(messageSplit) != 3 {
-						err = p.writeChatMessageToClient("§bGoMCProxy StatCheck: §cInvalid amount of arguments", ChatTypeChat, src)
-						if err != nil {
-							log.Panic(err)
-						}
-						return
-					}
+		// Clientbound Player Position And Look
+		if p.getState() == StatePlay && packetID == 0x08 && !clientToServer {
+			var position struct {
+				X, Y, Z    float64
+				Yaw, Pitch float32
+				Flags      byte
+			}
+			if err := binary.Read(packetReader, binary.BigEndian, &position); err == nil {
+				navigationMutex.Lock()
+				// Flags mark fields that are relative to the current value
+				if position.Flags&0x01 != 0 {
+					position.X += navigation.x
+				}
+				if position.Flags&0x04 != 0 {
+					position.Z += navigation.z
+				}
+				if position.Flags&0x08 != 0 {
+					position.Yaw += navigation.yaw
+				}
+				navigation.hasPlayer = true
+				navigation.x = position.X
+				navigation.z = position.Z
+				navigation.yaw = position.Yaw
+				navigationMutex.Unlock()
+			}
+		}
 
-					var bedwarsType BedwarsType
-					var playerNameIndex int
-					if len(messageSplit) == 3 {
-						var ok bool
-						bedwarsType, ok = GetBedwarsType(strings.ToLower(messageSplit[1]))
-						if !ok {
-							err = p.writeChatMessageToClient("§bGoMCProxy StatCheck: §cInvalid bedwars type", ChatTypeChat, src)
-							if err != nil {
-								if p.errorChecker(err) {
-									return
-								}
-							}
-							return
-						}
-						playerNameIndex = 2
-					} else {
-						if p.bedwarsType != nil {
-							bedwarsType = *p.bedwarsType
-						} else {
-							err = p.writeChatMessageToClient("§bGoMCProxy StatCheck: §cInvalid amount of arguments", ChatTypeChat, src)
-							if err != nil {
-								log.Panic(err)
-							}
-							return
-						}
-						playerNameIndex = 1
-					}
+		// Player Position, Player Look and Player Position And Look
+		if p.getState() == StatePlay && (packetID == 0x04 || packetID == 0x05 || packetID == 0x06) && clientToServer {
+			p.handlePlayerMovement(packetID, packetReader)
+		}
 
-					apiProfile, err := getPlayerProfile(messageSplit[playerNameIndex])
-					if err != nil {
-						err = p.writeChatMessageToClient("§bGoMCProxy StatCheck: §cInvalid player", ChatTypeChat, src)
-						if err != nil {
-							if p.errorChecker(err) {
-								return
-							}
-						}
-						return
-					}
-					playerName := apiProfile.Name
-					playerUuid := apiProfile.Id
+		// Join Game and Respawn, the client unloads every chunk and entity and closes its window
+		// without a Close Window
+		if p.getState() == StatePlay && (packetID == 0x01 || packetID == 0x07) && !clientToServer {
+			clear(p.beds)
+			p.nametagsMutex.Lock()
+			clear(p.nametags)
+			p.nametagsMutex.Unlock()
+			p.forgetShopWindow()
+		}
 
-					bedwarsStats, err := hypixel.getBedwarsStats(playerUuid, bedwarsType)
-					if err != nil {
-						err = p.writeChatMessageToClient("§bGoMCProxy StatCheck: §cAn error occurred while fetching the bedwars stats", ChatTypeChat, src)
-						if err != nil {
-							if p.errorChecker(err) {
-								return
-							}
-						}
-						return
-					}
+		// Join Game, teams belong to the scoreboard of the world which is only replaced by Join Game
+		// and Respawn into another dimension. BungeeCord removes the old server's teams itself.
+		if p.getState() == StatePlay && packetID == 0x01 && !clientToServer {
+			p.teamsMutex.Lock()
+			clear(p.teams)
+			clear(p.playerTeams)
+			p.teamsMutex.Unlock()
+		}
 
-					statsMessage := fmt.Sprintf("§bGoMCProxy StatCheck:\n"+
-						"§l§e%s §6Bedwars Stats for §b§l[%d✫] %s§r\n"+
-						"§aKills: §f%d, §cDeaths: §f%d, §aK§f/§cD: §f%.2f\n"+
-						"§5Final §2Kills: §f%d, §5Final §4Deaths: §f%d, §5Final §2K§f/§4D: §f%.2f\n"+
-						"§aWins: §f%d, §cLosses: §f%d, §aW§f/§cL: §f%.2f\n"+
-						"§bWinstreak: §f%d, §3Beds Broken: §f%d",
-						capitaliseFirst(string(bedwarsType)), bedwarsStats.Stars, playerName, bedwarsStats.Kills, bedwarsStats.Deaths, bedwarsStats.KD,
-						bedwarsStats.FinalKills, bedwarsStats.FinalDeaths, bedwarsStats.FinalKD,
-						bedwarsStats.Wins, bedwarsStats.Losses, bedwarsStats.WL,
-						bedwarsStats.Winstreak, bedwarsStats.BedsBroken)
-
-					err = p.writeChatMessageToClient(statsMessage, ChatTypeChat, src)
-					if err != nil {
-						if p.errorChecker(err) {
-							return
-						}
-					}
-				}()
-				continue
+		// Teams
+		if p.getState() == StatePlay && packetID == 0x3E && !clientToServer {
+			if err := p.handleTeams(packetReader); err != nil {
+				p.logger.Println("Failed to parse Teams:", err)
+			}
+		}
+
+		// Entity Metadata
+		if p.getState() == StatePlay && packetID == 0x1C && !clientToServer {
+			if err := p.handleEntityMetadata(packetReader); err != nil {
+				p.logger.Println("Failed to parse Entity Metadata:", err)
+			}
+		}
+
+		// Destroy Entities
+		if p.getState() == StatePlay && packetID == 0x13 && !clientToServer {
+			if err := p.handleDestroyEntities(packetReader); err != nil {
+				p.logger.Println("Failed to parse Destroy Entities:", err)
+			}
+		}
+
+		// Chunk Data
+		if p.getState() == StatePlay && packetID == 0x21 && !clientToServer && cfg.BedAlerts {
+			if err := p.handleChunkData(packetReader); err != nil {
+				p.logger.Println("Failed to parse Chunk Data:", err)
+			}
+		}
+
+		// Map Chunk Bulk
+		if p.getState() == StatePlay && packetID == 0x26 && !clientToServer && cfg.BedAlerts {
+			if err := p.handleMapChunkBulk(packetReader); err != nil {
+				p.logger.Println("Failed to parse Map Chunk Bulk:", err)
+			}
+		}
+
+		// Block Change and Multi Block Change
+		if p.getState() == StatePlay && (packetID == 0x22 || packetID == 0x23) && !clientToServer && cfg.BedAlerts {
+			var destroyed []BlockPosition
+			if packetID == 0x23 {
+				destroyed, err = p.handleBlockChange(packetReader)
+			} else {
+				destroyed, err = p.handleMultiBlockChange(packetReader)
+			}
+			if err != nil {
+				p.logger.Println("Failed to parse block change:", err)
+			}
+			for _, bed := range destroyed {
+				p.logger.Printf("Bed destroyed at %d, %d, %d", bed.X, bed.Y, bed.Z)
+				err = p.writeChatMessageToClient("§bGoMCProxy: "+p.translate("bed.destroyed", bed.X, bed.Y, bed.Z), ChatTypeChat, dst)
+				if err != nil {
+					p.errorChecker(err)
+					return
+				}
+			}
+		}
+
+		// Set Slot
+		if p.getState() == StatePlay && packetID == 0x2F && !clientToServer {
+			if err := p.handleSetSlot(packetReader); err != nil {
+				p.logger.Println("Failed to parse Set Slot:", err)
+			}
+		}
+
+		// Window Items
+		if p.getState() == StatePlay && packetID == 0x30 && !clientToServer {
+			if err := p.handleWindowItems(packetReader); err != nil {
+				p.logger.Println("Failed to parse Window Items:", err)
+			}
+		}
+
+		// Open Window
+		if p.getState() == StatePlay && packetID == 0x2D && !clientToServer {
+			if err := p.handleOpenWindow(packetReader); err != nil {
+				p.logger.Println("Failed to parse Open Window:", err)
+			}
+		}
+
+		// Close Window, sent by either side
+		if p.getState() == StatePlay && ((packetID == 0x2E && !clientToServer) || (packetID == 0x0D && clientToServer)) {
+			if err := p.handleCloseWindow(packetReader); err != nil {
+				p.logger.Println("Failed to parse Close Window:", err)
+			}
+		}
+
+		// Confirm Transaction, sent by either side
+		if p.getState() == StatePlay && ((packetID == 0x32 && !clientToServer) || (packetID == 0x0F && clientToServer)) {
+			if err := p.handleConfirmTransaction(packetReader); err != nil {
+				p.logger.Println("Failed to parse Confirm Transaction:", err)
 			}
 		}
 
 		// Clientbound server message
-		if p.state == StatePlay && packetID == 0x02 && !clientToServer && p.isHypixel {
+		if p.getState() == StatePlay && packetID == 0x02 && !clientToServer && p.isHypixel.Load() {
 			messageBytes, err := readPrefixedBytes(packetReader)
 			if err != nil {
-				log.Panic(err)
+				p.logger.Panic(err)
 			}
 			message := string(messageBytes)
 
@@ -496,7 +1356,7 @@ func (p *Proxy) proxyTraffic(src net.Conn, dst net.Conn, clientToServer bool) {
 					chatMessage := ChatMessageData{}
 					err = json.Unmarshal([]byte(message), &chatMessage)
 					if err != nil {
-						log.Panic(err)
+						p.logger.Panic(err)
 					}
 
 					locraw := Locraw{}
@@ -506,15 +1366,51 @@ func (p *Proxy) proxyTraffic(src net.Conn, dst net.Conn, clientToServer bool) {
 					}
 
 					if locraw.GameType == "BEDWARS" && locraw.Mode != "" {
-						bedwarsType, ok := GetBedwarsType(locraw.Mode)
+						bedwarsType, ok := GetLocrawBedwarsType(locraw.Mode)
+						p.commandMutex.Lock()
 						if ok {
 							p.bedwarsType = &bedwarsType
 						}
+						p.locrawMode = locraw.Mode
+						p.commandMutex.Unlock()
+						if ok {
+							p.startSessionMode(bedwarsType, locraw.Server)
+						}
+						gameMutex.Lock()
+						game = gameData{true, locraw.Map, locraw.Server}
+						gameMutex.Unlock()
+						enterOverlayGame(locraw.Server)
 					} else {
+						p.commandMutex.Lock()
 						p.bedwarsType = nil
+						p.locrawMode = ""
+						p.commandMutex.Unlock()
+						gameMutex.Lock()
+						game = gameData{}
+						gameMutex.Unlock()
+					}
+					if err := p.finishRefresh(dst); err != nil {
+						p.errorChecker(err)
+						return
 					}
 					continue
 				} else {
+					messageText := chatComponentText(message)
+					p.startAutoCheck(messageText, dst)
+					p.detectHighlights(messageText)
+					if err := p.handlePartyMessage(messageText, src, dst); err != nil {
+						p.errorChecker(err)
+						return
+					}
+					// The summary's lines matter, chatComponentText joins them
+					summaryText := chatMessage.Text
+					for _, e := range chatMessage.Extra {
+						summaryText += e.Text
+					}
+					if err := p.detectGameSummary(summaryText, dst); err != nil {
+						p.errorChecker(err)
+						return
+					}
 					go func() {
 						textSlice := make([]string, 0, len(chatMessage.Extra))
 						for _, e := range chatMessage.Extra {
@@ -552,126 +1448,893 @@ func (p *Proxy) proxyTraffic(src net.Conn, dst net.Conn, clientToServer bool) {
 			}
 		}
 
+		// Disconnect
+		if p.getState() == StatePlay && packetID == 0x40 && !clientToServer {
+			if err := p.handleServerDisconnect(packetReader); err != nil {
+				p.logger.Println("Failed to parse Disconnect:", err)
+			}
+		}
+
+		// Title
+		if p.getState() == StatePlay && packetID == 0x45 && !clientToServer && p.isHypixel.Load() {
+			if titleText, err := readTitle(packetReader); err != nil {
+				p.logger.Println("Failed to parse Title:", err)
+			} else if err := p.handleTitle(titleText, dst); err != nil {
+				p.errorChecker(err)
+				return
+			}
+		}
+
 		// Respawn
-		if p.state == StatePlay && packetID == 0x07 && !clientToServer && p.isHypixel {
-			clear(upgrades)
-			clear(traps)
+		if p.getState() == StatePlay && packetID == 0x07 && !clientToServer && p.isHypixel.Load() {
+			// Without /locraw a new game can't be told apart from the same one, see resume.go
+			if cfg.NoAutoLocraw {
+				clearOverlayGame()
+			}
 
 			dimension := make([]byte, 4)
 			_, err := io.ReadFull(packetReader, dimension)
 			if err != nil {
-				log.Panic(err)
+				p.logger.Panic(err)
 			}
 
-			if int32(binary.BigEndian.Uint32(dimension)) == -1 {
-				var packetBody bytes.Buffer
-
-				// Packet ID
-				if err := writeVarInt(&packetBody, 0x01); err != nil {
-					log.Panic(err)
+			// With -no-auto-locraw the mode is only updated by /scupdate or the player's own /locraw
+			if int32(binary.BigEndian.Uint32(dimension)) == -1 && !cfg.NoAutoLocraw {
+				if err := p.injectServerbound(createServerboundChatPacket("/locraw"), src); err != nil {
+					p.errorChecker(err)
+					return
 				}
+			}
+		}
+
+		// Set Compression, in Play it is only sent by some setups like BungeeCord when switching servers
+		if ((p.getState() == StateLogin && packetID == 0x03) || (p.getState() == StatePlay && packetID == 0x46)) && !clientToServer {
+			rawThreshold, _, err := readVarInt(packetReader)
+			if err != nil {
+				p.logger.Println("Failed to read the compression threshold:", err)
+				p.close()
+				return
+			}
+			// Signed, a negative threshold disables compression
+			threshold := int(int32(uint32(rawThreshold)))
+			if threshold < 0 {
+				threshold = -1
+			}
+			if err := p.setCompression(packetID, threshold, dst); err != nil {
+				p.errorChecker(err)
+				return
+			}
+			continue
+		}
+
+		// Looked up after handling since the other direction can change it while this one was blocked reading
+		dstThreshold := p.getClientThreshold()
+		if clientToServer {
+			dstThreshold = p.getServerThreshold()
+		}
+
+		reconstructedPacket, err := reconstructPacket(packetData, dstThreshold)
+		if err != nil {
+			p.logger.Panic(err)
+		}
+
+		err = p.writeToDst(reconstructedPacket, dst, clientToServer)
+		if err != nil {
+			p.errorChecker(err)
+			p.sideClosed(err, !clientToServer)
+			return
+		}
+	}
+}
+
+// Applies the server's compression threshold and forwards it to the client, or the threshold from
+// -compression-threshold instead when that is set. The packet itself is still framed with the client's
+// old threshold, the new one applies from the next packet on
+func (p *Proxy) setCompression(packetID int, threshold int, clientConn io.Writer) error {
+	p.setServerThreshold(threshold)
+
+	clientThreshold := threshold
+	if override := getConfig().ClientCompressionThreshold; override != nil {
+		clientThreshold = *override
+		// Nothing changes for the client
+		if clientThreshold == p.getClientThreshold() {
+			return nil
+		}
+	}
+
+	var packetBody bytes.Buffer
+	if err := writeVarInt(&packetBody, packetID); err != nil {
+		return err
+	}
+	if err := writeVarInt(&packetBody, clientThreshold); err != nil {
+		return err
+	}
+
+	reconstructedPacket, err := reconstructPacket(packetBody.Bytes(), p.getClientThreshold())
+	if err != nil {
+		return err
+	}
+	// Injected packets are framed with the new threshold from here on, so it is set before anything
+	// else can be written
+	mutex := p.writeMutex(false)
+	mutex.Lock()
+	err = p.writeToDstLocked(reconstructedPacket, clientConn, false)
+	if err == nil {
+		p.setClientThreshold(clientThreshold)
+	}
+	mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return p.drainInjected(clientConn, false)
+}
+
+// Registers this session under username, handling an existing session according to config.DuplicateSessions
+// Returns:
+// bool: false if this session has been rejected
+func (p *Proxy) registerSession(username string) bool {
+	key := strings.ToLower(username)
+
+	sessionsMutex.Lock()
+	existing, ok := sessions[key]
+	if ok && getConfig().DuplicateSessions == "reject" {
+		sessionsMutex.Unlock()
+		return false
+	}
+	p.username = username
+	sessions[key] = p
+	sessionsMutex.Unlock()
+	p.logger.SetPrefix(fmt.Sprintf("[%s %s] ", username, p.clientConn.RemoteAddr()))
+
+	if ok {
+		p.logger.Printf("Replacing the existing session for %s", username)
+		if err := existing.disconnectClient(existing.clientConn, "§cGoMCProxy: Logged in from another location"); err != nil {
+			p.logger.Println("Failed to send the disconnect reason to the client:", err)
+		}
+		existing.close()
+		p.resumeSession(existing)
+	} else {
+		p.resumeSession(nil)
+	}
+	return true
+}
+
+func (p *Proxy) unregisterSession() {
+	if p.username == "" {
+		return
+	}
+	key := strings.ToLower(p.username)
+
+	sessionsMutex.Lock()
+	if sessions[key] == p {
+		delete(sessions, key)
+	}
+	sessionsMutex.Unlock()
+}
+
+var NotJavaServer = errors.New("Backend does not appear to be a Java Edition 1.8 server")
+
+// Tells the client that the backend answered the login with something a 1.8 Java Edition server wouldn't
+// send, which happens when the forward address points at another edition or another kind of service
+func (p *Proxy) rejectBackend(clientConn io.ReadWriter, err error) {
+	if !errors.Is(err, NotJavaServer) {
+		err = fmt.Errorf("%w: %w", NotJavaServer, err)
+	}
+	p.logger.Printf("%s: %v", p.forwardAddr, err)
+	reason := "§cGoMCProxy: " + p.forwardAddr + " does not appear to be a Java Edition 1.8 server, check the forward address"
+	if err := p.disconnectClient(clientConn, reason); err != nil {
+		p.logger.Println("Failed to send the disconnect reason to the client:", err)
+	}
+	p.close()
+}
+
+// Closes the backend connection if the client disconnected, for steps of the login that would
+// otherwise carry on without it
+// Returns:
+// bool: true if the client is gone
+func (p *Proxy) closeIfClientGone() bool {
+	if !p.clientGone.Load() {
+		return false
+	}
+	p.logger.Println("The client disconnected during the login, closing the backend connection")
+	p.close()
+	return true
+}
+
+func (p *Proxy) getState() State {
+	return State(p.state.Load())
+}
+
+func (p *Proxy) setState(state State) {
+	p.state.Store(int32(state))
+}
+
+func (p *Proxy) getServerThreshold() int {
+	return int(p.serverThreshold.Load())
+}
+
+func (p *Proxy) setServerThreshold(threshold int) {
+	p.serverThreshold.Store(int32(threshold))
+}
+
+func (p *Proxy) getClientThreshold() int {
+	return int(p.clientThreshold.Load())
+}
+
+func (p *Proxy) setClientThreshold(threshold int) {
+	p.clientThreshold.Store(int32(threshold))
+}
+
+// Closes both connections, which ends both proxyTraffic goroutines
+func (p *Proxy) close() {
+	p.clientConn.Close()
+	p.serverConn.Close()
+}
+
+// Logs which side ended the connection with err and closes the other one, so the other proxyTraffic
+// goroutine doesn't wait for it. Only the first side is logged, connections the proxy closed itself
+// aren't.
+func (p *Proxy) sideClosed(err error, clientSide bool) {
+	if errors.Is(err, net.ErrClosed) {
+		return
+	}
+	p.closeOnce.Do(func() {
+		if clientSide {
+			p.logger.Println("The client disconnected")
+			p.close()
+			return
+		}
+
+		p.logger.Println("The server closed the connection")
+		p.commandMutex.Lock()
+		kicked := p.disconnectReason != ""
+		p.commandMutex.Unlock()
+		// A kick already told the client why
+		reason := getConfig().BackendLostMessage
+		if (p.getState() == StateLogin || p.getState() == StatePlay) && !kicked && reason != "" {
+			if err := p.disconnectClient(p.clientConn, reason); err != nil {
+				p.logger.Println("Failed to send the disconnect reason to the client:", err)
+			}
+		}
+		p.close()
+	})
+}
+
+var LookupInProgress = errors.New("A lookup is in progress")
+var TooManyLookups = errors.New("Too many lookups are in progress")
+
+// Runs command on the API worker pool, returns LookupInProgress if this connection already has
+// config.MaxLookups commands in flight or TooManyLookups if the pool is too busy
+func (p *Proxy) submitAPICommand(command func()) error {
+	select {
+	case p.lookupSlots <- struct{}{}:
+	default:
+		return LookupInProgress
+	}
+
+	submitted := apiWorkers.submit(func() {
+		defer func() { <-p.lookupSlots }()
+		command()
+	})
+	if !submitted {
+		<-p.lookupSlots
+		return TooManyLookups
+	}
+	return nil
+}
+
+// Runs command on the API worker pool like submitAPICommand, telling the client if it couldn't
+func (p *Proxy) runAPICommand(command func(), w io.Writer) {
+	var message string
+	switch err := p.submitAPICommand(command); err {
+	case nil:
+		return
+	case LookupInProgress:
+		message = "§bGoMCProxy: " + p.translate("lookup.in_progress")
+	default:
+		message = "§bGoMCProxy: " + p.translate("lookup.too_many")
+	}
+	if err := p.writeChatMessageToClient(message, ChatTypeChat, w); err != nil {
+		p.errorChecker(err)
+	}
+}
+
+// Logs the handler described by format as slow if it has been running for config.SlowHandlerThreshold
+func (p *Proxy) logIfSlow(start time.Time, format string, args ...any) {
+	threshold := getConfig().SlowHandlerThreshold
+	if threshold <= 0 {
+		return
+	}
+	if elapsed := time.Since(start); elapsed >= threshold {
+		p.logger.Printf("Slow handler: %s took %s", fmt.Sprintf(format, args...), elapsed)
+	}
+}
+
+// Logs a step of the encryption negotiation with -debug-encryption. Never pass the shared secret,
+// anything derived from it or the access token.
+func (p *Proxy) logEncryption(format string, args ...any) {
+	if getConfig().DebugEncryption {
+		p.logger.Printf("[encryption] "+format, args...)
+	}
+}
+
+// Handles an error of writing to or reading from a connection, after which the caller should stop
+// using it. It is also called from timers and API workers, so errors other than the connection ending
+// are logged and close the connection instead of panicking.
+func (p *Proxy) errorChecker(err error) {
+	var netErr net.Error
+	if errors.Is(err, io.EOF) || errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, net.ErrClosed) {
+		return
+	}
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return
+	}
+	p.logger.Println("Closing the connection after an error:", err)
+	p.close()
+}
+
+func (p *Proxy) createHandshakePacket(intent State) ([]byte, error) {
+	// Handshake
+	var reconstructedPacket bytes.Buffer
+	var packetBody bytes.Buffer
+
+	// Packet ID
+	if err := writeVarInt(&packetBody, 0x00); err != nil {
+		return nil, err
+	}
+
+	// Protocol version
+	if err := writeVarInt(&packetBody, 47); err != nil {
+		return nil, err
+	}
+
+	forwardAddrSplit := strings.Split(p.forwardAddr, ":")
+	if len(forwardAddrSplit) != 2 {
+		p.logger.Panic(errors.New("Invalid forward addr"))
+	}
+	serverAddress := forwardAddrSplit[0]
+	if p.isForge {
+		serverAddress += fmlMarker
+	}
+	serverPortString := forwardAddrSplit[1]
+	serverPortUint16, err := strconv.ParseUint(serverPortString, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+	serverPort := make([]byte, 2)
+	binary.BigEndian.PutUint16(serverPort, uint16(serverPortUint16))
+
+	// Server address length + Server address
+	if err := writeVarInt(&packetBody, len(serverAddress)); err != nil {
+		return nil, err
+	}
+	packetBody.Write([]byte(serverAddress))
+
+	// Server Port
+	packetBody.Write(serverPort)
+
+	// Intent
+	if err := writeVarInt(&packetBody, int(intent)); err != nil {
+		return nil, err
+	}
+
+	// Turn into a full packet
+	if err := writeVarInt(&reconstructedPacket, packetBody.Len()); err != nil {
+		return nil, err
+	}
+	reconstructedPacket.Write(packetBody.Bytes())
+	return reconstructedPacket.Bytes(), nil
+}
+
+// Handles /ping by timing a status request to the backend
+func (p *Proxy) handlePing(w io.Writer) {
+	start := time.Now()
+	defer p.logIfSlow(start, "/ping")
+
+	writeMessage := func(text string) {
+		if err := p.writeChatMessageToClient("§bGoMCProxy: "+text, ChatTypeChat, w); err != nil {
+			p.errorChecker(err)
+		}
+	}
+
+	if _, err := p.fetchBackendStatus(); err != nil {
+		logCommand("/ping", start, false)
+		writeMessage(p.translate("ping.failed"))
+		return
+	}
+
+	elapsed := time.Since(start)
+	ping := elapsed.Milliseconds()
+	var colorCode string
+	if ping <= 20 {
+		colorCode = "§2"
+	} else if ping <= 50 {
+		colorCode = "§a"
+	} else if ping <= 100 {
+		colorCode = "§e"
+	} else if ping <= 150 {
+		colorCode = "§6"
+	} else {
+		colorCode = "§c"
+	}
+	logCommand("/ping", start, true)
+	writeMessage(p.translate("ping.pong", colorCode, ping))
+}
+
+// Returns the mode set with /scmode, or else the mode of the current game
+func (p *Proxy) currentBedwarsType() (BedwarsType, bool) {
+	p.commandMutex.Lock()
+	defer p.commandMutex.Unlock()
+
+	if p.modeOverride != nil {
+		return *p.modeOverride, true
+	} else if p.bedwarsType != nil {
+		return *p.bedwarsType, true
+	}
+	return "", false
+}
+
+// Sets the mode /sc uses over the detected one, nil goes back to the detected one
+func (p *Proxy) setModeOverride(bedwarsType *BedwarsType) {
+	p.commandMutex.Lock()
+	p.modeOverride = bedwarsType
+	p.commandMutex.Unlock()
+}
+
+// Handles /sc [mode] <player>
+func (p *Proxy) handleStatCheck(message string, w io.Writer) {
+	start := time.Now()
+	defer p.logIfSlow(start, "/sc")
+	succeeded := false
+	defer func() { logCommand(message, start, succeeded) }()
+
+	writeMessage := func(text string) {
+		if err := p.writeChatMessageToClient("§bGoMCProxy StatCheck: "+text, ChatTypeChat, w); err != nil {
+			p.errorChecker(err)
+		}
+	}
+
+	if p.services.hypixel == nil {
+		writeMessage(p.translate("error.api_disabled"))
+		return
+	}
+	messageSplit := strings.Split(message, " ")
+	// Like "fav" below these shadow players with the same name
+	if len(messageSplit) >= 2 {
+		switch strings.ToLower(messageSplit[1]) {
+		case "snap":
+			succeeded = p.handleSnapshot(messageSplit[2:], w)
+			return
+		case "diff":
+			succeeded = p.handleSnapshotDiff(messageSplit[2:], w)
+			return
+		}
+	}
+
+	if len(messageSplit) != 2 && len(messageSplit) != 3 {
+		writeMessage(p.translate("statcheck.invalid_arguments"))
+		return
+	}
+
+	var bedwarsType BedwarsType
+	var playerNameIndex int
+	if len(messageSplit) == 3 {
+		var ok bool
+		bedwarsType, ok = GetBedwarsType(strings.ToLower(messageSplit[1]))
+		if !ok {
+			writeMessage(p.translate("statcheck.invalid_type"))
+			return
+		}
+		playerNameIndex = 2
+	} else {
+		var ok bool
+		bedwarsType, ok = p.currentBedwarsType()
+		if !ok {
+			writeMessage(p.translate("statcheck.invalid_arguments"))
+			return
+		}
+		playerNameIndex = 1
+	}
+
+	// Shadows a player named "fav", they can still be checked by UUID
+	if strings.EqualFold(messageSplit[playerNameIndex], "fav") {
+		succeeded = p.statCheckFavorites(bedwarsType, w)
+		return
+	}
+
+	playerUuid, playerName, err := p.services.resolvePlayer(messageSplit[playerNameIndex])
+	if err != nil {
+		writeMessage(p.translate(playerProfileErrorKey(err)))
+		return
+	}
+
+	bedwarsStats, err := p.services.hypixel.getBedwarsStats(playerUuid, bedwarsType)
+	if err != nil {
+		writeMessage(p.translate(hypixelErrorKey(err)))
+		return
+	}
+	if playerName == "" {
+		playerName = bedwarsStats.DisplayName
+	}
+
+	statsMessage := "§bGoMCProxy StatCheck:\n" + p.formatBedwarsStats(bedwarsType, playerName, bedwarsStats)
+
+	succeeded = true
+	if err := p.writePagedMessage(statsMessage, w); err != nil {
+		p.errorChecker(err)
+	}
+}
+
+// Handles /compare <mode> <player1> <player2>
+func (p *Proxy) handleCompare(message string, w io.Writer) {
+	start := time.Now()
+	defer p.logIfSlow(start, "/compare")
+	succeeded := false
+	defer func() { logCommand(message, start, succeeded) }()
+
+	writeMessage := func(text string) {
+		if err := p.writeChatMessageToClient("§bGoMCProxy Compare: "+text, ChatTypeChat, w); err != nil {
+			p.errorChecker(err)
+		}
+	}
+
+	if p.services.hypixel == nil {
+		writeMessage(p.translate("error.api_disabled"))
+		return
+	}
+	messageSplit := strings.Fields(message)
+	if len(messageSplit) != 4 {
+		writeMessage(p.translate("compare.usage"))
+		return
+	}
+	bedwarsType, ok := GetBedwarsType(strings.ToLower(messageSplit[1]))
+	if !ok {
+		writeMessage(p.translate("statcheck.invalid_type"))
+		return
+	}
+
+	names := messageSplit[2:]
+	var stats [2]*BedwarsStats
+	var invalid []string
+	for i, name := range names {
+		apiProfile, err := p.services.getPlayerProfile(name)
+		if errors.Is(err, InvalidPlayer) || errors.Is(err, InvalidPlayerName) {
+			invalid = append(invalid, name)
+			continue
+		} else if err != nil {
+			writeMessage(p.translate(playerProfileErrorKey(err)))
+			return
+		}
+		names[i] = apiProfile.Name
+
+		stats[i], err = p.services.hypixel.getBedwarsStats(apiProfile.Id, bedwarsType)
+		if err != nil {
+			writeMessage(p.translate(hypixelErrorKey(err)))
+			return
+		}
+	}
+	if len(invalid) == 1 {
+		writeMessage(p.translate("compare.invalid_player", invalid[0]))
+		return
+	} else if len(invalid) == 2 {
+		writeMessage(p.translate("compare.invalid_players", strings.Join(invalid, ", ")))
+		return
+	}
+
+	a, b := stats[0], stats[1]
+	rows := []string{
+		formatComparisonRow("", names[0], names[1], 0, 0),
+		formatComparisonRow(p.translate("compare.stars"), fmt.Sprintf("%d✫", a.Stars), fmt.Sprintf("%d✫", b.Stars), float64(a.Stars), float64(b.Stars)),
+		formatComparisonRow(p.translate("compare.fkdr"), fmt.Sprintf("%.2f", a.FinalKD), fmt.Sprintf("%.2f", b.FinalKD), float64(a.FinalKD), float64(b.FinalKD)),
+		formatComparisonRow(p.translate("compare.wlr"), fmt.Sprintf("%.2f", a.WL), fmt.Sprintf("%.2f", b.WL), float64(a.WL), float64(b.WL)),
+		formatComparisonRow(p.translate("compare.winstreak"), strconv.Itoa(a.Winstreak), strconv.Itoa(b.Winstreak), float64(a.Winstreak), float64(b.Winstreak)),
+	}
+	succeeded = true
+	err := p.writePagedMessage("§bGoMCProxy Compare: "+p.translate("compare.header", capitaliseFirst(string(bedwarsType)))+"\n"+strings.Join(rows, "\n"), w)
+	if err != nil {
+		p.errorChecker(err)
+	}
+}
+
+// Handles /status <player> by showing whether the player is online and what they are playing
+func (p *Proxy) handleStatus(message string, w io.Writer) {
+	start := time.Now()
+	defer p.logIfSlow(start, "/status")
+	succeeded := false
+	defer func() { logCommand(message, start, succeeded) }()
+
+	writeMessage := func(text string) {
+		if err := p.writeChatMessageToClient("§bGoMCProxy Status: "+text, ChatTypeChat, w); err != nil {
+			p.errorChecker(err)
+		}
+	}
+
+	if p.services.hypixel == nil {
+		writeMessage(p.translate("error.api_disabled"))
+		return
+	}
+	messageSplit := strings.Fields(message)
+	if len(messageSplit) != 2 {
+		writeMessage(p.translate("status.usage"))
+		return
+	}
+
+	playerUuid, playerName, err := p.services.resolvePlayer(messageSplit[1])
+	if err != nil {
+		writeMessage(p.translate(playerProfileErrorKey(err)))
+		return
+	}
+	if playerName == "" {
+		playerName = messageSplit[1]
+	}
+
+	status, err := p.services.hypixel.getStatus(playerUuid)
+	if err != nil {
+		writeMessage(p.translate(hypixelErrorKey(err)))
+		return
+	}
+
+	session := status.Session
+	if session.Online {
+		reply := p.translate("status.online", playerName, formatGame(session.GameType, session.Mode, session.Map))
+		succeeded = true
+		writeMessage(reply)
+		return
+	}
+
+	// An offline status can't be told apart from a hidden one, the player data can
+	playerStats, err := p.services.hypixel.getPlayerStats(playerUuid)
+	if err != nil {
+		writeMessage(p.translate(hypixelErrorKey(err)))
+		return
+	}
+	succeeded = true
+	if playerStats.Player.LastLogin == 0 {
+		writeMessage(p.translate("status.hidden", playerName))
+	} else {
+		writeMessage(p.translate("status.offline", playerName))
+	}
+}
+
+// Formats a game from the status or recent games API, e.g. "§6Bedwars §7(Doubles, Lighthouse)"
+func formatGame(gameType string, mode string, mapName string) string {
+	modeName := capitaliseFirst(strings.ReplaceAll(strings.ToLower(mode), "_", " "))
+	if bedwarsType, ok := GetLocrawBedwarsType(mode); ok && gameType == "BEDWARS" {
+		modeName = capitaliseFirst(string(bedwarsType))
+	}
+	details := []string{}
+	for _, detail := range []string{modeName, mapName} {
+		if detail != "" {
+			details = append(details, detail)
+		}
+	}
+
+	game := "§6" + capitaliseFirst(strings.ReplaceAll(strings.ToLower(gameType), "_", " "))
+	if len(details) > 0 {
+		game += " §7(" + strings.Join(details, ", ") + ")"
+	}
+	return game
+}
+
+// Handles /recent <player> by showing the games the player played last
+func (p *Proxy) handleRecentGames(message string, w io.Writer) {
+	start := time.Now()
+	defer p.logIfSlow(start, "/recent")
+	succeeded := false
+	defer func() { logCommand(message, start, succeeded) }()
+
+	writeMessage := func(text string) {
+		if err := p.writeChatMessageToClient("§bGoMCProxy Recent: "+text, ChatTypeChat, w); err != nil {
+			p.errorChecker(err)
+		}
+	}
+
+	if p.services.hypixel == nil {
+		writeMessage(p.translate("error.api_disabled"))
+		return
+	}
+	messageSplit := strings.Fields(message)
+	if len(messageSplit) != 2 {
+		writeMessage(p.translate("recent.usage"))
+		return
+	}
 
-				locraw := "/locraw"
-				// Name length + Name
-				if err := writeVarInt(&packetBody, len(locraw)); err != nil {
-					log.Panic(err)
-				}
-				packetBody.Write([]byte(locraw))
+	playerUuid, playerName, err := p.services.resolvePlayer(messageSplit[1])
+	if err != nil {
+		writeMessage(p.translate(playerProfileErrorKey(err)))
+		return
+	}
+	if playerName == "" {
+		playerName = messageSplit[1]
+	}
 
-				reconstructedPacket, err := p.reconstructPacket(packetBody.Bytes())
-				if err != nil {
-					log.Panic(err)
-				}
+	recentGames, err := p.services.hypixel.getRecentGames(playerUuid)
+	if err != nil {
+		writeMessage(p.translate(hypixelErrorKey(err)))
+		return
+	}
+	succeeded = true
+	// Hypixel answers the same for hidden recent games and no games in the last 3 days
+	if len(recentGames.Games) == 0 {
+		writeMessage(p.translate("recent.none", playerName))
+		return
+	}
 
-				p.writeToSrc(reconstructedPacket, src, clientToServer)
-			}
+	lines := []string{"§bGoMCProxy Recent: " + p.translate("recent.header", playerName)}
+	for _, game := range recentGames.Games[:min(len(recentGames.Games), maxRecentGames)] {
+		ago := time.Since(time.UnixMilli(game.Date)).Truncate(time.Minute)
+		var when string
+		if game.Ended == 0 {
+			when = p.translate("recent.playing_now")
+		} else if ago == 0 {
+			when = p.translate("recent.just_now")
+		} else {
+			when = p.translate("recent.ago", strings.TrimSuffix(ago.String(), "0s"))
 		}
+		lines = append(lines, formatGame(game.GameType, game.Mode, game.Map)+" §8- "+when)
+	}
+	if err := p.writePagedMessage(strings.Join(lines, "\n"), w); err != nil {
+		p.errorChecker(err)
+	}
+}
 
-		reconstructedPacket, err := p.reconstructPacket(packetData)
-		if err != nil {
-			log.Panic(err)
-		}
+func (p *Proxy) handlePlayerMovement(packetID int, packetReader *bytes.Reader) {
+	hasPosition := packetID == 0x04 || packetID == 0x06
+	hasLook := packetID == 0x05 || packetID == 0x06
 
-		err = p.writeToDst(reconstructedPacket, dst, clientToServer)
-		if err != nil {
-			if p.errorChecker(err) {
-				return
-			}
+	var position struct{ X, FeetY, Z float64 }
+	if hasPosition {
+		if err := binary.Read(packetReader, binary.BigEndian, &position); err != nil {
+			return
 		}
-
-		// Set Compression
-		if p.state == StateLogin && packetID == 3 && !clientToServer {
-			localThreshold, _, err := readVarInt(packetReader)
-			if err != nil {
-				log.Panic("Read error:", err)
-			}
-			p.threshold = localThreshold
+	}
+	var yaw float32
+	if hasLook {
+		if err := binary.Read(packetReader, binary.BigEndian, &yaw); err != nil {
+			return
 		}
 	}
+
+	navigationMutex.Lock()
+	if hasPosition {
+		navigation.hasPlayer = true
+		navigation.x = position.X
+		navigation.z = position.Z
+	}
+	if hasLook {
+		navigation.yaw = yaw
+	}
+	navigationMutex.Unlock()
 }
 
-// Returns:
-// bool: should return
-func (p *Proxy) errorChecker(err error) bool {
-	if errors.Is(err, io.EOF) || errors.Is(err, syscall.EPIPE) {
-		return true
+// Reads a Set Experience packet into the proxy's state and the overlay
+func (p *Proxy) handleSetExperience(packetReader *bytes.Reader) error {
+	xp := experienceData{known: true}
+	if err := binary.Read(packetReader, binary.BigEndian, &xp.bar); err != nil {
+		return err
+	}
+	level, _, err := readVarInt(packetReader)
+	if err != nil {
+		return err
+	}
+	total, _, err := readVarInt(packetReader)
+	if err != nil {
+		return err
 	}
-	log.Panic(err)
-	return false
+	xp.level, xp.total = int32(level), int32(total)
+
+	p.inventoryMutex.Lock()
+	p.experience = xp
+	p.inventoryMutex.Unlock()
+	experienceMutex.Lock()
+	experience = xp
+	experienceMutex.Unlock()
+	return nil
 }
 
-func (p *Proxy) createHandshakePacket(intent State) ([]byte, error) {
-	// Handshake
-	var reconstructedPacket bytes.Buffer
-	var packetBody bytes.Buffer
+func (p *Proxy) handleSetSlot(packetReader *bytes.Reader) error {
+	var windowID int8
+	if err := binary.Read(packetReader, binary.BigEndian, &windowID); err != nil {
+		return err
+	}
+	var slot int16
+	if err := binary.Read(packetReader, binary.BigEndian, &slot); err != nil {
+		return err
+	}
+	if windowID > 0 {
+		return p.handleShopSlot(byte(windowID), slot, packetReader)
+	}
+	// Only the player inventory is tracked, window ID -1 is the cursor
+	if windowID != 0 || slot < 0 || int(slot) >= len(p.inventory) {
+		return nil
+	}
 
-	// Packet ID
-	if err := writeVarInt(&packetBody, 0x00); err != nil {
-		return nil, err
+	item, err := readSlot(packetReader)
+	if err != nil {
+		return err
 	}
 
-	// Protocol version
-	if err := writeVarInt(&packetBody, 47); err != nil {
-		return nil, err
+	p.inventoryMutex.Lock()
+	p.inventory[slot] = item
+	p.inventoryMutex.Unlock()
+	return nil
+}
+
+func (p *Proxy) handleWindowItems(packetReader *bytes.Reader) error {
+	windowID, err := packetReader.ReadByte()
+	if err != nil {
+		return err
+	}
+	if windowID != 0 {
+		return p.handleShopItems(windowID, packetReader)
+	}
+	var count int16
+	if err := binary.Read(packetReader, binary.BigEndian, &count); err != nil {
+		return err
 	}
 
-	forwardAddrSplit := strings.Split(p.forwardAddr, ":")
-	if len(forwardAddrSplit) != 2 {
-		log.Panic(errors.New("Invalid forward addr"))
+	var inventory [45]*ItemStack
+	for i := range int(count) {
+		item, err := readSlot(packetReader)
+		if err != nil {
+			return err
+		}
+		if i < len(inventory) {
+			inventory[i] = item
+		}
 	}
-	serverAddress := forwardAddrSplit[0]
-	serverPortString := forwardAddrSplit[1]
-	serverPortUint16, err := strconv.ParseUint(serverPortString, 10, 16)
-	if err != nil {
-		return nil, err
+
+	p.inventoryMutex.Lock()
+	p.inventory = inventory
+	p.inventoryMutex.Unlock()
+	return nil
+}
+
+// Formats the held item's NBT as a chat message
+func (p *Proxy) heldItemInfo() string {
+	p.inventoryMutex.RLock()
+	// Hotbar slots are 36-44 in the player inventory window
+	item := p.inventory[36+p.heldSlot]
+	p.inventoryMutex.RUnlock()
+
+	if item == nil {
+		return "§bGoMCProxy ItemInfo: " + p.translate("iteminfo.not_holding")
 	}
-	serverPort := make([]byte, 2)
-	binary.BigEndian.PutUint16(serverPort, uint16(serverPortUint16))
 
-	// Server address length + Server address
-	if err := writeVarInt(&packetBody, len(serverAddress)); err != nil {
-		return nil, err
+	var sb strings.Builder
+	sb.WriteString("§bGoMCProxy ItemInfo:")
+
+	name, lore := getItemDisplay(item.Tag)
+	if name != "" {
+		sb.WriteString("\n" + p.translate("iteminfo.name", name))
 	}
-	packetBody.Write([]byte(serverAddress))
+	sb.WriteString("\n" + p.translate("iteminfo.id", item.ID, item.Damage, item.Count))
 
-	// Server Port
-	packetBody.Write(serverPort)
+	if len(lore) > 0 {
+		sb.WriteString("\n" + p.translate("iteminfo.lore"))
+		for _, line := range lore {
+			sb.WriteString("\n §r" + line)
+		}
+	}
 
-	// Intent
-	if err := writeVarInt(&packetBody, int(intent)); err != nil {
-		return nil, err
+	enchantments := getItemEnchantments(item.Tag)
+	if len(enchantments) > 0 {
+		sb.WriteString("\n" + p.translate("iteminfo.enchantments", strings.Join(enchantments, ", ")))
 	}
 
-	// Turn into a full packet
-	if err := writeVarInt(&reconstructedPacket, packetBody.Len()); err != nil {
-		return nil, err
+	if len(item.Tag) > 0 {
+		keys := make([]string, 0, len(item.Tag))
+		for k := range item.Tag {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		sb.WriteString("\n" + p.translate("iteminfo.tags", strings.Join(keys, ", ")))
 	}
-	reconstructedPacket.Write(packetBody.Bytes())
-	return reconstructedPacket.Bytes(), nil
+	return sb.String()
 }
 
 type ChatMessageData struct {
-	Extra []ChatMessageExtra `json:"extra"`
+	Extra []ChatMessageExtra `json:"extra,omitempty"`
 	Text  string             `json:"text"`
 }
 
@@ -679,6 +2342,49 @@ type ChatMessageExtra struct {
 	Text string `json:"text"`
 }
 
+// Creates a **Serverbound** chat message packet (packet ID + data)
+func createServerboundChatPacket(message string) []byte {
+	var packetBody bytes.Buffer
+
+	// Packet ID
+	if err := writeVarInt(&packetBody, 0x01); err != nil {
+		log.Panic(err)
+	}
+
+	// Message length + Message
+	if err := writeVarInt(&packetBody, len(message)); err != nil {
+		log.Panic(err)
+	}
+	packetBody.Write([]byte(message))
+
+	return packetBody.Bytes()
+}
+
+// Creates a **Serverbound** MC|Brand plugin message packet (packet ID + data)
+func createServerboundBrandPacket(brand string) []byte {
+	var packetBody bytes.Buffer
+
+	// Packet ID
+	if err := writeVarInt(&packetBody, 0x17); err != nil {
+		log.Panic(err)
+	}
+
+	// Channel length + Channel
+	channel := "MC|Brand"
+	if err := writeVarInt(&packetBody, len(channel)); err != nil {
+		log.Panic(err)
+	}
+	packetBody.Write([]byte(channel))
+
+	// Brand length + Brand, the payload's length isn't prefixed
+	if err := writeVarInt(&packetBody, len(brand)); err != nil {
+		log.Panic(err)
+	}
+	packetBody.Write([]byte(brand))
+
+	return packetBody.Bytes()
+}
+
 // Creates a **Clientbound** chat message packet
 func createChatMessagePacket(text string, chatType ChatType) ([]byte, error) {
 	var packetBody bytes.Buffer
@@ -712,40 +2418,189 @@ func createChatMessagePacket(text string, chatType ChatType) ([]byte, error) {
 	return packetBody.Bytes(), nil
 }
 
-func (p *Proxy) writeChatMessageToClient(text string, chatType ChatType, w io.Writer) error {
-	chatMessagePacket, err := createChatMessagePacket(text, chatType)
+// Creates a Disconnect packet, packetID is 0x00 in the Login state and 0x40 in the Play state
+func createDisconnectPacket(packetID int, reason string) ([]byte, error) {
+	var packetBody bytes.Buffer
+
+	// Packet ID
+	if err := writeVarInt(&packetBody, packetID); err != nil {
+		return nil, err
+	}
+
+	jsonData, err := json.Marshal(ChatMessageData{Text: reason})
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	// JSON data length + JSON data
+	if err := writeVarInt(&packetBody, len(jsonData)); err != nil {
+		return nil, err
 	}
+	packetBody.Write(jsonData)
+
+	return packetBody.Bytes(), nil
+}
 
-	reconstructedPacket, err := p.reconstructPacket(chatMessagePacket)
+// Frames packet (packet ID + data) and writes it unencrypted
+func writePacket(w io.Writer, packet []byte, threshold int) error {
+	reconstructedPacket, err := reconstructPacket(packet, threshold)
 	if err != nil {
 		return err
 	}
-
 	_, err = w.Write(reconstructedPacket)
+	return err
+}
+
+func (p *Proxy) writeChatMessageToClient(text string, chatType ChatType, w io.Writer) error {
+	if chatType != ChatTypeActionBar && !p.allowChatMessage(w) {
+		return nil
+	}
+	chatMessagePacket, err := createChatMessagePacket(text, chatType)
 	if err != nil {
 		return err
 	}
-	return nil
+	return p.injectClientbound(chatMessagePacket, w)
+}
+
+// Lines per page of a paged message, not counting the header and footer
+const pageSize = 8
+
+// Writes the first page of text and keeps the rest for /scnext. The first line of text is the
+// header which is repeated on every page.
+func (p *Proxy) writePagedMessage(text string, w io.Writer) error {
+	lines := strings.Split(text, "\n")
+
+	p.pagedMutex.Lock()
+	p.pagedHeader = lines[0]
+	p.pagedLines = lines[1:]
+	p.pagedPage = 0
+	page := p.currentPageLocked()
+	p.pagedMutex.Unlock()
+
+	return p.writeChatMessageToClient(page, ChatTypeChat, w)
 }
 
+// Writes the next page of the last paged message
+func (p *Proxy) writeNextPage(w io.Writer) error {
+	p.pagedMutex.Lock()
+	pages := (len(p.pagedLines) + pageSize - 1) / pageSize
+	if p.pagedPage+1 >= pages {
+		p.pagedMutex.Unlock()
+		return p.writeChatMessageToClient("§bGoMCProxy: "+p.translate("paging.no_more_pages"), ChatTypeChat, w)
+	}
+	p.pagedPage++
+	page := p.currentPageLocked()
+	p.pagedMutex.Unlock()
+
+	return p.writeChatMessageToClient(page, ChatTypeChat, w)
+}
+
+func (p *Proxy) currentPageLocked() string {
+	pages := (len(p.pagedLines) + pageSize - 1) / pageSize
+	start := p.pagedPage * pageSize
+	end := min(start+pageSize, len(p.pagedLines))
+
+	page := p.pagedHeader
+	if end > start {
+		page += "\n" + strings.Join(p.pagedLines[start:end], "\n")
+	}
+	if pages > 1 {
+		page += "\n" + p.translate("paging.footer", p.pagedPage+1, pages)
+		if p.pagedPage+1 < pages {
+			page += p.translate("paging.more")
+		}
+	}
+	return page
+}
+
+// Writes the packet and then the injected packets that were queued while it was being written, their
+// injectors couldn't take the write mutex and left them to this goroutine
 func (p *Proxy) writeToDst(reconstructedPacket []byte, w io.Writer, clientToServer bool) error {
+	mutex := p.writeMutex(clientToServer)
+	mutex.Lock()
+	err := p.writeToDstLocked(reconstructedPacket, w, clientToServer)
+	mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return p.drainInjected(w, clientToServer)
+}
+
+// Callers hold the direction's write mutex
+func (p *Proxy) writeToDstLocked(reconstructedPacket []byte, w io.Writer, clientToServer bool) error {
 	if p.serverWriter != nil && clientToServer {
 		w = p.serverWriter
 	}
 	if _, err := w.Write(reconstructedPacket); err != nil {
 		return err
 	}
+	if mirror != nil && !clientToServer {
+		mirror.write(reconstructedPacket)
+	}
 	return nil
 }
 
-func (p *Proxy) writeToSrc(reconstructedPacket []byte, w io.Writer, clientToServer bool) error {
-	if p.serverWriter != nil && !clientToServer {
-		w = p.serverWriter
+// Queues a proxy-injected serverbound packet (packet ID + data) and sends the queue if in the Play state.
+// The queue is bounded by config.CommandQueueSize, the oldest packets are dropped first.
+func (p *Proxy) injectServerbound(packet []byte, serverConn io.Writer) error {
+	p.commandMutex.Lock()
+	defer p.commandMutex.Unlock()
+
+	// Commands injected together are spaced out by the delay as well
+	now := time.Now()
+	after := now
+	if n := len(p.commandQueue); n > 0 && p.commandQueue[n-1].sendAt.After(now) {
+		after = p.commandQueue[n-1].sendAt
 	}
-	if _, err := w.Write(reconstructedPacket); err != nil {
-		return err
+	p.commandQueue = append(p.commandQueue, queuedPacket{packet, after.Add(injectionDelay(getConfig()))})
+	if overflow := len(p.commandQueue) - getConfig().CommandQueueSize; overflow > 0 {
+		p.logger.Printf("Command queue is full, dropped %d injected packet(s)", overflow)
+		p.commandQueue = p.commandQueue[overflow:]
+	}
+
+	if p.getState() != StatePlay {
+		return nil
+	}
+	return p.flushCommandQueueLocked(serverConn)
+}
+
+func (p *Proxy) flushCommandQueue(serverConn io.Writer) error {
+	p.commandMutex.Lock()
+	defer p.commandMutex.Unlock()
+	return p.flushCommandQueueLocked(serverConn)
+}
+
+// Packets that fail to send stay queued, stale packets are dropped. While a packet is being written
+// to the server the queue is left to writeToDst, which flushes it after that packet. It needs
+// commandMutex to do so, so nothing can be queued between the failed TryLock and that flush.
+func (p *Proxy) flushCommandQueueLocked(serverConn io.Writer) error {
+	if !p.serverWriteMutex.TryLock() {
+		return nil
+	}
+	defer p.serverWriteMutex.Unlock()
+
+	maxAge := getConfig().CommandQueueMaxAge
+	for len(p.commandQueue) > 0 {
+		queued := p.commandQueue[0]
+		// Counted from when it was due, waiting for -inject-delay doesn't make it stale
+		if time.Since(queued.sendAt) > maxAge {
+			p.logger.Println("Dropped a stale injected packet")
+			p.commandQueue = p.commandQueue[1:]
+			continue
+		}
+		if wait := time.Until(queued.sendAt); wait > 0 {
+			p.scheduleFlushLocked(wait)
+			return nil
+		}
+
+		reconstructedPacket, err := reconstructPacket(queued.packet, p.getServerThreshold())
+		if err != nil {
+			return err
+		}
+		if err := p.writeToDstLocked(reconstructedPacket, serverConn, true); err != nil {
+			return err
+		}
+		p.commandQueue = p.commandQueue[1:]
 	}
 	return nil
 }
@@ -756,23 +2611,28 @@ type JoinRequest struct {
 	ServerID        string `json:"serverId"`
 }
 
+// Errors from parsing the request are wrapped in NotJavaServer
 func (p *Proxy) handleEncryptionRequest(packetReader *bytes.Reader) ([]byte, error) {
 	serverIDBytes, err := readPrefixedBytes(packetReader)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", NotJavaServer, err)
 	}
 	serverID := string(serverIDBytes)
 
 	pubKeyBytes, err := readPrefixedBytes(packetReader)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", NotJavaServer, err)
 	}
 
 	parsedServerPubKey, err := x509.ParsePKIXPublicKey(pubKeyBytes)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", NotJavaServer, err)
+	}
+	serverPublicKey, ok := parsedServerPubKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: the public key is not an RSA key", NotJavaServer)
 	}
-	p.serverPublicKey = parsedServerPubKey.(*rsa.PublicKey)
+	p.serverPublicKey = serverPublicKey
 
 	encodedServerPubKey, err := x509.MarshalPKIXPublicKey(p.serverPublicKey)
 	if err != nil {
@@ -781,8 +2641,10 @@ func (p *Proxy) handleEncryptionRequest(packetReader *bytes.Reader) ([]byte, err
 
 	verifyToken, err := readPrefixedBytes(packetReader)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", NotJavaServer, err)
 	}
+	p.logEncryption("Encryption Request: server ID %q, %d-bit RSA key with SHA-256 fingerprint %x, %d-byte verify token",
+		serverID, p.serverPublicKey.N.BitLen(), sha256.Sum256(encodedServerPubKey), len(verifyToken))
 
 	p.sharedSecret = make([]byte, 16)
 	rand.Read(p.sharedSecret)
@@ -796,9 +2658,16 @@ func (p *Proxy) handleEncryptionRequest(packetReader *bytes.Reader) ([]byte, err
 	}
 
 	resp, err := http.Post("https://sessionserver.mojang.com/session/minecraft/join", "application/json", bytes.NewReader(reqBody))
-	if err != nil || resp.StatusCode != 204 {
+	if err != nil {
+		p.logEncryption("Mojang join failed: %v", err)
+		return nil, errors.New("Invalid response from Mojang. Check your access token and UUID")
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 204 {
+		p.logEncryption("Mojang join failed: %s", resp.Status)
 		return nil, errors.New("Invalid response from Mojang. Check your access token and UUID")
 	}
+	p.logEncryption("Mojang join succeeded")
 
 	return p.createEncryptionResponse(verifyToken)
 }
@@ -861,15 +2730,19 @@ func minecraftDigest(serverID string, sharedSecret, pubKey []byte) string {
 	return digest.Text(16)
 }
 
-func (p *Proxy) reconstructPacket(packet []byte) ([]byte, error) {
+// Frames packet (packet ID + data), compressing it when threshold is not -1
+func reconstructPacket(packet []byte, threshold int) ([]byte, error) {
 	var reconstructedPacket bytes.Buffer
 	var compressedPacket bytes.Buffer
 
 	// Compression enabled
-	if p.threshold != -1 {
-		if len(packet) >= p.threshold {
+	if threshold != -1 {
+		if len(packet) >= threshold {
 			var compressBuf bytes.Buffer
-			zWriter := zlib.NewWriter(&compressBuf)
+			zWriter, err := zlib.NewWriterLevel(&compressBuf, getConfig().CompressionLevel)
+			if err != nil {
+				return nil, err
+			}
 
 			// Compress Packet ID + Data
 			if _, err := zWriter.Write(packet); err != nil {
@@ -915,64 +2788,97 @@ func (p *Proxy) reconstructPacket(packet []byte) ([]byte, error) {
 	return reconstructedPacket.Bytes(), nil
 }
 
-// Returns:
-// int: packet length
-// byte[]: data (packet ID + data)
-func (p *Proxy) readPacket(r io.Reader) (int, []byte, error) {
+// A packet as read from the connection, before it is decompressed
+type Frame struct {
+	packetLength int
+	dataLength   int    // -1 without compression, 0 if the packet isn't compressed
+	payload      []byte // Packet ID + Data, zlib compressed if dataLength > 0
+}
+
+func readFrame(r io.Reader, threshold *int) (*Frame, error) {
+	return readFrameWithThreshold(r, func() int { return *threshold })
+}
+
+// threshold is only called once the packet length has been read, since it can change while blocked
+func readFrameWithThreshold(r io.Reader, threshold func() int) (*Frame, error) {
 	// Packet Length
 	packetLength, _, err := readVarInt(r)
 	if err != nil {
-		return 0, nil, err
+		return nil, err
 	}
+	frame := &Frame{packetLength: packetLength, dataLength: -1}
 	if packetLength == 0 {
-		return 0, nil, nil
+		return frame, nil
 	}
 
-	dataLength := -1
-	var data []byte
-
+	payloadLength := packetLength
 	// Compression enabled
-	if p.threshold != -1 {
+	if threshold() != -1 {
 		var bytesRead int
-		dataLength, bytesRead, err = readVarInt(r)
+		frame.dataLength, bytesRead, err = readVarInt(r)
 		if err != nil {
-			return 0, nil, err
+			return nil, err
 		}
-
-		payloadLength := packetLength - bytesRead
-		payload := make([]byte, payloadLength)
-		if _, err = io.ReadFull(r, payload); err != nil {
-			return 0, nil, err
+		payloadLength -= bytesRead
+		if payloadLength < 0 {
+			return nil, fmt.Errorf("Packet length %d is shorter than its data length field", packetLength)
 		}
+	}
 
-		if dataLength > 0 {
-			// Packet is compressed
-			// Packet ID + Data
-			zr, err := zlib.NewReader(bytes.NewReader(payload))
-			if err != nil {
-				return 0, nil, err
-			}
-			defer zr.Close()
+	frame.payload = make([]byte, payloadLength)
+	if _, err := io.ReadFull(r, frame.payload); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
 
-			data = make([]byte, dataLength)
-			_, err = io.ReadFull(zr, data)
-			if err != nil {
-				return 0, nil, err
-			}
+// Returns:
+// []byte: Packet ID + Data
+func (f *Frame) decompress() ([]byte, error) {
+	if f.dataLength <= 0 {
+		return f.payload, nil
+	}
 
-		} else {
-			// Packet is not compressed
-			data = payload
-		}
-		// Compression disabled
-	} else {
-		data = make([]byte, packetLength)
-		_, err = io.ReadFull(r, data)
-		if err != nil {
-			return 0, nil, err
-		}
+	zr, err := zlib.NewReader(bytes.NewReader(f.payload))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	data := make([]byte, f.dataLength)
+	if _, err := io.ReadFull(zr, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Returns the frame as it is sent
+func (f *Frame) bytes() []byte {
+	var body bytes.Buffer
+	if f.dataLength != -1 {
+		writeVarInt(&body, f.dataLength)
+	}
+	body.Write(f.payload)
+
+	var framed bytes.Buffer
+	writeVarInt(&framed, body.Len())
+	framed.Write(body.Bytes())
+	return framed.Bytes()
+}
+
+// Returns:
+// int: packet length
+// byte[]: data (packet ID + data)
+func readPacket(r io.Reader, threshold *int) (int, []byte, error) {
+	frame, err := readFrame(r, threshold)
+	if err != nil {
+		return 0, nil, err
+	}
+	if frame.packetLength == 0 {
+		return 0, nil, nil
 	}
-	return packetLength, data, err
+	data, err := frame.decompress()
+	return frame.packetLength, data, err
 }
 
 func readPrefixedBytes(r io.Reader) ([]byte, error) {
@@ -980,6 +2886,10 @@ func readPrefixedBytes(r io.Reader) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Checked before allocating, a malformed packet would otherwise panic or allocate gigabytes
+	if remaining, ok := r.(interface{ Len() int }); bytesLength < 0 || ok && bytesLength > remaining.Len() {
+		return nil, fmt.Errorf("Invalid length %d", bytesLength)
+	}
 	bytesBuf := make([]byte, bytesLength)
 	_, err = io.ReadFull(r, bytesBuf)
 	return bytesBuf, err
@@ -1007,17 +2917,19 @@ func readVarInt(r io.Reader) (int, int, error) {
 	return num, bytesRead, nil
 }
 
+// Negative values are written as their 32-bit two's complement, 5 bytes, like the notchian client does
 func writeVarInt(w io.Writer, value int) error {
+	unsigned := uint32(value)
 	for {
-		temp := byte(value & 0x7F)
-		value >>= 7
-		if value != 0 {
+		temp := byte(unsigned & 0x7F)
+		unsigned >>= 7
+		if unsigned != 0 {
 			temp |= 0x80
 		}
 		if _, err := w.Write([]byte{temp}); err != nil {
 			return err
 		}
-		if value == 0 {
+		if unsigned == 0 {
 			break
 		}
 	}
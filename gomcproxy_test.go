@@ -0,0 +1,562 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// A packet of length bytes, packet ID 0x02 followed by data that doesn't compress to nothing
+func testPacket(length int) []byte {
+	packet := make([]byte, length)
+	packet[0] = 0x02
+	for i := 1; i < length; i++ {
+		packet[i] = byte(i * 7)
+	}
+	return packet
+}
+
+func TestReconstructPacketRoundTrip(t *testing.T) {
+	for _, threshold := range []int{-1, 0, 64, 256} {
+		lengths := []int{1, 2, 255, 256, 257, 5000}
+		if threshold > 0 {
+			lengths = append(lengths, threshold-1, threshold, threshold+1)
+		}
+		for _, length := range lengths {
+			t.Run(fmt.Sprintf("threshold %d length %d", threshold, length), func(t *testing.T) {
+				packet := testPacket(length)
+				framed, err := reconstructPacket(packet, threshold)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				frame, err := readFrame(bytes.NewReader(framed), &threshold)
+				if err != nil {
+					t.Fatal(err)
+				}
+				wantDataLength := -1
+				if threshold != -1 {
+					wantDataLength = 0
+					if length >= threshold {
+						wantDataLength = length
+					}
+				}
+				if frame.dataLength != wantDataLength {
+					t.Errorf("data length = %d, want %d", frame.dataLength, wantDataLength)
+				}
+				if !bytes.Equal(frame.bytes(), framed) {
+					t.Error("the frame isn't sent as it was read")
+				}
+
+				r := bytes.NewReader(framed)
+				packetLength, data, err := readPacket(r, &threshold)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(data, packet) {
+					t.Errorf("read %d bytes, want the %d written", len(data), len(packet))
+				}
+				if packetLength != frame.packetLength || r.Len() != 0 {
+					t.Errorf("packet length %d with %d bytes left over", packetLength, r.Len())
+				}
+			})
+		}
+	}
+}
+
+func TestReadPacketTruncated(t *testing.T) {
+	for _, threshold := range []int{-1, 256} {
+		framed, err := reconstructPacket(testPacket(5000), threshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, cut := range []int{0, 1, 2, 3, len(framed) / 2, len(framed) - 1} {
+			if _, _, err := readPacket(bytes.NewReader(framed[:cut]), &threshold); err == nil {
+				t.Errorf("threshold %d: no error for the packet cut to %d of %d bytes", threshold, cut, len(framed))
+			}
+		}
+	}
+}
+
+func TestWriteVarInt(t *testing.T) {
+	tests := []struct {
+		value int
+		want  []byte
+	}{
+		{0, []byte{0x00}},
+		{1, []byte{0x01}},
+		{127, []byte{0x7F}},
+		{128, []byte{0x80, 0x01}},
+		{256, []byte{0x80, 0x02}},
+		{math.MaxInt32, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x07}},
+		{-1, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x0F}},
+		{math.MinInt32, []byte{0x80, 0x80, 0x80, 0x80, 0x08}},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		if err := writeVarInt(&b, tt.value); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b.Bytes(), tt.want) {
+			t.Errorf("writeVarInt(%d) = % X, want % X", tt.value, b.Bytes(), tt.want)
+		}
+
+		value, n, err := readVarInt(&b)
+		if err != nil {
+			t.Fatalf("readVarInt of %d: %v", tt.value, err)
+		}
+		if int(int32(uint32(value))) != tt.value || n != len(tt.want) {
+			t.Errorf("readVarInt = %d (%d bytes), want %d (%d bytes)", int32(uint32(value)), n, tt.value, len(tt.want))
+		}
+	}
+}
+
+// Chat with multibyte characters, the length prefixes count bytes while the limits of 100 serverbound
+// and 32767 clientbound characters count characters
+var multibyteChat = []string{
+	"§bGoMCProxy: §rHello",
+	"gg 👋🏽 wp",
+	"你好，世界",
+	"[MVP§c+§b] Ünïcødé",
+	strings.Repeat("§", 100),
+	strings.Repeat("界", 100),
+	strings.Repeat("😀", 100),
+}
+
+// Reads a prefixed string packet back the way proxyTraffic does, checking nothing is left after it
+func readChatPacket(t *testing.T, framed []byte, threshold int, wantPacketID int) (string, *bytes.Reader) {
+	t.Helper()
+	_, data, err := readPacket(bytes.NewReader(framed), &threshold)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(data)
+	packetID, _, err := readVarInt(r)
+	if err != nil || packetID != wantPacketID {
+		t.Fatalf("packet ID 0x%02X (%v), want 0x%02X", packetID, err, wantPacketID)
+	}
+	messageBytes, err := readPrefixedBytes(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(messageBytes), r
+}
+
+func TestServerboundChatMultibyte(t *testing.T) {
+	for _, message := range multibyteChat {
+		for _, threshold := range []int{-1, 64} {
+			framed, err := reconstructPacket(createServerboundChatPacket(message), threshold)
+			if err != nil {
+				t.Fatal(err)
+			}
+			read, r := readChatPacket(t, framed, threshold, 0x01)
+			if read != message || r.Len() != 0 {
+				t.Errorf("read %q with %d bytes after it, want %q", read, r.Len(), message)
+			}
+		}
+	}
+}
+
+func TestClientboundChatMultibyte(t *testing.T) {
+	messages := append([]string{strings.Repeat("界", 32767), strings.Repeat("§a😀", 32767/3)}, multibyteChat...)
+	for _, message := range messages {
+		packet, err := createChatMessagePacket(message, ChatTypeChat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		framed, err := reconstructPacket(packet, 256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jsonData, r := readChatPacket(t, framed, 256, 0x02)
+		if !utf8.ValidString(jsonData) {
+			t.Fatalf("%d character message: JSON isn't valid UTF-8, it was cut", utf8.RuneCountInString(message))
+		}
+
+		chatMessage := ChatMessageData{}
+		if err := json.Unmarshal([]byte(jsonData), &chatMessage); err != nil {
+			t.Fatalf("%d character message: %v", utf8.RuneCountInString(message), err)
+		}
+		if len(chatMessage.Extra) != 1 || chatMessage.Extra[0].Text != message {
+			t.Errorf("%d character message didn't survive the round trip", utf8.RuneCountInString(message))
+		}
+		position, err := r.ReadByte()
+		if err != nil || position != byte(ChatTypeChat) || r.Len() != 0 {
+			t.Errorf("position %d (%v) with %d bytes after it", position, err, r.Len())
+		}
+	}
+}
+
+// Sets -compression-level for the benchmark, restoring it afterwards
+func setCompressionLevel(b *testing.B, level int) {
+	configMutex.Lock()
+	previous := config.CompressionLevel
+	config.CompressionLevel = level
+	configMutex.Unlock()
+	b.Cleanup(func() {
+		configMutex.Lock()
+		config.CompressionLevel = previous
+		configMutex.Unlock()
+	})
+}
+
+// Compares the -compression-level choices for packets below and above the usual threshold of 256
+func BenchmarkReconstructPacket(b *testing.B) {
+	for _, size := range []int{64, 1024, 32 * 1024} {
+		packet := testChunkPacket(size)
+		for _, level := range []int{-1, 0, 1, 6, 9} {
+			b.Run(fmt.Sprintf("%d bytes level %d", size, level), func(b *testing.B) {
+				setCompressionLevel(b, level)
+				framed, err := reconstructPacket(packet, 256)
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.ReportMetric(float64(len(framed))/float64(size), "framed/raw")
+				b.SetBytes(int64(size))
+				b.ReportAllocs()
+				for range b.N {
+					if _, err := reconstructPacket(packet, 256); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkReadFrame(b *testing.B) {
+	for _, size := range []int{64, 1024, 32 * 1024} {
+		framed, err := reconstructPacket(testChunkPacket(size), 256)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(fmt.Sprintf("%d bytes", size), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			threshold := 256
+			r := bytes.NewReader(framed)
+			for range b.N {
+				r.Reset(framed)
+				frame, err := readFrame(r, &threshold)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := frame.decompress(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func createStringPacket(packetID int, fields ...string) []byte {
+	var packet bytes.Buffer
+	writeVarInt(&packet, packetID)
+	for _, field := range fields {
+		writeVarInt(&packet, len(field))
+		packet.WriteString(field)
+	}
+	return packet.Bytes()
+}
+
+// Starts a proxy in front of backend and connects a client to it, as handleClient does with -offline
+func connectThroughProxy(t *testing.T, backend net.Listener) net.Conn {
+	t.Helper()
+	proxyListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { proxyListener.Close() })
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := proxyListener.Accept()
+		if err != nil {
+			return
+		}
+		handleClient(conn, newServices(nil, nil, nil), backend.Addr().String(), "", "")
+	}()
+
+	clientConn, err := net.Dial("tcp", proxyListener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientConn.SetDeadline(time.Now().Add(10 * time.Second))
+	t.Cleanup(func() {
+		clientConn.Close()
+		<-done
+	})
+
+	var handshake bytes.Buffer
+	writeVarInt(&handshake, 0x00)
+	writeVarInt(&handshake, 47)
+	writeVarInt(&handshake, len("localhost"))
+	handshake.WriteString("localhost")
+	binary.Write(&handshake, binary.BigEndian, uint16(25565))
+	writeVarInt(&handshake, int(StateLogin))
+	if err := writePacket(clientConn, handshake.Bytes(), -1); err != nil {
+		t.Fatal(err)
+	}
+	if err := writePacket(clientConn, createStringPacket(0x00, "tester"), -1); err != nil {
+		t.Fatal(err)
+	}
+	return clientConn
+}
+
+// Logs in to an offline mode backend, which answers Login Start with Login Success right away or after
+// Set Compression, and never sends an Encryption Request
+func TestOfflineBackendLogin(t *testing.T) {
+	for _, serverThreshold := range []int{-1, 256} {
+		t.Run(fmt.Sprintf("threshold %d", serverThreshold), func(t *testing.T) {
+			backend, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer backend.Close()
+
+			serverGot := make(chan string, 1)
+			go func() {
+				conn, err := backend.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+				threshold := -1
+				readPacket(conn, &threshold) // Handshake
+				readPacket(conn, &threshold) // Login Start
+				if serverThreshold != -1 {
+					var setCompression bytes.Buffer
+					writeVarInt(&setCompression, 0x03)
+					writeVarInt(&setCompression, serverThreshold)
+					writePacket(conn, setCompression.Bytes(), -1)
+					threshold = serverThreshold
+				}
+				writePacket(conn, createStringPacket(0x02, "00000000-0000-0000-0000-000000000000", "tester"), threshold)
+				chat, _ := createChatMessagePacket("hi", ChatTypeChat)
+				writePacket(conn, chat, threshold)
+
+				for {
+					_, packet, err := readPacket(conn, &threshold)
+					if err != nil {
+						serverGot <- err.Error()
+						return
+					}
+					if packet[0] == 0x01 {
+						serverGot <- string(packet[2:])
+						return
+					}
+				}
+			}()
+
+			clientConn := connectThroughProxy(t, backend)
+			threshold := -1
+			loggedIn := false
+			for {
+				_, packet, err := readPacket(clientConn, &threshold)
+				if err != nil {
+					t.Fatalf("logged in %v: %v", loggedIn, err)
+				}
+				r := bytes.NewReader(packet)
+				packetID, _, _ := readVarInt(r)
+				if !loggedIn && packetID == 0x00 {
+					reason, _ := readPrefixedBytes(r)
+					t.Fatalf("disconnected during the login: %s", reason)
+				}
+				if !loggedIn && packetID == 0x03 {
+					threshold, _, _ = readVarInt(r)
+					continue
+				}
+				if !loggedIn && packetID == 0x02 {
+					readPrefixedBytes(r)
+					if name, _ := readPrefixedBytes(r); string(name) != "tester" {
+						t.Fatalf("Login Success for %q", name)
+					}
+					loggedIn = true
+					continue
+				}
+				if loggedIn && packetID == 0x02 {
+					if message, _ := readPrefixedBytes(r); bytes.Contains(message, []byte(`"hi"`)) {
+						break
+					}
+				}
+			}
+			if want := serverThreshold; threshold != want {
+				t.Errorf("client threshold %d, want %d", threshold, want)
+			}
+
+			if err := writePacket(clientConn, createServerboundChatPacket("yo"), threshold); err != nil {
+				t.Fatal(err)
+			}
+			if got := <-serverGot; got != "yo" {
+				t.Errorf("server got %q, want the client's chat", got)
+			}
+		})
+	}
+}
+
+// Without an access token, an Encryption Request disconnects the client with a reason instead of
+// attempting the Mojang join
+func TestOnlineBackendWithoutAccount(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+
+	go func() {
+		conn, err := backend.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		threshold := -1
+		readPacket(conn, &threshold)
+		readPacket(conn, &threshold)
+		var encryptionRequest bytes.Buffer
+		writeVarInt(&encryptionRequest, 0x01)
+		writeVarInt(&encryptionRequest, 0)
+		writeVarInt(&encryptionRequest, 3)
+		encryptionRequest.WriteString("key")
+		writeVarInt(&encryptionRequest, 4)
+		encryptionRequest.WriteString("tokn")
+		writePacket(conn, encryptionRequest.Bytes(), -1)
+		// Until the proxy closes the connection
+		conn.Read(make([]byte, 1))
+	}()
+
+	clientConn := connectThroughProxy(t, backend)
+	threshold := -1
+	_, packet, err := readPacket(clientConn, &threshold)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(packet)
+	if packetID, _, _ := readVarInt(r); packetID != 0x00 {
+		t.Fatalf("got packet 0x%02X, want Login Disconnect", packetID)
+	}
+	if reason, _ := readPrefixedBytes(r); !bytes.Contains(reason, []byte("-accesstoken")) {
+		t.Errorf("disconnect reason %s doesn't name -accesstoken", reason)
+	}
+}
+
+// Server commands that start like a proxy command, and a bare /status, reach the server unchanged
+func TestServerCommandsForwarded(t *testing.T) {
+	commands := []string{"/scoreboard objectives list", "/scfavorite", "/recentx", "/calculator 1", "/compared", "/status"}
+
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+
+	serverGot := make(chan string, len(commands))
+	go func() {
+		conn, err := backend.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+		threshold := -1
+		readPacket(conn, &threshold) // Handshake
+		readPacket(conn, &threshold) // Login Start
+		writePacket(conn, createStringPacket(0x02, "00000000-0000-0000-0000-000000000000", "tester"), threshold)
+		for {
+			_, packet, err := readPacket(conn, &threshold)
+			if err != nil {
+				close(serverGot)
+				return
+			}
+			if packet[0] == 0x01 {
+				message, _ := readPrefixedBytes(bytes.NewReader(packet[1:]))
+				serverGot <- string(message)
+			}
+		}
+	}()
+
+	clientConn := connectThroughProxy(t, backend)
+	threshold := -1
+	if _, packet, err := readPacket(clientConn, &threshold); err != nil || packet[0] != 0x02 {
+		t.Fatalf("got %v (%v), want Login Success", packet, err)
+	}
+	for _, command := range commands {
+		if err := writePacket(clientConn, createServerboundChatPacket(command), threshold); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, command := range commands {
+		if got := <-serverGot; got != command {
+			t.Errorf("server got %q, want %q", got, command)
+		}
+	}
+}
+
+// A client's malformed Plugin Message is forwarded and a malformed chat message dropped, the proxy
+// keeps running either way
+func TestMalformedServerboundPackets(t *testing.T) {
+	// The channel and the chat message claim 100 bytes that aren't there
+	malformedPluginMessage := []byte{0x17, 100, 'M', 'C'}
+	malformedChat := []byte{0x01, 100, '/'}
+
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+
+	serverGot := make(chan []byte, 3)
+	go func() {
+		conn, err := backend.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+		threshold := -1
+		readPacket(conn, &threshold) // Handshake
+		readPacket(conn, &threshold) // Login Start
+		writePacket(conn, createStringPacket(0x02, "00000000-0000-0000-0000-000000000000", "tester"), threshold)
+		for {
+			_, packet, err := readPacket(conn, &threshold)
+			if err != nil {
+				close(serverGot)
+				return
+			}
+			if packet[0] == 0x01 || packet[0] == 0x17 {
+				serverGot <- packet
+			}
+		}
+	}()
+
+	clientConn := connectThroughProxy(t, backend)
+	threshold := -1
+	if _, packet, err := readPacket(clientConn, &threshold); err != nil || packet[0] != 0x02 {
+		t.Fatalf("got %v (%v), want Login Success", packet, err)
+	}
+	for _, packet := range [][]byte{malformedPluginMessage, malformedChat, createServerboundChatPacket("/scoreboard")} {
+		if err := writePacket(clientConn, packet, threshold); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range [][]byte{malformedPluginMessage, createServerboundChatPacket("/scoreboard")} {
+		if got := <-serverGot; !bytes.Equal(got, want) {
+			t.Errorf("server got %v, want %v", got, want)
+		}
+	}
+}
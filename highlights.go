@@ -0,0 +1,140 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Records the player's own kills, final kills, bed breaks and wins with a timestamp, set with -highlights.
+// Meant to be lined up with a recording of the session afterwards.
+type HighlightLog struct {
+	file   *os.File
+	writer *csv.Writer // nil writes to the standard log instead
+	events []string    // From -highlight-events
+	mutex  sync.Mutex
+}
+
+// Nil unless -highlights is set
+var highlightLog *HighlightLog
+
+var highlightEvents = []string{"kill", "final_kill", "bed", "win"}
+
+var highlightLogHeader = []string{"time", "event", "player", "detail", "mode", "map"}
+
+// Milliseconds so events can be told apart within a fight
+const highlightTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// Hypixel's kill messages differ in the verb but all end with the killer, e.g.
+// "Steve was knocked into the void by Alex. FINAL KILL!"
+var killMessageRegex = regexp.MustCompile(`^(\.?\w{1,16}) .+ by (\.?\w{1,16})\.( FINAL KILL!)?$`)
+
+// e.g. "BED DESTRUCTION > Red Bed was destroyed by Alex!"
+var bedDestructionRegex = regexp.MustCompile(`^BED DESTRUCTION > (.+?) was .+ by (\.?\w{1,16})!$`)
+
+// Appends to the CSV file at path like openCommandLog, recording only the events listed in events
+// (comma separated). A path of "-" logs them with the standard log instead.
+func openHighlightLog(path string, events string) (*HighlightLog, error) {
+	hl := &HighlightLog{}
+	for _, event := range strings.Split(events, ",") {
+		event = strings.TrimSpace(event)
+		if !slices.Contains(highlightEvents, event) {
+			return nil, fmt.Errorf("Unknown highlight event %q, the events are %s", event, strings.Join(highlightEvents, ", "))
+		}
+		hl.events = append(hl.events, event)
+	}
+	if path == "-" {
+		return hl, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	hl.file = file
+	hl.writer = csv.NewWriter(file)
+	if info.Size() == 0 {
+		hl.writer.Write(highlightLogHeader)
+		hl.writer.Flush()
+		if err := hl.writer.Error(); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return hl, nil
+}
+
+func (hl *HighlightLog) close() error {
+	if hl.file == nil {
+		return nil
+	}
+	return hl.file.Close()
+}
+
+func (hl *HighlightLog) record(event string, player string, detail string, mode string, mapName string) {
+	if !slices.Contains(hl.events, event) {
+		return
+	}
+	if hl.writer == nil {
+		if detail != "" {
+			detail = ", " + detail
+		}
+		log.Printf("Highlight %s by %s%s (%s on %s)", event, player, detail, mode, mapName)
+		return
+	}
+
+	hl.mutex.Lock()
+	defer hl.mutex.Unlock()
+	hl.writer.Write([]string{time.Now().Format(highlightTimeFormat), event, player, detail, mode, mapName})
+	hl.writer.Flush()
+	if err := hl.writer.Error(); err != nil {
+		log.Println("Failed to write to the highlight log:", err)
+	}
+}
+
+// Records a highlight of the player in the current game, if -highlights is set
+func (p *Proxy) recordHighlight(event string, detail string) {
+	if highlightLog == nil {
+		return
+	}
+	p.commandMutex.Lock()
+	mode := p.locrawMode
+	p.commandMutex.Unlock()
+	gameMutex.RLock()
+	mapName := game.mapName
+	gameMutex.RUnlock()
+
+	highlightLog.record(event, p.username, detail, mode, mapName)
+}
+
+// Records the player's kills and bed breaks from a clientbound chat message as text
+func (p *Proxy) detectHighlights(message string) {
+	if highlightLog == nil || p.username == "" {
+		return
+	}
+	if match := killMessageRegex.FindStringSubmatch(message); match != nil && match[2] == p.username {
+		if match[3] != "" {
+			p.recordHighlight("final_kill", match[1])
+		} else {
+			p.recordHighlight("kill", match[1])
+		}
+	} else if match := bedDestructionRegex.FindStringSubmatch(message); match != nil && match[2] == p.username {
+		p.recordHighlight("bed", match[1])
+	}
+}
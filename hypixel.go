@@ -7,53 +7,145 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 )
 
 type Locraw struct {
 	Server   string `json:"server"`
 	GameType string `json:"gametype"`
 	Mode     string `json:"mode"`
+	Map      string `json:"map"`
 }
 
+const defaultHypixelAPIURL = "https://api.hypixel.net/v2"
+
 type Hypixel struct {
-	apiKey string
+	apiKey  string
+	baseURL string // Without a trailing slash, can point to a mirror of the API
+	// Keyed by UUID without dashes, entries are fresh for config.StatsCacheTTL
+	stats *Cache[*PlayerStats]
+}
+
+func newHypixel(apiKey string, baseURL string) *Hypixel {
+	return &Hypixel{apiKey, strings.TrimSuffix(baseURL, "/"), newCache[*PlayerStats]()}
+}
+
+// Builds the URL for an endpoint of the API, e.g. "/player"
+func (h *Hypixel) endpoint(path string, params url.Values) string {
+	if len(params) == 0 {
+		return h.baseURL + path
+	}
+	return h.baseURL + path + "?" + params.Encode()
+}
+
+var RateLimited = errors.New("Rate limited")
+var InvalidKey = errors.New("Invalid API key")
+var PlayerNotFound = errors.New("Player not found")
+var BadRequest = errors.New("Bad request")
+var APIUnavailable = errors.New("API unavailable")
+
+// Error for an unsuccessful Hypixel API response, Err is one of the errors above so errors.Is works on it
+type HypixelError struct {
+	StatusCode int
+	Cause      string // From the response, empty if there was none
+	Err        error
+}
+
+func (e *HypixelError) Error() string {
+	if e.Cause == "" {
+		return fmt.Sprintf("%s (%d)", e.Err, e.StatusCode)
+	}
+	return fmt.Sprintf("%s (%d): %s", e.Err, e.StatusCode, e.Cause)
 }
 
-func newHypixel(apiKey string) *Hypixel {
-	return &Hypixel{apiKey}
+func (e *HypixelError) Unwrap() error {
+	return e.Err
 }
 
-// True if valid API key
-func (h *Hypixel) testKey() (bool, error) {
-	req, err := http.NewRequest("GET", "https://api.hypixel.net/v2/player?uuid=0", nil)
+func newHypixelError(resp *http.Response) *HypixelError {
+	var body struct {
+		Cause string `json:"cause"`
+	}
+	// Not every response has a JSON body
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&body)
+
+	var err error
+	switch {
+	case resp.StatusCode == http.StatusForbidden:
+		err = InvalidKey
+	case resp.StatusCode == http.StatusTooManyRequests:
+		err = RateLimited
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnprocessableEntity:
+		err = BadRequest
+	default:
+		err = APIUnavailable
+	}
+	return &HypixelError{resp.StatusCode, body.Cause, err}
+}
+
+// Turns a Hypixel API error into the key of a message for the client
+func hypixelErrorKey(err error) string {
+	switch {
+	case errors.Is(err, RateLimited):
+		return "error.rate_limited"
+	case errors.Is(err, InvalidKey):
+		return "error.invalid_key"
+	case errors.Is(err, PlayerNotFound):
+		return "error.player_not_found"
+	case errors.Is(err, APIUnavailable):
+		return "error.api_unavailable"
+	default:
+		return "error.stats_fetch"
+	}
+}
+
+// Returns nil if the API key is valid, otherwise InvalidKey or another error
+func (h *Hypixel) testKey() error {
+	req, err := http.NewRequest("GET", h.endpoint("/player", url.Values{"uuid": {"0"}}), nil)
 	if err != nil {
-		return false, err
+		return err
 	}
 
 	req.Header.Add("API-Key", h.apiKey)
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return false, err
+		return err
 	}
+	defer resp.Body.Close()
 
-	if resp.StatusCode != 422 {
-		return false, nil
+	// A valid key gets past the key check to the invalid UUID
+	if resp.StatusCode == http.StatusUnprocessableEntity {
+		return nil
 	}
-	return true, nil
+	return newHypixelError(resp)
 }
 
 type PlayerStats struct {
 	Success bool `json:"success"`
-	Player  struct {
-		Achievements struct {
+	Player  *struct {
+		DisplayName        string `json:"displayname"`
+		Rank               string `json:"rank"`
+		PackageRank        string `json:"packageRank"`
+		NewPackageRank     string `json:"newPackageRank"`
+		MonthlyPackageRank string `json:"monthlyPackageRank"`
+		RankPlusColor      string `json:"rankPlusColor"`
+		MonthlyRankColor   string `json:"monthlyRankColor"`
+		Prefix             string `json:"prefix"`
+		LastLogin          int64  `json:"lastLogin"` // Missing if the player hid their online status from the API
+		Achievements       struct {
 			BedwarsLevel int `json:"bedwars_level"`
 		} `json:"achievements"`
 		Stats struct {
 			Bedwars struct {
+				// Overall
+				Experience  float64 `json:"Experience"`
+				GamesPlayed int     `json:"games_played_bedwars"`
+
 				// Solo
 				EightOneKillsBedwars       int `json:"eight_one_kills_bedwars"`
 				EightOneDeathsBedwars      int `json:"eight_one_deaths_bedwars"`
@@ -63,6 +155,8 @@ type PlayerStats struct {
 				EightOneLossesBedwars      int `json:"eight_one_losses_bedwars"`
 				EightOneWinstreak          int `json:"eight_one_winstreak"`
 				EightOneBedsBroken         int `json:"eight_one_beds_broken_bedwars"`
+				EightOneBedsLost           int `json:"eight_one_beds_lost_bedwars"`
+				EightOneGamesPlayed        int `json:"eight_one_games_played_bedwars"`
 
 				// Doubles
 				EightTwoKillsBedwars       int `json:"eight_two_kills_bedwars"`
@@ -73,6 +167,8 @@ type PlayerStats struct {
 				EightTwoLossesBedwars      int `json:"eight_two_losses_bedwars"`
 				EightTwoWinstreak          int `json:"eight_two_winstreak"`
 				EightTwoBedsBroken         int `json:"eight_two_beds_broken_bedwars"`
+				EightTwoBedsLost           int `json:"eight_two_beds_lost_bedwars"`
+				EightTwoGamesPlayed        int `json:"eight_two_games_played_bedwars"`
 
 				// 3v3v3v3
 				FourThreeKillsBedwars       int `json:"four_three_kills_bedwars"`
@@ -83,6 +179,8 @@ type PlayerStats struct {
 				FourThreeLossesBedwars      int `json:"four_three_losses_bedwars"`
 				FourThreeWinstreak          int `json:"four_three_winstreak"`
 				FourThreeBedsBroken         int `json:"four_three_beds_broken_bedwars"`
+				FourThreeBedsLost           int `json:"four_three_beds_lost_bedwars"`
+				FourThreeGamesPlayed        int `json:"four_three_games_played_bedwars"`
 
 				// 4v4v4v4
 				FourFourKillsBedwars       int `json:"four_four_kills_bedwars"`
@@ -93,6 +191,8 @@ type PlayerStats struct {
 				FourFourLossesBedwars      int `json:"four_four_losses_bedwars"`
 				FourFourWinstreak          int `json:"four_four_winstreak"`
 				FourFourBedsBroken         int `json:"four_four_beds_broken_bedwars"`
+				FourFourBedsLost           int `json:"four_four_beds_lost_bedwars"`
+				FourFourGamesPlayed        int `json:"four_four_games_played_bedwars"`
 
 				// 4v4
 				TwoFourKillsBedwars       int `json:"two_four_kills_bedwars"`
@@ -103,11 +203,84 @@ type PlayerStats struct {
 				TwoFourLossesBedwars      int `json:"two_four_losses_bedwars"`
 				TwoFourWinstreak          int `json:"two_four_winstreak"`
 				TwoFourBedsBroken         int `json:"two_four_beds_broken_bedwars"`
+				TwoFourBedsLost           int `json:"two_four_beds_lost_bedwars"`
+				TwoFourGamesPlayed        int `json:"two_four_games_played_bedwars"`
 			} `json:"Bedwars"`
 		} `json:"stats"`
 	} `json:"player"`
 }
 
+var colorCodes = map[string]string{
+	"BLACK":        "§0",
+	"DARK_BLUE":    "§1",
+	"DARK_GREEN":   "§2",
+	"DARK_AQUA":    "§3",
+	"DARK_RED":     "§4",
+	"DARK_PURPLE":  "§5",
+	"GOLD":         "§6",
+	"GRAY":         "§7",
+	"DARK_GRAY":    "§8",
+	"BLUE":         "§9",
+	"GREEN":        "§a",
+	"AQUA":         "§b",
+	"RED":          "§c",
+	"LIGHT_PURPLE": "§d",
+	"YELLOW":       "§e",
+	"WHITE":        "§f",
+}
+
+// Ranks from the "rank" field, only set for staff and special ranks
+var specialRanks = map[string]string{
+	"ADMIN":       "§c[ADMIN] ",
+	"GAME_MASTER": "§2[GM] ",
+	"MODERATOR":   "§2[MOD] ",
+	"HELPER":      "§9[HELPER] ",
+	"YOUTUBER":    "§c[§fYOUTUBE§c] ",
+}
+
+func colorCode(name string, fallback string) string {
+	if code, ok := colorCodes[name]; ok {
+		return code
+	}
+	return fallback
+}
+
+// Formats the rank the way it shows in-game, e.g. "§6[MVP§c++§6] ". Players without a rank get "§7".
+// A custom prefix takes precedence, then special ranks, MVP++ and the bought ranks.
+func (ps *PlayerStats) rankPrefix() string {
+	player := ps.Player
+	if player.Prefix != "" {
+		return player.Prefix + " "
+	}
+	if rank, ok := specialRanks[player.Rank]; ok {
+		return rank
+	}
+
+	plusColor := colorCode(player.RankPlusColor, "§c")
+	if player.MonthlyPackageRank == "SUPERSTAR" {
+		nameColor := colorCode(player.MonthlyRankColor, "§6")
+		return nameColor + "[MVP" + plusColor + "++" + nameColor + "] "
+	}
+
+	// Older accounts only have packageRank
+	packageRank := player.NewPackageRank
+	if packageRank == "" {
+		packageRank = player.PackageRank
+	}
+	switch packageRank {
+	case "MVP_PLUS":
+		return "§b[MVP" + plusColor + "+§b] "
+	case "MVP":
+		return "§b[MVP] "
+	case "VIP_PLUS":
+		return "§a[VIP§6+§a] "
+	case "VIP":
+		return "§a[VIP] "
+	default:
+		return "§7"
+	}
+}
+
 type BedwarsType string
 
 const (
@@ -119,16 +292,21 @@ const (
 )
 
 var bedwarsTypeStrings = map[string]BedwarsType{
-	"solo":               BedwarsTypeSolo,
-	"doubles":            BedwarsTypeDoubles,
-	"3v3v3v3":            BedwarsType3v3v3v3,
-	"4v4v4v4":            BedwarsType4v4v4v4,
-	"4v4":                BedwarsType4v4,
-	"BEDWARS_EIGHT_ONE":  BedwarsTypeSolo,
-	"BEDWARS_EIGHT_TWO":  BedwarsTypeDoubles,
-	"BEDWARS_FOUR_THREE": BedwarsType3v3v3v3,
-	"BEDWARS_FOUR_FOUR":  BedwarsType4v4v4v4,
-	"BEDWARS_TWO_FOUR":   BedwarsType4v4,
+	"solo":    BedwarsTypeSolo,
+	"doubles": BedwarsTypeDoubles,
+	"3v3v3v3": BedwarsType3v3v3v3,
+	"4v4v4v4": BedwarsType4v4v4v4,
+	"4v4":     BedwarsType4v4,
+}
+
+// Hypixel's mode identifiers as reported by /locraw, without the BEDWARS_ prefix.
+// Dream modes (e.g. EIGHT_TWO_RUSH) have their own stats and are deliberately not mapped.
+var locrawModes = map[string]BedwarsType{
+	"EIGHT_ONE":  BedwarsTypeSolo,
+	"EIGHT_TWO":  BedwarsTypeDoubles,
+	"FOUR_THREE": BedwarsType3v3v3v3,
+	"FOUR_FOUR":  BedwarsType4v4v4v4,
+	"TWO_FOUR":   BedwarsType4v4,
 }
 
 type BedwarsStats struct {
@@ -144,18 +322,38 @@ type BedwarsStats struct {
 	WL          float32
 	Winstreak   int
 	BedsBroken  int
+	BedsLost    int
+	BBLR        float32
+	GamesPlayed int
+	DisplayName string
+	Rank        string // Formatted rank to put in front of the name, ends in the name's color
 }
 
+// Looks up a BedwarsType by its name, ok is false for unknown strings
 func GetBedwarsType(s string) (BedwarsType, bool) {
 	bedwarsType, ok := bedwarsTypeStrings[s]
 	return bedwarsType, ok
 }
 
+// Looks up a BedwarsType by the mode from /locraw, e.g. "BEDWARS_EIGHT_TWO" or "EIGHT_TWO"
+func GetLocrawBedwarsType(mode string) (BedwarsType, bool) {
+	bedwarsType, ok := locrawModes[strings.TrimPrefix(strings.ToUpper(mode), "BEDWARS_")]
+	return bedwarsType, ok
+}
+
 func (h *Hypixel) getPlayerStats(uuid string) (*PlayerStats, error) {
+	cacheKey := strings.ToLower(strings.ReplaceAll(uuid, "-", ""))
+	ttl := getConfig().StatsCacheTTL
+	if ttl > 0 {
+		if playerStats, ok := h.stats.get(cacheKey, ttl); ok {
+			return playerStats, nil
+		}
+	}
+
 	params := url.Values{}
 	params.Add("uuid", uuid)
 
-	req, err := http.NewRequest("GET", "https://api.hypixel.net/v2/player"+"?"+params.Encode(), nil)
+	req, err := http.NewRequest("GET", h.endpoint("/player", params), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -166,8 +364,9 @@ func (h *Hypixel) getPlayerStats(uuid string) (*PlayerStats, error) {
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode != 200 {
-		return nil, errors.New("Bad response")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, newHypixelError(resp)
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -180,6 +379,14 @@ func (h *Hypixel) getPlayerStats(uuid string) (*PlayerStats, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Hypixel answers with a null player for players that have never joined
+	if playerStats.Player == nil {
+		return nil, &HypixelError{resp.StatusCode, "", PlayerNotFound}
+	}
+
+	if ttl > 0 {
+		h.stats.put(cacheKey, &playerStats, getConfig().CacheSize)
+	}
 
 	return &playerStats, nil
 }
@@ -189,15 +396,101 @@ func (h *Hypixel) getBedwarsStats(uuid string, bedwarsType BedwarsType) (*Bedwar
 	if err != nil {
 		return nil, err
 	}
+	return playerStats.bedwarsStats(bedwarsType)
+}
+
+type Status struct {
+	Success bool `json:"success"`
+	Session struct {
+		Online   bool   `json:"online"`
+		GameType string `json:"gameType"`
+		Mode     string `json:"mode"`
+		Map      string `json:"map"`
+	} `json:"session"`
+}
+
+// Gets whether the player is online and what they are playing. Players that hid their online status
+// are always offline here.
+func (h *Hypixel) getStatus(uuid string) (*Status, error) {
+	params := url.Values{}
+	params.Add("uuid", uuid)
+
+	req, err := http.NewRequest("GET", h.endpoint("/status", params), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("API-Key", h.apiKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, newHypixelError(resp)
+	}
+
+	status := Status{}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Games shown by /recent, the API returns up to 100 from the last 3 days
+const maxRecentGames = 5
+
+type RecentGames struct {
+	Success bool `json:"success"`
+	Games   []struct {
+		Date     int64  `json:"date"` // Unix milliseconds
+		GameType string `json:"gameType"`
+		Mode     string `json:"mode"`
+		Map      string `json:"map"`
+		Ended    int64  `json:"ended"` // Missing while the game is still going
+	} `json:"games"`
+}
+
+// Gets the player's most recent games, newest first. Players can hide them, the list is empty then.
+func (h *Hypixel) getRecentGames(uuid string) (*RecentGames, error) {
+	params := url.Values{}
+	params.Add("uuid", uuid)
+
+	req, err := http.NewRequest("GET", h.endpoint("/recentgames", params), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("API-Key", h.apiKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, newHypixelError(resp)
+	}
+
+	recentGames := RecentGames{}
+	if err := json.NewDecoder(resp.Body).Decode(&recentGames); err != nil {
+		return nil, err
+	}
+	return &recentGames, nil
+}
 
+// Picks the stats of bedwarsType out of all of the player's stats
+func (ps *PlayerStats) bedwarsStats(bedwarsType BedwarsType) (*BedwarsStats, error) {
 	switch bedwarsType {
 	case BedwarsTypeSolo:
-		statsBedwars := playerStats.Player.Stats.Bedwars
-		KD := float32(statsBedwars.EightOneKillsBedwars) / float32(statsBedwars.EightOneDeathsBedwars)
-		FinalKD := float32(statsBedwars.EightOneFinalKillsBedwars) / float32(statsBedwars.EightOneFinalDeathsBedwars)
-		WL := float32(statsBedwars.EightOneWinsBedwars) / float32(statsBedwars.EightOneLossesBedwars)
+		statsBedwars := ps.Player.Stats.Bedwars
+		KD := statRatio(statsBedwars.EightOneKillsBedwars, statsBedwars.EightOneDeathsBedwars)
+		FinalKD := statRatio(statsBedwars.EightOneFinalKillsBedwars, statsBedwars.EightOneFinalDeathsBedwars)
+		WL := statRatio(statsBedwars.EightOneWinsBedwars, statsBedwars.EightOneLossesBedwars)
+		BBLR := statRatio(statsBedwars.EightOneBedsBroken, statsBedwars.EightOneBedsLost)
 		return &BedwarsStats{
-			playerStats.Player.Achievements.BedwarsLevel,
+			ps.Player.Achievements.BedwarsLevel,
 			statsBedwars.EightOneKillsBedwars,
 			statsBedwars.EightOneDeathsBedwars,
 			KD,
@@ -209,14 +502,20 @@ func (h *Hypixel) getBedwarsStats(uuid string, bedwarsType BedwarsType) (*Bedwar
 			WL,
 			statsBedwars.EightOneWinstreak,
 			statsBedwars.EightOneBedsBroken,
+			statsBedwars.EightOneBedsLost,
+			BBLR,
+			statsBedwars.EightOneGamesPlayed,
+			ps.Player.DisplayName,
+			ps.rankPrefix(),
 		}, nil
 	case BedwarsTypeDoubles:
-		statsBedwars := playerStats.Player.Stats.Bedwars
-		KD := float32(statsBedwars.EightTwoKillsBedwars) / float32(statsBedwars.EightTwoDeathsBedwars)
-		FinalKD := float32(statsBedwars.EightTwoFinalKillsBedwars) / float32(statsBedwars.EightTwoFinalDeathsBedwars)
-		WL := float32(statsBedwars.EightTwoWinsBedwars) / float32(statsBedwars.EightTwoLossesBedwars)
+		statsBedwars := ps.Player.Stats.Bedwars
+		KD := statRatio(statsBedwars.EightTwoKillsBedwars, statsBedwars.EightTwoDeathsBedwars)
+		FinalKD := statRatio(statsBedwars.EightTwoFinalKillsBedwars, statsBedwars.EightTwoFinalDeathsBedwars)
+		WL := statRatio(statsBedwars.EightTwoWinsBedwars, statsBedwars.EightTwoLossesBedwars)
+		BBLR := statRatio(statsBedwars.EightTwoBedsBroken, statsBedwars.EightTwoBedsLost)
 		return &BedwarsStats{
-			playerStats.Player.Achievements.BedwarsLevel,
+			ps.Player.Achievements.BedwarsLevel,
 			statsBedwars.EightTwoKillsBedwars,
 			statsBedwars.EightTwoDeathsBedwars,
 			KD,
@@ -228,14 +527,20 @@ func (h *Hypixel) getBedwarsStats(uuid string, bedwarsType BedwarsType) (*Bedwar
 			WL,
 			statsBedwars.EightTwoWinstreak,
 			statsBedwars.EightTwoBedsBroken,
+			statsBedwars.EightTwoBedsLost,
+			BBLR,
+			statsBedwars.EightTwoGamesPlayed,
+			ps.Player.DisplayName,
+			ps.rankPrefix(),
 		}, nil
 	case BedwarsType3v3v3v3:
-		statsBedwars := playerStats.Player.Stats.Bedwars
-		KD := float32(statsBedwars.FourThreeKillsBedwars) / float32(statsBedwars.FourThreeDeathsBedwars)
-		FinalKD := float32(statsBedwars.FourThreeFinalKillsBedwars) / float32(statsBedwars.FourThreeFinalDeathsBedwars)
-		WL := float32(statsBedwars.FourThreeWinsBedwars) / float32(statsBedwars.FourThreeLossesBedwars)
+		statsBedwars := ps.Player.Stats.Bedwars
+		KD := statRatio(statsBedwars.FourThreeKillsBedwars, statsBedwars.FourThreeDeathsBedwars)
+		FinalKD := statRatio(statsBedwars.FourThreeFinalKillsBedwars, statsBedwars.FourThreeFinalDeathsBedwars)
+		WL := statRatio(statsBedwars.FourThreeWinsBedwars, statsBedwars.FourThreeLossesBedwars)
+		BBLR := statRatio(statsBedwars.FourThreeBedsBroken, statsBedwars.FourThreeBedsLost)
 		return &BedwarsStats{
-			playerStats.Player.Achievements.BedwarsLevel,
+			ps.Player.Achievements.BedwarsLevel,
 			statsBedwars.FourThreeKillsBedwars,
 			statsBedwars.FourThreeDeathsBedwars,
 			KD,
@@ -247,14 +552,20 @@ func (h *Hypixel) getBedwarsStats(uuid string, bedwarsType BedwarsType) (*Bedwar
 			WL,
 			statsBedwars.FourThreeWinstreak,
 			statsBedwars.FourThreeBedsBroken,
+			statsBedwars.FourThreeBedsLost,
+			BBLR,
+			statsBedwars.FourThreeGamesPlayed,
+			ps.Player.DisplayName,
+			ps.rankPrefix(),
 		}, nil
 	case BedwarsType4v4v4v4:
-		statsBedwars := playerStats.Player.Stats.Bedwars
-		KD := float32(statsBedwars.FourFourKillsBedwars) / float32(statsBedwars.FourFourDeathsBedwars)
-		FinalKD := float32(statsBedwars.FourFourFinalKillsBedwars) / float32(statsBedwars.FourFourFinalDeathsBedwars)
-		WL := float32(statsBedwars.FourFourWinsBedwars) / float32(statsBedwars.FourFourLossesBedwars)
+		statsBedwars := ps.Player.Stats.Bedwars
+		KD := statRatio(statsBedwars.FourFourKillsBedwars, statsBedwars.FourFourDeathsBedwars)
+		FinalKD := statRatio(statsBedwars.FourFourFinalKillsBedwars, statsBedwars.FourFourFinalDeathsBedwars)
+		WL := statRatio(statsBedwars.FourFourWinsBedwars, statsBedwars.FourFourLossesBedwars)
+		BBLR := statRatio(statsBedwars.FourFourBedsBroken, statsBedwars.FourFourBedsLost)
 		return &BedwarsStats{
-			playerStats.Player.Achievements.BedwarsLevel,
+			ps.Player.Achievements.BedwarsLevel,
 			statsBedwars.FourFourKillsBedwars,
 			statsBedwars.FourFourDeathsBedwars,
 			KD,
@@ -266,14 +577,20 @@ func (h *Hypixel) getBedwarsStats(uuid string, bedwarsType BedwarsType) (*Bedwar
 			WL,
 			statsBedwars.FourFourWinstreak,
 			statsBedwars.FourFourBedsBroken,
+			statsBedwars.FourFourBedsLost,
+			BBLR,
+			statsBedwars.FourFourGamesPlayed,
+			ps.Player.DisplayName,
+			ps.rankPrefix(),
 		}, nil
 	case BedwarsType4v4:
-		statsBedwars := playerStats.Player.Stats.Bedwars
-		KD := float32(statsBedwars.TwoFourKillsBedwars) / float32(statsBedwars.TwoFourDeathsBedwars)
-		FinalKD := float32(statsBedwars.TwoFourFinalKillsBedwars) / float32(statsBedwars.TwoFourFinalDeathsBedwars)
-		WL := float32(statsBedwars.TwoFourWinsBedwars) / float32(statsBedwars.TwoFourLossesBedwars)
+		statsBedwars := ps.Player.Stats.Bedwars
+		KD := statRatio(statsBedwars.TwoFourKillsBedwars, statsBedwars.TwoFourDeathsBedwars)
+		FinalKD := statRatio(statsBedwars.TwoFourFinalKillsBedwars, statsBedwars.TwoFourFinalDeathsBedwars)
+		WL := statRatio(statsBedwars.TwoFourWinsBedwars, statsBedwars.TwoFourLossesBedwars)
+		BBLR := statRatio(statsBedwars.TwoFourBedsBroken, statsBedwars.TwoFourBedsLost)
 		return &BedwarsStats{
-			playerStats.Player.Achievements.BedwarsLevel,
+			ps.Player.Achievements.BedwarsLevel,
 			statsBedwars.TwoFourKillsBedwars,
 			statsBedwars.TwoFourDeathsBedwars,
 			KD,
@@ -285,6 +602,11 @@ func (h *Hypixel) getBedwarsStats(uuid string, bedwarsType BedwarsType) (*Bedwar
 			WL,
 			statsBedwars.TwoFourWinstreak,
 			statsBedwars.TwoFourBedsBroken,
+			statsBedwars.TwoFourBedsLost,
+			BBLR,
+			statsBedwars.TwoFourGamesPlayed,
+			ps.Player.DisplayName,
+			ps.rankPrefix(),
 		}, nil
 	default:
 		return nil, errors.New("Invalid BedwarsType")
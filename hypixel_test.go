@@ -0,0 +1,83 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// Callers use the two-value form, bedwarsType, ok := GetBedwarsType(...)
+var _ func(string) (BedwarsType, bool) = GetBedwarsType
+
+func TestGetBedwarsType(t *testing.T) {
+	tests := []struct {
+		mode   string
+		want   BedwarsType
+		wantOK bool
+	}{
+		{"solo", BedwarsTypeSolo, true},
+		{"doubles", BedwarsTypeDoubles, true},
+		{"3v3v3v3", BedwarsType3v3v3v3, true},
+		{"4v4v4v4", BedwarsType4v4v4v4, true},
+		{"4v4", BedwarsType4v4, true},
+		// Callers lowercase what the player typed
+		{"Solo", "", false},
+		{"", "", false},
+		{"squads", "", false},
+		{"EIGHT_ONE", "", false},
+		{" solo", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := GetBedwarsType(tt.mode)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("GetBedwarsType(%q) = %q, %v, want %q, %v", tt.mode, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestGetLocrawBedwarsType(t *testing.T) {
+	tests := []struct {
+		name   string
+		locraw string
+		want   BedwarsType
+		wantOK bool
+	}{
+		{"solo", `{"server":"mini113F","gametype":"BEDWARS","mode":"BEDWARS_EIGHT_ONE","map":"Lighthouse"}`, BedwarsTypeSolo, true},
+		{"doubles", `{"server":"mini301H","gametype":"BEDWARS","mode":"BEDWARS_EIGHT_TWO","map":"Aquarium"}`, BedwarsTypeDoubles, true},
+		{"3v3v3v3", `{"server":"mini88B","gametype":"BEDWARS","mode":"BEDWARS_FOUR_THREE","map":"Pernicious"}`, BedwarsType3v3v3v3, true},
+		{"4v4v4v4", `{"server":"mini42C","gametype":"BEDWARS","mode":"BEDWARS_FOUR_FOUR","map":"Archway"}`, BedwarsType4v4v4v4, true},
+		{"4v4", `{"server":"mini7D","gametype":"BEDWARS","mode":"BEDWARS_TWO_FOUR","map":"Cascade"}`, BedwarsType4v4, true},
+		{"without prefix", `{"server":"mini301H","gametype":"BEDWARS","mode":"EIGHT_TWO","map":"Aquarium"}`, BedwarsTypeDoubles, true},
+		{"lowercase", `{"server":"mini301H","gametype":"BEDWARS","mode":"bedwars_eight_two","map":"Aquarium"}`, BedwarsTypeDoubles, true},
+		{"lobby", `{"server":"dynamiclobby35C","gametype":"BEDWARS","lobbyname":"bedwarslobby6"}`, "", false},
+		{"lobby mode", `{"server":"dynamiclobby35C","gametype":"BEDWARS","mode":"LOBBY"}`, "", false},
+		{"limbo", `{"server":"limbo"}`, "", false},
+		{"main lobby", `{"server":"lobby12","gametype":"MAIN","lobbyname":"mainlobby3"}`, "", false},
+		{"dream mode", `{"server":"mini55A","gametype":"BEDWARS","mode":"BEDWARS_EIGHT_TWO_RUSH","map":"Lotus"}`, "", false},
+		{"dream 4v4v4v4", `{"server":"mini55A","gametype":"BEDWARS","mode":"BEDWARS_FOUR_FOUR_ULTIMATE","map":"Lotus"}`, "", false},
+		{"other game", `{"server":"mini12B","gametype":"SKYWARS","mode":"solo_normal","map":"Elven"}`, "", false},
+		{"unknown", `{"server":"mini12B","gametype":"BEDWARS","mode":"BEDWARS_CASTLE","map":"Keep"}`, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			locraw := Locraw{}
+			if err := json.Unmarshal([]byte(tt.locraw), &locraw); err != nil {
+				t.Fatal(err)
+			}
+			got, ok := GetLocrawBedwarsType(locraw.Mode)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("GetLocrawBedwarsType(%q) = %q, %v, want %q, %v", locraw.Mode, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	// Every mode in the table maps to a type /sc knows
+	for mode, bedwarsType := range locrawModes {
+		if _, ok := GetBedwarsType(string(bedwarsType)); !ok {
+			t.Errorf("locraw mode %s maps to the unknown type %q", mode, bedwarsType)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"io"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Packets the proxy writes itself are queued per direction and written between forwarded packets.
+// The injecting goroutine writes them right away if nothing is being written in that direction,
+// otherwise the goroutine holding the write mutex writes them once it has released it, see writeToDst.
+
+// Clientbound packets waiting to be written, the oldest are dropped when a client stops reading
+const maxClientboundQueue = 256
+
+// Returns the mutex held while writing a packet in the direction
+func (p *Proxy) writeMutex(clientToServer bool) *sync.Mutex {
+	if clientToServer {
+		return &p.serverWriteMutex
+	}
+	return &p.clientWriteMutex
+}
+
+// Queues a proxy-injected clientbound packet (packet ID + data), it is framed when written since the
+// threshold can change in the meantime
+func (p *Proxy) injectClientbound(packet []byte, clientConn io.Writer) error {
+	p.clientboundMutex.Lock()
+	p.clientboundQueue = append(p.clientboundQueue, packet)
+	if overflow := len(p.clientboundQueue) - maxClientboundQueue; overflow > 0 {
+		p.logger.Printf("Clientbound queue is full, dropped %d injected packet(s)", overflow)
+		p.clientboundQueue = p.clientboundQueue[overflow:]
+	}
+	p.clientboundMutex.Unlock()
+
+	return p.drainInjected(clientConn, false)
+}
+
+// Writes the injected packets queued for the direction, unless a packet is being written in it. The
+// serverbound queue is only written in the Play state.
+func (p *Proxy) drainInjected(w io.Writer, clientToServer bool) error {
+	if clientToServer {
+		if p.getState() != StatePlay {
+			return nil
+		}
+		return p.flushCommandQueue(w)
+	}
+
+	mutex := p.writeMutex(false)
+	for {
+		if !mutex.TryLock() {
+			return nil
+		}
+		err := p.writeClientboundQueueLocked(w)
+		mutex.Unlock()
+		if err != nil {
+			return err
+		}
+
+		// A packet queued after the queue was found empty but before the mutex was released was
+		// left to this goroutine by its injector, which couldn't take the mutex
+		p.clientboundMutex.Lock()
+		queued := len(p.clientboundQueue)
+		p.clientboundMutex.Unlock()
+		if queued == 0 {
+			return nil
+		}
+	}
+}
+
+// Callers hold the clientbound write mutex
+func (p *Proxy) writeClientboundQueueLocked(w io.Writer) error {
+	for {
+		p.clientboundMutex.Lock()
+		if len(p.clientboundQueue) == 0 {
+			p.clientboundMutex.Unlock()
+			return nil
+		}
+		packet := p.clientboundQueue[0]
+		p.clientboundQueue = p.clientboundQueue[1:]
+		p.clientboundMutex.Unlock()
+
+		reconstructedPacket, err := reconstructPacket(packet, p.getClientThreshold())
+		if err != nil {
+			return err
+		}
+		if err := p.writeToDstLocked(reconstructedPacket, w, false); err != nil {
+			return err
+		}
+	}
+}
+
+// Returns -inject-delay plus a random part of -inject-jitter, applied to every injected command
+func injectionDelay(cfg Config) time.Duration {
+	delay := cfg.InjectDelay
+	if cfg.InjectJitter > 0 {
+		delay += rand.N(cfg.InjectJitter)
+	}
+	return delay
+}
+
+// Flushes the command queue after wait, unless a flush is already scheduled. Callers hold commandMutex.
+func (p *Proxy) scheduleFlushLocked(wait time.Duration) {
+	if p.flushTimer != nil {
+		return
+	}
+	p.flushTimer = time.AfterFunc(wait, func() {
+		p.commandMutex.Lock()
+		p.flushTimer = nil
+		p.commandMutex.Unlock()
+
+		if err := p.flushCommandQueue(p.serverConn); err != nil {
+			p.errorChecker(err)
+		}
+	})
+}
+
+func (p *Proxy) stopFlushTimer() {
+	p.commandMutex.Lock()
+	defer p.commandMutex.Unlock()
+	if p.flushTimer != nil {
+		p.flushTimer.Stop()
+		p.flushTimer = nil
+	}
+}
@@ -0,0 +1,148 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"sync"
+	"testing"
+)
+
+// A writer whose first Write blocks until release is closed
+type blockingWriter struct {
+	mutex   sync.Mutex
+	buf     bytes.Buffer
+	writing chan struct{}
+	release chan struct{}
+	blocked bool
+}
+
+func (w *blockingWriter) Write(b []byte) (int, error) {
+	w.mutex.Lock()
+	first := !w.blocked
+	w.blocked = true
+	w.mutex.Unlock()
+	if first {
+		close(w.writing)
+		<-w.release
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.buf.Write(b)
+}
+
+// Reads the packets written with threshold -1
+func readAllPackets(t *testing.T, b []byte) [][]byte {
+	t.Helper()
+	threshold := -1
+	r := bytes.NewReader(b)
+	var packets [][]byte
+	for r.Len() > 0 {
+		_, packet, err := readPacket(r, &threshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		packets = append(packets, packet)
+	}
+	return packets
+}
+
+func TestInjectClientboundWhileWriting(t *testing.T) {
+	p := &Proxy{logger: log.New(io.Discard, "", 0)}
+	p.setClientThreshold(-1)
+	w := &blockingWriter{writing: make(chan struct{}), release: make(chan struct{})}
+	forwarded := []byte{0x02, 'f'}
+	injected := []byte{0x02, 'i'}
+
+	done := make(chan error)
+	go func() {
+		framed, _ := reconstructPacket(forwarded, -1)
+		done <- p.writeToDst(framed, w, false)
+	}()
+
+	// The forwarded packet holds the write mutex, the injected one is left to its writer
+	<-w.writing
+	if err := p.injectClientbound(injected, w); err != nil {
+		t.Fatal(err)
+	}
+	close(w.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	packets := readAllPackets(t, w.buf.Bytes())
+	if len(packets) != 2 || !bytes.Equal(packets[0], forwarded) || !bytes.Equal(packets[1], injected) {
+		t.Errorf("wrote %q, want the forwarded packet and then the injected one", packets)
+	}
+}
+
+func TestInjectClientboundConcurrent(t *testing.T) {
+	p := &Proxy{logger: log.New(io.Discard, "", 0)}
+	p.setClientThreshold(-1)
+	var w bytes.Buffer
+	// Fewer than maxClientboundQueue, so none are dropped
+	const injectors, perInjector = 4, 50
+
+	var wg sync.WaitGroup
+	for i := range injectors {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range perInjector {
+				if err := p.injectClientbound([]byte{0x02, byte(i), byte(j)}, &w); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Every injector returns after its packet was written or left to a goroutine that writes it
+	if packets := readAllPackets(t, w.Bytes()); len(packets) != injectors*perInjector {
+		t.Errorf("wrote %d packets, want %d", len(packets), injectors*perInjector)
+	}
+	if len(p.clientboundQueue) != 0 {
+		t.Errorf("%d packets are left in the queue", len(p.clientboundQueue))
+	}
+}
+
+// Set Compression in the Play state changes the thresholds while the serverbound goroutine and the
+// flush timers frame packets with them, run with -race
+func TestSetCompressionConcurrent(t *testing.T) {
+	p := &Proxy{logger: log.New(io.Discard, "", 0)}
+	p.setServerThreshold(-1)
+	p.setClientThreshold(-1)
+	p.setState(StatePlay)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := range 50 {
+			if err := p.setCompression(0x46, 256+i, io.Discard); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 50 {
+			if err := p.injectServerbound(createServerboundChatPacket("/locraw"), io.Discard); err != nil {
+				t.Error(err)
+				return
+			}
+			p.injectClientbound([]byte{0x02, 'i'}, io.Discard)
+		}
+	}()
+	wg.Wait()
+
+	if got := p.getServerThreshold(); got != 256+49 {
+		t.Errorf("server threshold %d, want the last one set", got)
+	}
+}
@@ -0,0 +1,144 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"net"
+)
+
+// Uncompressed size from which packets no handler looks at are forwarded without decompressing them
+// into memory in full
+const largePacketSize = 32 * 1024
+
+// Clientbound Play packets that can be large and that no handler looks at, keep this in sync with
+// proxyTraffic. Chunk Data and Map Chunk Bulk are looked at with -bed-alerts.
+var streamablePackets = map[int]bool{
+	0x21: true, // Chunk Data
+	0x26: true, // Map Chunk Bulk
+	0x34: true, // Map
+}
+
+// Reads the next packet from r. Large compressed packets that the proxy doesn't look at are
+// forwarded to dst right away instead.
+// Returns:
+// int: packet length
+// []byte: data (packet ID + data), nil if the packet was forwarded
+// bool: true if the packet was forwarded
+func (p *Proxy) readPacketOrForward(r io.Reader, srcThreshold func() int, dst net.Conn, clientToServer bool) (int, []byte, bool, error) {
+	frame, err := readFrameWithThreshold(r, srcThreshold)
+	if err != nil {
+		return 0, nil, false, err
+	}
+	if frame.packetLength == 0 {
+		return 0, nil, false, nil
+	}
+
+	if !clientToServer && p.getState() == StatePlay && frame.dataLength >= largePacketSize {
+		forwarded, err := p.forwardLargePacket(frame, srcThreshold(), dst)
+		if forwarded || err != nil {
+			return frame.packetLength, nil, forwarded, err
+		}
+	}
+
+	data, err := frame.decompress()
+	return frame.packetLength, data, false, err
+}
+
+// Forwards a large compressed clientbound packet to the client if no handler or rule looks at it.
+// With the same threshold on both sides the packet isn't decompressed at all, otherwise it is
+// decompressed while it is written.
+// Returns:
+// bool: true if the packet was forwarded, false if it has to go through the handlers
+func (p *Proxy) forwardLargePacket(frame *Frame, srcThreshold int, clientConn net.Conn) (bool, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(frame.payload))
+	if err != nil {
+		return false, err
+	}
+	defer zr.Close()
+
+	// Only the start of the packet is decompressed to get the ID
+	packetID, idLength, err := readVarInt(zr)
+	if err != nil {
+		return false, err
+	}
+	if !streamablePackets[packetID] || hasRules(StatePlay, false, packetID) || !packetAllowed(StatePlay, false, packetID) {
+		return false, nil
+	}
+	cfg := getConfig()
+	if cfg.BedAlerts && (packetID == 0x21 || packetID == 0x26) {
+		return false, nil
+	}
+
+	dstThreshold := p.getClientThreshold()
+	if dstThreshold == srcThreshold {
+		return true, p.writeToDst(frame.bytes(), clientConn, false)
+	}
+
+	if dstThreshold != -1 && frame.dataLength >= dstThreshold {
+		// Only the recompressed packet is kept in memory
+		var body bytes.Buffer
+		if err := writeVarInt(&body, frame.dataLength); err != nil {
+			return false, err
+		}
+		zw, err := zlib.NewWriterLevel(&body, cfg.CompressionLevel)
+		if err != nil {
+			return false, err
+		}
+		if err := writeVarInt(zw, packetID); err != nil {
+			return false, err
+		}
+		if _, err := io.CopyN(zw, zr, int64(frame.dataLength-idLength)); err != nil {
+			return false, err
+		}
+		if err := zw.Close(); err != nil {
+			return false, err
+		}
+
+		var framed bytes.Buffer
+		if err := writeVarInt(&framed, body.Len()); err != nil {
+			return false, err
+		}
+		framed.Write(body.Bytes())
+		return true, p.writeToDst(framed.Bytes(), clientConn, false)
+	}
+
+	// The mirror needs the whole packet
+	if mirror != nil {
+		return false, nil
+	}
+
+	// Uncompressed towards the client, it is written while it is decompressed
+	var header bytes.Buffer
+	if dstThreshold == -1 {
+		if err := writeVarInt(&header, frame.dataLength); err != nil {
+			return false, err
+		}
+	} else {
+		// Data length 0 marks the packet as uncompressed
+		if err := writeVarInt(&header, frame.dataLength+1); err != nil {
+			return false, err
+		}
+		header.WriteByte(0)
+	}
+	if err := writeVarInt(&header, packetID); err != nil {
+		return false, err
+	}
+
+	mutex := p.writeMutex(false)
+	mutex.Lock()
+	_, err = clientConn.Write(header.Bytes())
+	if err == nil {
+		_, err = io.CopyN(clientConn, zr, int64(frame.dataLength-idLength))
+	}
+	mutex.Unlock()
+	if err != nil {
+		return true, err
+	}
+	// Like writeToDst, the injected packets that were queued while it was being written
+	return true, p.drainInjected(clientConn, false)
+}
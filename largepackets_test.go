@@ -0,0 +1,143 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"testing"
+)
+
+// A client connection that keeps what is written to it, nothing else is used by forwarding
+type bufferConn struct {
+	net.Conn
+	buf bytes.Buffer
+}
+
+func (c *bufferConn) Write(b []byte) (int, error) {
+	return c.buf.Write(b)
+}
+
+type discardConn struct {
+	net.Conn
+}
+
+func (discardConn) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// A Chunk Data packet of length bytes, about as compressible as a real one
+func testChunkPacket(length int) []byte {
+	packet := make([]byte, length)
+	packet[0] = 0x21
+	for i := 1; i < length; i++ {
+		packet[i] = byte(i/64) ^ byte(i%7)
+	}
+	return packet
+}
+
+func TestForwardLargePacket(t *testing.T) {
+	const serverThreshold = 256
+	packet := testChunkPacket(largePacketSize * 3)
+	framed, err := reconstructPacket(packet, serverThreshold)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		clientThreshold int
+	}{
+		{"same threshold", serverThreshold},
+		{"recompressed", 1024},
+		{"uncompressed", -1},
+		{"below the client's threshold", len(packet) + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Proxy{logger: log.New(io.Discard, "", 0)}
+			p.setClientThreshold(tt.clientThreshold)
+			p.setState(StatePlay)
+			clientConn := &bufferConn{}
+			queued := []byte{0x02, 'i'}
+			p.clientboundQueue = [][]byte{queued}
+
+			srcThreshold := func() int { return serverThreshold }
+			packetLength, data, forwarded, err := p.readPacketOrForward(bytes.NewReader(framed), srcThreshold, clientConn, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !forwarded || data != nil || packetLength == 0 {
+				t.Fatalf("forwarded %v with %d bytes of data, want it forwarded", forwarded, len(data))
+			}
+
+			r := bytes.NewReader(clientConn.buf.Bytes())
+			_, written, err := readPacket(r, &tt.clientThreshold)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(written, packet) {
+				t.Errorf("client got %d bytes that differ from the %d sent", len(written), len(packet))
+			}
+
+			// Injected packets that were queued while it was being forwarded follow it
+			_, injected, err := readPacket(r, &tt.clientThreshold)
+			if err != nil || !bytes.Equal(injected, queued) || r.Len() != 0 {
+				t.Errorf("after the packet got %q (%v) with %d bytes left, want the injected packet", injected, err, r.Len())
+			}
+		})
+	}
+}
+
+// Compares decompressing and reframing a large packet in memory with forwarding it
+func BenchmarkForwardLargePacket(b *testing.B) {
+	const serverThreshold = 256
+	for _, size := range []int{largePacketSize, largePacketSize * 8} {
+		packet := testChunkPacket(size)
+		framed, err := reconstructPacket(packet, serverThreshold)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		for _, clientThreshold := range []int{serverThreshold, -1} {
+			name := fmt.Sprintf("%d bytes threshold %d", size, clientThreshold)
+
+			b.Run(name+" buffered", func(b *testing.B) {
+				b.SetBytes(int64(size))
+				b.ReportAllocs()
+				for range b.N {
+					srcThreshold := serverThreshold
+					_, data, err := readPacket(bytes.NewReader(framed), &srcThreshold)
+					if err != nil {
+						b.Fatal(err)
+					}
+					reconstructed, err := reconstructPacket(data, clientThreshold)
+					if err != nil {
+						b.Fatal(err)
+					}
+					discardConn{}.Write(reconstructed)
+				}
+			})
+
+			b.Run(name+" streaming", func(b *testing.B) {
+				p := &Proxy{logger: log.New(io.Discard, "", 0)}
+				p.setClientThreshold(clientThreshold)
+				p.setState(StatePlay)
+				b.SetBytes(int64(size))
+				b.ReportAllocs()
+				for range b.N {
+					srcThreshold := func() int { return serverThreshold }
+					_, _, forwarded, err := p.readPacketOrForward(bytes.NewReader(framed), srcThreshold, discardConn{}, false)
+					if err != nil || !forwarded {
+						b.Fatalf("forwarded %v: %v", forwarded, err)
+					}
+				}
+			})
+		}
+	}
+}
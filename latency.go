@@ -0,0 +1,142 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+)
+
+// Writes waiting for their delay, a Write blocks once this many are queued
+const maxDelayedWrites = 4096
+
+type delayedWrite struct {
+	data []byte
+	at   time.Time
+}
+
+// Delays every write to a connection to simulate lag, set with -latency and -latency-jitter. Meant for
+// testing. Writes are queued and written in order by a goroutine, jitter never reorders them.
+type delayedConn struct {
+	net.Conn
+	latency time.Duration
+	jitter  time.Duration
+	pending []delayedWrite
+	last    time.Time // When the last queued write is due
+	err     error     // From writing a queued write, returned by the next Write
+	closing bool
+	mutex   sync.Mutex
+	wake    chan struct{} // Tells the writer there is something in pending
+	slots   chan struct{} // Bounds pending
+	closed  chan struct{}
+	done    chan struct{} // Closed when the writer has returned
+
+	closeOnce sync.Once
+}
+
+func newDelayedConn(conn net.Conn, latency time.Duration, jitter time.Duration) *delayedConn {
+	c := &delayedConn{
+		Conn:    conn,
+		latency: latency,
+		jitter:  jitter,
+		wake:    make(chan struct{}, 1),
+		slots:   make(chan struct{}, maxDelayedWrites),
+		closed:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go c.writeDelayed()
+	return c
+}
+
+func (c *delayedConn) Write(b []byte) (int, error) {
+	select {
+	case c.slots <- struct{}{}:
+	case <-c.closed:
+		return 0, net.ErrClosed
+	}
+
+	c.mutex.Lock()
+	if c.err != nil || c.closing {
+		err := c.err
+		c.mutex.Unlock()
+		<-c.slots
+		if err == nil {
+			err = net.ErrClosed
+		}
+		return 0, err
+	}
+	delay := c.latency
+	if c.jitter > 0 {
+		delay += rand.N(c.jitter)
+	}
+	// Never before the write queued before it
+	at := time.Now().Add(delay)
+	if at.Before(c.last) {
+		at = c.last
+	}
+	c.last = at
+	c.pending = append(c.pending, delayedWrite{append([]byte(nil), b...), at})
+	c.mutex.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+	return len(b), nil
+}
+
+func (c *delayedConn) writeDelayed() {
+	defer close(c.done)
+	for {
+		c.mutex.Lock()
+		if len(c.pending) == 0 {
+			closing := c.closing
+			c.mutex.Unlock()
+			if closing {
+				return
+			}
+			<-c.wake
+			continue
+		}
+		write := c.pending[0]
+		c.pending = c.pending[1:]
+		c.mutex.Unlock()
+
+		time.Sleep(time.Until(write.at))
+		_, err := c.Conn.Write(write.data)
+		<-c.slots
+		if err != nil {
+			c.mutex.Lock()
+			c.err = err
+			for range c.pending {
+				<-c.slots
+			}
+			c.pending = nil
+			c.mutex.Unlock()
+			return
+		}
+	}
+}
+
+// Writes what is queued, like a disconnect reason, and closes the connection
+func (c *delayedConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.mutex.Lock()
+		c.closing = true
+		c.mutex.Unlock()
+		close(c.closed)
+		select {
+		case c.wake <- struct{}{}:
+		default:
+		}
+
+		// A peer that stopped reading can't hold up the close
+		c.Conn.SetWriteDeadline(time.Now().Add(c.latency + c.jitter + time.Second))
+		<-c.done
+	})
+	return c.Conn.Close()
+}
@@ -0,0 +1,79 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Formats one line of /sc output, the message keys are "statcheck.stats.<line>"
+var statLines = map[string]func(p *Proxy, s *BedwarsStats) string{
+	"kills": func(p *Proxy, s *BedwarsStats) string {
+		return p.translate("statcheck.stats.kills", s.Kills, s.Deaths, s.KD)
+	},
+	"finals": func(p *Proxy, s *BedwarsStats) string {
+		return p.translate("statcheck.stats.finals", s.FinalKills, s.FinalDeaths, s.FinalKD)
+	},
+	"wins": func(p *Proxy, s *BedwarsStats) string {
+		return p.translate("statcheck.stats.wins", s.Wins, s.Losses, s.WL)
+	},
+	"beds": func(p *Proxy, s *BedwarsStats) string {
+		return p.translate("statcheck.stats.beds", s.BedsBroken, s.BedsLost, s.BBLR)
+	},
+	"winstreak": func(p *Proxy, s *BedwarsStats) string {
+		return p.translate("statcheck.stats.winstreak", s.Winstreak, s.GamesPlayed)
+	},
+}
+
+// The lines of /sc for modes without a layout, in the order /sc has always shown them
+var defaultStatLayout = []string{"kills", "finals", "wins", "beds", "winstreak"}
+
+// The stat lines shown below the header of /sc per mode, from "layouts" in the config file.
+// Modes without a layout use defaultStatLayout.
+var statLayouts map[BedwarsType][]string
+var statLayoutsMutex sync.RWMutex
+
+// Checks the layouts from the config file, which are lists of line names by mode name
+func parseStatLayouts(raw map[string][]string) (map[BedwarsType][]string, error) {
+	layouts := make(map[BedwarsType][]string, len(raw))
+	for mode, lines := range raw {
+		bedwarsType, ok := GetBedwarsType(strings.ToLower(mode))
+		if !ok {
+			return nil, fmt.Errorf("Layout for unknown mode %q", mode)
+		}
+		seen := make(map[string]bool, len(lines))
+		for _, line := range lines {
+			if _, ok := statLines[line]; !ok {
+				return nil, fmt.Errorf("Layout for %s: unknown line %q", bedwarsType, line)
+			}
+			if seen[line] {
+				return nil, fmt.Errorf("Layout for %s: line %q appears more than once", bedwarsType, line)
+			}
+			seen[line] = true
+		}
+		layouts[bedwarsType] = lines
+	}
+	return layouts, nil
+}
+
+// Builds the /sc output for stats in bedwarsType, laid out by the mode's layout if it has one
+func (p *Proxy) formatBedwarsStats(bedwarsType BedwarsType, playerName string, stats *BedwarsStats) string {
+	statLayoutsMutex.RLock()
+	layout, ok := statLayouts[bedwarsType]
+	statLayoutsMutex.RUnlock()
+
+	if !ok {
+		layout = defaultStatLayout
+	}
+
+	mode := capitaliseFirst(string(bedwarsType))
+	lines := []string{p.translate("statcheck.stats.header", mode, stats.Stars, stats.Rank, playerName)}
+	for _, line := range layout {
+		lines = append(lines, statLines[line](p, stats))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,73 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+var testBedwarsStats = &BedwarsStats{
+	Stars: 312, Kills: 1200, Deaths: 800, KD: 1.5,
+	FinalKills: 900, FinalDeaths: 300, FinalKD: 3,
+	Wins: 400, Losses: 200, WL: 2, Winstreak: 4,
+	BedsBroken: 700, BedsLost: 350, BBLR: 2, GamesPlayed: 600,
+	Rank: "§b[MVP§c+§b] ",
+}
+
+func TestFormatBedwarsStatsDefault(t *testing.T) {
+	p := &Proxy{}
+	// What /sc showed before the output could be laid out per mode
+	want := fmt.Sprintf("§l§e%s §6Bedwars Stats for §b§l[%d✫] §r%s%s§r\n"+
+		"§aKills: §f%d, §cDeaths: §f%d, §aK§f/§cD: §f%.2f\n"+
+		"§5Final §2Kills: §f%d, §5Final §4Deaths: §f%d, §5Final §2K§f/§4D: §f%.2f\n"+
+		"§aWins: §f%d, §cLosses: §f%d, §aW§f/§cL: §f%.2f\n"+
+		"§3Beds Broken: §f%d, §4Beds Lost: §f%d, §3B§f/§4L: §f%.2f\n"+
+		"§bWinstreak: §f%d, §7Games Played: §f%d",
+		"Doubles", 312, "§b[MVP§c+§b] ", "Steve", 1200, 800, 1.5, 900, 300, 3.0, 400, 200, 2.0, 700, 350, 2.0, 4, 600)
+	if got := p.formatBedwarsStats(BedwarsTypeDoubles, "Steve", testBedwarsStats); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormatBedwarsStatsLayout(t *testing.T) {
+	layouts, err := parseStatLayouts(map[string][]string{"solo": {"beds", "finals"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	statLayoutsMutex.Lock()
+	statLayouts = layouts
+	statLayoutsMutex.Unlock()
+	t.Cleanup(func() {
+		statLayoutsMutex.Lock()
+		statLayouts = nil
+		statLayoutsMutex.Unlock()
+	})
+
+	p := &Proxy{}
+	want := "§l§eSolo §6Bedwars Stats for §b§l[312✫] §r§b[MVP§c+§b] Steve§r\n" +
+		"§3Beds Broken: §f700, §4Beds Lost: §f350, §3B§f/§4L: §f2.00\n" +
+		"§5Final §2Kills: §f900, §5Final §4Deaths: §f300, §5Final §2K§f/§4D: §f3.00"
+	if got := p.formatBedwarsStats(BedwarsTypeSolo, "Steve", testBedwarsStats); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestParseStatLayouts(t *testing.T) {
+	for _, raw := range []map[string][]string{
+		{"squads": {"kills"}},
+		{"solo": {"kdr"}},
+		{"solo": {"kills", "kills"}},
+	} {
+		if _, err := parseStatLayouts(raw); err == nil {
+			t.Errorf("no error for %v", raw)
+		}
+	}
+	for _, line := range defaultStatLayout {
+		if _, ok := statLines[line]; !ok {
+			t.Errorf("the default layout has the unknown line %q", line)
+		}
+	}
+}
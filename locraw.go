@@ -0,0 +1,58 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"io"
+	"time"
+)
+
+// How long /scupdate waits for the /locraw reply
+const refreshTimeout = 5 * time.Second
+
+// Handles /scupdate by sending /locraw again, for when the game wasn't detected after joining it
+func (p *Proxy) handleRefresh(serverConn io.Writer, clientConn io.Writer) error {
+	if !p.isHypixel.Load() {
+		return p.writeChatMessageToClient("§bGoMCProxy: "+p.translate("refresh.not_hypixel"), ChatTypeChat, clientConn)
+	}
+
+	p.commandMutex.Lock()
+	if p.refreshTimer != nil {
+		p.refreshTimer.Stop()
+	}
+	p.refreshTimer = time.AfterFunc(refreshTimeout, func() {
+		p.commandMutex.Lock()
+		p.refreshTimer = nil
+		p.commandMutex.Unlock()
+
+		if err := p.writeChatMessageToClient("§bGoMCProxy: "+p.translate("refresh.timeout"), ChatTypeChat, clientConn); err != nil {
+			p.errorChecker(err)
+		}
+	})
+	p.commandMutex.Unlock()
+
+	return p.injectServerbound(createServerboundChatPacket("/locraw"), serverConn)
+}
+
+// Tells the client what was detected if the /locraw reply that was just parsed is for /scupdate
+func (p *Proxy) finishRefresh(clientConn io.Writer) error {
+	p.commandMutex.Lock()
+	if p.refreshTimer == nil || !p.refreshTimer.Stop() {
+		p.commandMutex.Unlock()
+		return nil
+	}
+	p.refreshTimer = nil
+	bedwarsType, modeOverride := p.bedwarsType, p.modeOverride
+	p.commandMutex.Unlock()
+
+	reply := "§bGoMCProxy: " + p.translate("refresh.not_in_game")
+	if bedwarsType != nil {
+		reply = "§bGoMCProxy: " + p.translate("refresh.in_game", capitaliseFirst(string(*bedwarsType)))
+	}
+	if modeOverride != nil {
+		reply += p.translate("refresh.mode_override", capitaliseFirst(string(*modeOverride)))
+	}
+	return p.writeChatMessageToClient(reply, ChatTypeChat, clientConn)
+}
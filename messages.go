@@ -0,0 +1,108 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"sync"
+)
+
+const defaultLocale = "en_us"
+
+// Built-in messages, one <locale>.json file per locale mapping message keys to fmt templates
+//
+//go:embed messages/*.json
+var embeddedMessages embed.FS
+
+// Messages by lowercase locale and key. A key is looked up in the client's locale first and then in
+// defaultLocale, overrides from the config file take precedence over the embedded messages each time.
+type MessageCatalog struct {
+	embedded  map[string]map[string]string
+	overrides map[string]map[string]string
+	mutex     sync.RWMutex
+}
+
+var catalog = newMessageCatalog()
+
+func newMessageCatalog() *MessageCatalog {
+	c := &MessageCatalog{
+		embedded:  make(map[string]map[string]string),
+		overrides: make(map[string]map[string]string),
+	}
+
+	files, err := embeddedMessages.ReadDir("messages")
+	if err != nil {
+		log.Panic(err)
+	}
+	for _, file := range files {
+		data, err := embeddedMessages.ReadFile(path.Join("messages", file.Name()))
+		if err != nil {
+			log.Panic(err)
+		}
+		var localeMessages map[string]string
+		if err := json.Unmarshal(data, &localeMessages); err != nil {
+			log.Panicf("Invalid embedded messages %s: %v", file.Name(), err)
+		}
+		c.embedded[strings.TrimSuffix(file.Name(), ".json")] = localeMessages
+	}
+	return c
+}
+
+// Replaces the messages from the config file
+func (c *MessageCatalog) setOverrides(overrides map[string]map[string]string) {
+	c.mutex.Lock()
+	c.overrides = overrides
+	c.mutex.Unlock()
+}
+
+func (c *MessageCatalog) lookup(locale string, key string) (string, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	for _, l := range []string{strings.ToLower(locale), defaultLocale} {
+		if format, ok := c.overrides[l][key]; ok {
+			return format, true
+		}
+		if format, ok := c.embedded[l][key]; ok {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+// Formats the message for key in locale (e.g. "de_de") with args, unknown keys are returned as is
+func translate(locale string, key string, args ...any) string {
+	format, ok := catalog.lookup(locale, key)
+	if !ok {
+		return key
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Formats the message for key in the client's locale
+func (p *Proxy) translate(key string, args ...any) string {
+	p.localeMutex.Lock()
+	locale := p.locale
+	p.localeMutex.Unlock()
+	return translate(locale, key, args...)
+}
+
+// Reads the locale from a Client Settings packet
+func (p *Proxy) handleClientSettings(r *bytes.Reader) error {
+	locale, err := readPrefixedBytes(r)
+	if err != nil {
+		return err
+	}
+	p.localeMutex.Lock()
+	p.locale = strings.ToLower(string(locale))
+	p.localeMutex.Unlock()
+	return nil
+}
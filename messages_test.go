@@ -0,0 +1,83 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestTranslate(t *testing.T) {
+	catalog.setOverrides(map[string]map[string]string{
+		"de_de": {"scmode.cleared": "§rModus zurückgesetzt"},
+		"en_us": {"compare.usage": "§cUsage: /compare <mode> <a> <b>"},
+	})
+	t.Cleanup(func() { catalog.setOverrides(nil) })
+
+	tests := []struct {
+		locale string
+		key    string
+		args   []any
+		want   string
+	}{
+		{"de_de", "scmode.cleared", nil, "§rModus zurückgesetzt"},
+		{"DE_DE", "scmode.cleared", nil, "§rModus zurückgesetzt"},
+		// Keys the locale doesn't have come from en_us, overridden or not
+		{"de_de", "scmode.set", []any{"Doubles"}, "§rMode set to §6Doubles"},
+		{"de_de", "compare.usage", nil, "§cUsage: /compare <mode> <a> <b>"},
+		{"", "compare.invalid_player", []any{"Steve"}, "§cInvalid player: Steve"},
+		{"", "missing.key", nil, "missing.key"},
+	}
+	for _, tt := range tests {
+		if got := translate(tt.locale, tt.key, tt.args...); got != tt.want {
+			t.Errorf("translate(%q, %q) = %q, want %q", tt.locale, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestFormatGameRecap(t *testing.T) {
+	p := &Proxy{username: "Steve"}
+	summary := &gameSummary{
+		winners: []string{"Steve", "Alex"},
+		killers: []summaryKiller{{"Alex", 12}, {"Steve", 8}},
+	}
+	want := "§bGoMCProxy Recap: §a§lVictory\n" +
+		"§6Winners§r: §aSteve§r, §fAlex§r\n" +
+		"§61st killer§r: §fAlex§r with 12 kills\n" +
+		"§62nd killer§r: §aSteve§r with 8 kills"
+	if got := p.formatGameRecap(summary, true); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRefreshReplies(t *testing.T) {
+	p := &Proxy{logger: log.New(io.Discard, "", 0)}
+	p.setClientThreshold(-1)
+	p.setState(StatePlay)
+
+	w := &bytes.Buffer{}
+	if err := p.handleRefresh(io.Discard, w); err != nil {
+		t.Fatal(err)
+	}
+	if packets := readAllPackets(t, w.Bytes()); len(packets) != 1 || !bytes.Contains(packets[0], []byte("/scupdate only works on Hypixel")) {
+		t.Errorf("outside of Hypixel /scupdate answered %q", packets)
+	}
+
+	// The /locraw reply of a /scupdate
+	bedwarsType, modeOverride := BedwarsTypeDoubles, BedwarsTypeSolo
+	p.bedwarsType, p.modeOverride = &bedwarsType, &modeOverride
+	p.refreshTimer = time.AfterFunc(time.Hour, func() {})
+	w.Reset()
+	if err := p.finishRefresh(w); err != nil {
+		t.Fatal(err)
+	}
+	want := "In a §6Doubles §rBedwars game, /sc uses §6Solo §rfrom /scmode"
+	if packets := readAllPackets(t, w.Bytes()); len(packets) != 1 || !bytes.Contains(packets[0], []byte(want)) {
+		t.Errorf("/scupdate answered %q, want %q", packets, want)
+	}
+}
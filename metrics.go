@@ -0,0 +1,126 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A Prometheus histogram, partitioned by the value of one label
+type histogram struct {
+	name    string
+	help    string
+	label   string
+	buckets []float64 // Upper bounds, the +Inf bucket is implied
+	series  map[string]*histogramSeries
+	mutex   sync.Mutex
+}
+
+type histogramSeries struct {
+	counts []uint64 // Per bucket and not cumulative, the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(name string, help string, label string, buckets []float64) *histogram {
+	return &histogram{name: name, help: help, label: label, buckets: buckets, series: make(map[string]*histogramSeries)}
+}
+
+func (h *histogram) observe(labelValue string, value float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	series, ok := h.series[labelValue]
+	if !ok {
+		series = &histogramSeries{counts: make([]uint64, len(h.buckets)+1)}
+		h.series[labelValue] = series
+	}
+	i, _ := slices.BinarySearch(h.buckets, value)
+	series.counts[i]++
+	series.sum += value
+	series.count++
+}
+
+// Writes the histogram in the Prometheus text format
+func (h *histogram) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+
+	labelValues := make([]string, 0, len(h.series))
+	for labelValue := range h.series {
+		labelValues = append(labelValues, labelValue)
+	}
+	slices.Sort(labelValues)
+	for _, labelValue := range labelValues {
+		series := h.series[labelValue]
+		labels := fmt.Sprintf("%s=%q", h.label, labelValue)
+		var cumulative uint64
+		for i, count := range series.counts {
+			cumulative += count
+			le := "+Inf"
+			if i < len(h.buckets) {
+				le = strconv.FormatFloat(h.buckets[i], 'f', -1, 64)
+			}
+			fmt.Fprintf(w, "%s_bucket{%s,le=%q} %d\n", h.name, labels, le, cumulative)
+		}
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", h.name, labels, strconv.FormatFloat(series.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", h.name, labels, series.count)
+	}
+}
+
+// Set with -metrics-addr, the histograms are only filled in then
+var metricsEnabled bool
+
+// Sizes of the packets read from either side, as framed on the wire: the packet length and what follows
+// it, compressed if the packet is
+var packetSizes = newHistogram("gomcproxy_packet_size_bytes", "Size of the packets read from the client and the server, as framed on the wire.",
+	"direction", []float64{16, 64, 256, 1024, 4096, 16384, 65536, 262144, 1048576})
+
+// Durations of the requests to the Hypixel API, Mojang and the session server by host
+var apiLatency = newHistogram("gomcproxy_api_request_duration_seconds", "Duration of the HTTP requests to the Hypixel API and Mojang, until the response headers arrived.",
+	"host", []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10})
+
+// packetLength is the Packet Length field, which doesn't count itself
+func observePacketSize(clientToServer bool, packetLength int) {
+	direction := "clientbound"
+	if clientToServer {
+		direction = "serverbound"
+	}
+	packetSizes.observe(direction, float64(framedSize(packetLength)))
+}
+
+// Returns the size of a packet on the wire from its Packet Length field
+func framedSize(packetLength int) int {
+	size := packetLength + 1
+	for rest := uint32(packetLength) >> 7; rest != 0; rest >>= 7 {
+		size++
+	}
+	return size
+}
+
+// Times every request of the client it is the transport of in apiLatency
+type timedTransport struct {
+	http.RoundTripper
+}
+
+func (t timedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.RoundTripper.RoundTrip(req)
+	apiLatency.observe(req.URL.Host, time.Since(start).Seconds())
+	return resp, err
+}
+
+// Serves the histograms on /metrics, set with -metrics-addr
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	packetSizes.write(w)
+	apiLatency.write(w)
+}
@@ -0,0 +1,28 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFramedSize(t *testing.T) {
+	for _, threshold := range []int{-1, 256} {
+		for _, length := range []int{1, 126, 127, 128, 300, 16383, 16384, 70000} {
+			framed, err := reconstructPacket(testPacket(length), threshold)
+			if err != nil {
+				t.Fatal(err)
+			}
+			frame, err := readFrame(bytes.NewReader(framed), &threshold)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := framedSize(frame.packetLength); got != len(framed) {
+				t.Errorf("threshold %d, %d byte packet: framedSize = %d, want the %d bytes on the wire", threshold, length, got, len(framed))
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+)
+
+// Packets buffered per observer, an observer that falls further behind is disconnected
+const observerBufferSize = 1024
+
+type observer struct {
+	conn    net.Conn
+	packets chan []byte
+}
+
+// Sends a copy of every clientbound packet, exactly as it is written to the client, to read-only
+// observer connections. Observers that connect mid-session miss earlier packets such as Set Compression.
+type Mirror struct {
+	observers map[*observer]struct{}
+	mutex     sync.Mutex
+}
+
+var mirror *Mirror
+
+func newMirror() *Mirror {
+	return &Mirror{observers: make(map[*observer]struct{})}
+}
+
+func (m *Mirror) serve(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Println("Mirror listener failed:", err)
+			}
+			return
+		}
+		log.Printf("Observer %s connected to the mirror", conn.RemoteAddr())
+
+		o := &observer{conn, make(chan []byte, observerBufferSize)}
+		m.mutex.Lock()
+		m.observers[o] = struct{}{}
+		m.mutex.Unlock()
+
+		go m.writeLoop(o)
+		// Observers are read-only, anything they send is discarded until they disconnect
+		go func() {
+			io.Copy(io.Discard, conn)
+			m.remove(o)
+		}()
+	}
+}
+
+func (m *Mirror) writeLoop(o *observer) {
+	for packet := range o.packets {
+		if _, err := o.conn.Write(packet); err != nil {
+			m.remove(o)
+			return
+		}
+	}
+}
+
+// Never blocks, so a slow or broken observer can't affect the real session
+func (m *Mirror) write(packet []byte) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for o := range m.observers {
+		select {
+		case o.packets <- packet:
+		default:
+			log.Printf("Observer %s fell behind, disconnecting it", o.conn.RemoteAddr())
+			m.removeLocked(o)
+		}
+	}
+}
+
+func (m *Mirror) remove(o *observer) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.removeLocked(o)
+}
+
+func (m *Mirror) removeLocked(o *observer) {
+	if _, ok := m.observers[o]; !ok {
+		return
+	}
+	delete(m.observers, o)
+	close(o.packets)
+	o.conn.Close()
+	log.Printf("Observer %s disconnected from the mirror", o.conn.RemoteAddr())
+}
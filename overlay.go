@@ -8,9 +8,12 @@ import (
 	_ "embed"
 	"fmt"
 	"image/color"
+	"log"
+	"math"
 	"slices"
-	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
@@ -29,14 +32,134 @@ var upgradesMutex sync.RWMutex
 var traps []string
 var trapsMutex sync.RWMutex
 
+// The current game from /locraw
+type gameData struct {
+	inGame  bool   // In a Bedwars game, not a lobby
+	mapName string // Empty when not in a game
+	server  string // Empty when not in a game
+}
+
+var game gameData
+var gameMutex sync.RWMutex
+
+// Set while the overlay is shown
+var overlayRunning atomic.Bool
+
+// Hides the overlay without closing it, set through the control channel
+var overlayHidden atomic.Bool
+
+// raylib's default font only has ASCII, used when Monocraft fails to load
+var asciiSymbols = strings.NewReplacer("↑", "^", "→", ">", "↓", "v", "←", "<", "✔", "OK")
+
 var upgradeOrder = [6]string{"sharp", "prot", "haste", "forge", "healpool", "featherfalling"}
 
-func runOverlay() {
+type navigationData struct {
+	hasSpawn  bool
+	spawnX    int
+	spawnZ    int
+	hasPlayer bool
+	x         float64
+	z         float64
+	yaw       float32
+}
+
+var navigation navigationData
+var navigationMutex sync.RWMutex
+
+// The player's vanilla experience from Set Experience
+type experienceData struct {
+	known bool    // A Set Experience has been received
+	bar   float32 // Progress towards the next level, 0 to 1
+	level int32
+	total int32
+}
+
+var experience experienceData
+var experienceMutex sync.RWMutex
+
+// Returns:
+// float64: horizontal distance from the player to spawn
+// string: arrow pointing towards spawn relative to where the player is looking
+func (n navigationData) spawnDirection() (float64, string) {
+	dx := float64(n.spawnX) + 0.5 - n.x
+	dz := float64(n.spawnZ) + 0.5 - n.z
+
+	// Yaw 0 faces +Z and increases clockwise, turn the direction to spawn into a yaw the same way
+	targetYaw := math.Atan2(-dx, dz) * 180 / math.Pi
+	relative := math.Mod(targetYaw-float64(n.yaw), 360)
+	if relative < 0 {
+		relative += 360
+	}
+
+	arrows := [4]string{"↑", "→", "↓", "←"}
+	arrow := arrows[int(math.Round(relative/90))%4]
+	return math.Hypot(dx, dz), arrow
+}
+
+// Purchases and traps -overlay-debug steps through, in the order they can be bought
+var debugUpgradePurchases = []string{
+	"Sharpened Swords",
+	"Reinforced Armor I", "Reinforced Armor II", "Reinforced Armor III", "Reinforced Armor IV",
+	"Maniac Miner I", "Maniac Miner II",
+	"Iron Forge", "Gold Forge", "Emerald Forge", "Molten Forge",
+	"Heal Pool",
+	"Cushioned Boots I", "Cushioned Boots II",
+}
+var debugTraps = []string{"It's a Trap", "Counter-Offensive Trap", "Alarm Trap", "Miner Fatigue Trap"}
+
+type overlayDebug struct {
+	nextUpgrade int
+	nextTrap    int
+}
+
+// Changes the overlay's data for a key pressed with -overlay-debug:
+// U buys the next upgrade, T buys a trap, S sets off a trap, G toggles being in a game and C clears everything
+func (d *overlayDebug) handleKey(key rune) {
+	switch key {
+	case 'U':
+		purchase := debugUpgradePurchases[d.nextUpgrade%len(debugUpgradePurchases)]
+		d.nextUpgrade++
+		upgradeKey, text, nextPrice := getUpgradeInformation(purchase, BedwarsTypeSolo)
+		if upgradeKey != "" {
+			upgradesMutex.Lock()
+			upgrades[upgradeKey] = upgradeData{text, nextPrice}
+			upgradesMutex.Unlock()
+		}
+	case 'T':
+		trapsMutex.Lock()
+		traps = append(traps, debugTraps[d.nextTrap%len(debugTraps)])
+		trapsMutex.Unlock()
+		d.nextTrap++
+	case 'S':
+		trapsMutex.Lock()
+		if len(traps) > 0 {
+			traps = traps[1:]
+		}
+		trapsMutex.Unlock()
+	case 'G':
+		gameMutex.Lock()
+		if game.inGame {
+			game = gameData{}
+		} else {
+			game = gameData{true, "Lighthouse", overlayGameServer}
+		}
+		gameMutex.Unlock()
+	case 'C':
+		clearOverlayGame()
+		*d = overlayDebug{}
+	}
+}
+
+// Runs the overlay until its window is closed or shutdown is closed, rl.CloseWindow runs either way.
+// With debug set, keys pressed while the overlay is focused fill it with sample data, see overlayDebug.handleKey
+func runOverlay(debug bool, shutdown <-chan struct{}) {
 	rl.SetTraceLogLevel(rl.LogError)
 	rl.SetConfigFlags(rl.FlagWindowTransparent)
-	rl.InitWindow(280, 240, "GoMCProxy Overlay")
+	rl.InitWindow(280, 264, "GoMCProxy Overlay")
 	rl.SetWindowState(rl.FlagWindowUndecorated | rl.FlagWindowResizable)
 	defer rl.CloseWindow()
+	overlayRunning.Store(true)
+	defer overlayRunning.Store(false)
 
 	rl.SetTargetFPS(5)
 
@@ -45,27 +168,96 @@ func runOverlay() {
 		codepoints = append(codepoints, rune(i))
 	}
 	codepoints = append(codepoints, '↑')
+	codepoints = append(codepoints, '→')
+	codepoints = append(codepoints, '↓')
+	codepoints = append(codepoints, '←')
 	codepoints = append(codepoints, '✔')
 
 	font := rl.LoadFontFromMemory(".ttf", monocraftTTF, 24, codepoints)
-	defer rl.UnloadFont(font)
+	var fontSize, spacing float32 = 24, 0
+	fallback := !rl.IsFontValid(font)
+	if fallback {
+		log.Println("Failed to load the overlay font, falling back to raylib's default font")
+		// The default font is 10 pixels high and isn't monospaced, twice the size stays sharp
+		font = rl.GetFontDefault()
+		fontSize, spacing = 20, 2
+	} else {
+		defer rl.UnloadFont(font)
+	}
+
+	drawText := func(text string, x float32, y float32, tint color.RGBA) {
+		if fallback {
+			text = asciiSymbols.Replace(text)
+		}
+		rl.DrawTextEx(font, text, rl.NewVector2(x, y), fontSize, spacing, tint)
+	}
+	// Draws text with its right edge at the right of the window
+	drawTextRight := func(text string, width int, y float32, tint color.RGBA) {
+		if fallback {
+			text = asciiSymbols.Replace(text)
+		}
+		textWidth := rl.MeasureTextEx(font, text, fontSize, spacing).X
+		rl.DrawTextEx(font, text, rl.NewVector2(float32(width)-textWidth-6, y), fontSize, spacing, tint)
+	}
 
-	characterSize := int(rl.MeasureTextEx(font, "a", 24, 0).X)
+	debugData := &overlayDebug{}
+	debugKeys := map[int32]rune{rl.KeyU: 'U', rl.KeyT: 'T', rl.KeyS: 'S', rl.KeyG: 'G', rl.KeyC: 'C'}
 
 	for !rl.WindowShouldClose() {
+		select {
+		case <-shutdown:
+			return
+		default:
+		}
+
+		if debug {
+			for keyCode, key := range debugKeys {
+				if rl.IsKeyPressed(keyCode) {
+					debugData.handleKey(key)
+				}
+			}
+		}
+
 		rl.BeginDrawing()
 
 		width := rl.GetScreenWidth()
 
+		if overlayHidden.Load() {
+			rl.ClearBackground(rl.Blank)
+			rl.EndDrawing()
+			continue
+		}
+
+		gameMutex.RLock()
+		current := game
+		// Kept for when the player reconnects into their game, see resume.go
+		otherGame := current.server != overlayGameServer
+		gameMutex.RUnlock()
+
+		// Upgrades and traps are meaningless in lobbies
+		if getConfig().OverlayAutoHide && !current.inGame {
+			rl.ClearBackground(rl.Blank)
+			drawText("Waiting for a game", 6, 0, rl.LightGray)
+			rl.EndDrawing()
+			continue
+		}
+
 		rl.ClearBackground(rl.Color{R: 0, G: 0, B: 0, A: 75})
 
-		rl.DrawTextEx(font, "Upgrades", rl.NewVector2(6, 0), 24, 0, rl.Yellow)
+		mapName := current.mapName
+		if mapName == "" {
+			mapName = "Unknown"
+		}
+		drawText("Map", 6, 0, rl.Yellow)
+		drawTextRight(mapName, width, 0, rl.White)
+
+		drawText("Upgrades", 6, 28, rl.Yellow)
 
-		var y float32 = 20
+		var y float32 = 48
 
 		upgradesMutex.RLock()
-		if len(upgrades) == 0 {
-			rl.DrawTextEx(font, "None", rl.NewVector2(6, y), 24, 0, rl.White)
+		if len(upgrades) == 0 || otherGame {
+			drawText("None", 6, y, rl.White)
 			y += 20
 		} else {
 			keys := make([]string, 0, len(upgrades))
@@ -80,12 +272,11 @@ func runOverlay() {
 					continue
 				}
 
-				rl.DrawTextEx(font, data.text, rl.NewVector2(6, y), 24, 0, rl.White)
+				drawText(data.text, 6, y, rl.White)
 				if data.nextPrice > 0 {
-					characters := 1 + len(strconv.Itoa(data.nextPrice))
-					rl.DrawTextEx(font, fmt.Sprintf("↑%d", data.nextPrice), rl.NewVector2(float32(width-characterSize*characters-6), float32(y)), 24, 0, color.RGBA{R: 84, G: 255, B: 255, A: 255})
+					drawTextRight(fmt.Sprintf("↑%d", data.nextPrice), width, y, color.RGBA{R: 84, G: 255, B: 255, A: 255})
 				} else {
-					rl.DrawTextEx(font, "✔", rl.NewVector2(float32(width-characterSize-6), float32(y)), 24, 0, rl.Green)
+					drawTextRight("✔", width, y, rl.Green)
 				}
 				y += 20
 			}
@@ -93,20 +284,41 @@ func runOverlay() {
 		upgradesMutex.RUnlock()
 
 		y += 8
-		rl.DrawTextEx(font, "Traps", rl.NewVector2(6, y), 24, 0, rl.Yellow)
+		drawText("Traps", 6, y, rl.Yellow)
 		y += 20
 
 		trapsMutex.RLock()
-		if len(traps) == 0 {
-			rl.DrawTextEx(font, "None", rl.NewVector2(6, y), 24, 0, rl.White)
+		if len(traps) == 0 || otherGame {
+			drawText("None", 6, y, rl.White)
+			y += 20
 		} else {
 			for _, trap := range traps {
-				rl.DrawTextEx(font, trap, rl.NewVector2(6, y), 24, 0, rl.White)
+				drawText(trap, 6, y, rl.White)
 				y += 20
 			}
 		}
 		trapsMutex.RUnlock()
 
+		navigationMutex.RLock()
+		nav := navigation
+		navigationMutex.RUnlock()
+		if nav.hasSpawn && nav.hasPlayer {
+			distance, arrow := nav.spawnDirection()
+			y += 8
+			drawText("Spawn", 6, y, rl.Yellow)
+			drawTextRight(fmt.Sprintf("%dm %s", int(distance), arrow), width, y, rl.White)
+			y += 20
+		}
+
+		experienceMutex.RLock()
+		xp := experience
+		experienceMutex.RUnlock()
+		if xp.known {
+			y += 8
+			drawText("Level", 6, y, rl.Yellow)
+			drawTextRight(fmt.Sprintf("%d (%d%%)", xp.level, int(xp.bar*100)), width, y, rl.White)
+		}
+
 		rl.EndDrawing()
 	}
 }
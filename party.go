@@ -0,0 +1,115 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Hypixel's party invite, the inviter and, when they invited the player to someone else's party, the leader.
+// Messages are matched with their lines joined, Hypixel frames party messages with lines of dashes.
+// Anchored to the start so players can't trigger them from chat.
+var partyInviteRegex = regexp.MustCompile(`^(?:-+ )?(?:\[[^\]]+\] )?(\.?\w{1,16}) has invited you to join (?:their|(?:\[[^\]]+\] )?(\.?\w{1,16})'s) party!`)
+
+var partyInviteExpiredRegex = regexp.MustCompile(`^(?:-+ )?The party invite from (?:\[[^\]]+\] )?(\.?\w{1,16}) has expired`)
+
+var partyJoinedRegex = regexp.MustCompile(`^(?:-+ )?You have joined (?:\[[^\]]+\] )?(\.?\w{1,16})'s party!`)
+
+// Returns the players -party-accept-from lists, nil if invites from everyone are accepted
+func parsePartyAcceptFrom(value string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	names := strings.Split(value, ",")
+	for i, name := range names {
+		names[i] = strings.TrimSpace(name)
+		if !playerNameRegex.MatchString(names[i]) {
+			return nil, fmt.Errorf("Invalid player name %q in -party-accept-from", names[i])
+		}
+	}
+	return names, nil
+}
+
+// Accepts a party invite with -auto-party-accept and tells the player when an invite expired before
+// the accept got through, e.g. while it waited for -inject-delay
+func (p *Proxy) handlePartyMessage(message string, serverConn io.Writer, clientConn io.Writer) error {
+	cfg := getConfig()
+	if !cfg.AutoPartyAccept {
+		return nil
+	}
+
+	if match := partyJoinedRegex.FindStringSubmatch(message); match != nil {
+		p.forgetPartyInvite(match[1])
+		return nil
+	}
+
+	if match := partyInviteExpiredRegex.FindStringSubmatch(message); match != nil {
+		if !p.forgetPartyInvite(match[1]) {
+			return nil
+		}
+		p.logger.Printf("The party invite from %s expired before it was accepted", match[1])
+		return p.writeChatMessageToClient("§bGoMCProxy Party: "+p.translate("party.invite_expired", match[1]), ChatTypeChat, clientConn)
+	}
+
+	match := partyInviteRegex.FindStringSubmatch(message)
+	if match == nil {
+		return nil
+	}
+	inviter, leader := match[1], match[2]
+	if leader == "" {
+		leader = inviter
+	}
+
+	// Validated when the config was loaded
+	acceptFrom, _ := parsePartyAcceptFrom(cfg.PartyAcceptFrom)
+	if acceptFrom != nil && !containsFold(acceptFrom, inviter) {
+		p.logger.Printf("Not accepting the party invite from %s, they aren't in -party-accept-from", inviter)
+		return nil
+	}
+
+	// Either could be named when the invite expires
+	p.commandMutex.Lock()
+	p.partyInvites[strings.ToLower(inviter)] = leader
+	p.partyInvites[strings.ToLower(leader)] = leader
+	p.commandMutex.Unlock()
+
+	p.logger.Printf("Accepting the party invite from %s to %s's party", inviter, leader)
+	if err := p.injectServerbound(createServerboundChatPacket("/party accept "+leader), serverConn); err != nil {
+		return err
+	}
+	return p.writeChatMessageToClient("§bGoMCProxy Party: "+p.translate("party.accepting", inviter), ChatTypeChat, clientConn)
+}
+
+// Forgets the invite to the party name is the leader of or invited to
+// Returns:
+// bool: false if there was no such invite
+func (p *Proxy) forgetPartyInvite(name string) bool {
+	p.commandMutex.Lock()
+	defer p.commandMutex.Unlock()
+
+	leader, ok := p.partyInvites[strings.ToLower(name)]
+	if !ok {
+		return false
+	}
+	for key, inviteLeader := range p.partyInvites {
+		if inviteLeader == leader {
+			delete(p.partyInvites, key)
+		}
+	}
+	return true
+}
+
+// Returns whether names contains name, ignoring case
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Title of the Bedwars item shop's first page, the page with the Quick Buy layout
+const quickBuyTitle = "Quick Buy"
+
+// Slots of the Quick Buy page that hold the layout, 3 rows of 7
+var quickBuySlots = [...]int{
+	19, 20, 21, 22, 23, 24, 25,
+	28, 29, 30, 31, 32, 33, 34,
+	37, 38, 39, 40, 41, 42, 43,
+}
+
+const quickBuyRowLength = 7
+
+// Hypixel fills empty Quick Buy slots with stained glass panes
+const stainedGlassPaneID = 160
+
+// Reads an Open Window packet and remembers the window if it is the Quick Buy page
+func (p *Proxy) handleOpenWindow(packetReader *bytes.Reader) error {
+	windowID, err := packetReader.ReadByte()
+	if err != nil {
+		return err
+	}
+	if _, err := readPrefixedBytes(packetReader); err != nil {
+		return err
+	}
+	title, err := readPrefixedBytes(packetReader)
+	if err != nil {
+		return err
+	}
+
+	p.inventoryMutex.Lock()
+	defer p.inventoryMutex.Unlock()
+	if chatComponentText(string(title)) == quickBuyTitle {
+		p.shopWindow = windowID
+	} else {
+		p.shopWindow = 0
+	}
+	return nil
+}
+
+// Forgets the Quick Buy page when either side closes it, the saved layout is kept
+func (p *Proxy) handleCloseWindow(packetReader *bytes.Reader) error {
+	windowID, err := packetReader.ReadByte()
+	if err != nil {
+		return err
+	}
+
+	p.inventoryMutex.Lock()
+	defer p.inventoryMutex.Unlock()
+	if windowID == p.shopWindow {
+		p.shopWindow = 0
+	}
+	return nil
+}
+
+// Forgets the Quick Buy page when a Confirm Transaction is for another window. Transactions are only
+// for the window the player is clicking in, so the Quick Buy page has been closed without a Close
+// Window that went through the proxy.
+func (p *Proxy) handleConfirmTransaction(packetReader *bytes.Reader) error {
+	windowID, err := packetReader.ReadByte()
+	if err != nil {
+		return err
+	}
+	// Whether it was accepted doesn't matter, the Set Slots that undo a rejected click already keep
+	// the saved layout right
+	var actionNumber int16
+	if err := binary.Read(packetReader, binary.BigEndian, &actionNumber); err != nil {
+		return err
+	}
+	if _, err := packetReader.ReadByte(); err != nil {
+		return err
+	}
+
+	p.inventoryMutex.Lock()
+	defer p.inventoryMutex.Unlock()
+	if p.shopWindow != 0 && windowID != p.shopWindow {
+		p.shopWindow = 0
+	}
+	return nil
+}
+
+func (p *Proxy) forgetShopWindow() {
+	p.inventoryMutex.Lock()
+	p.shopWindow = 0
+	p.inventoryMutex.Unlock()
+}
+
+// Saves the Quick Buy layout from the Window Items of windowID if it is the Quick Buy page
+func (p *Proxy) handleShopItems(windowID byte, packetReader *bytes.Reader) error {
+	p.inventoryMutex.RLock()
+	isShop := windowID == p.shopWindow
+	p.inventoryMutex.RUnlock()
+	if !isShop {
+		return nil
+	}
+
+	var count int16
+	if err := binary.Read(packetReader, binary.BigEndian, &count); err != nil {
+		return err
+	}
+	if int(count) <= quickBuySlots[len(quickBuySlots)-1] {
+		return fmt.Errorf("The Quick Buy page has only %d slots", count)
+	}
+
+	items := make([]*ItemStack, count)
+	for i := range items {
+		item, err := readSlot(packetReader)
+		if err != nil {
+			return err
+		}
+		items[i] = item
+	}
+
+	layout := make([]string, len(quickBuySlots))
+	for i, slot := range quickBuySlots {
+		layout[i] = quickBuyItemName(items[slot])
+	}
+
+	p.inventoryMutex.Lock()
+	p.quickBuy = layout
+	p.quickBuyAt = time.Now()
+	p.inventoryMutex.Unlock()
+	return nil
+}
+
+// Updates the saved Quick Buy layout from a Set Slot of windowID, e.g. after the player changed it
+func (p *Proxy) handleShopSlot(windowID byte, slot int16, packetReader *bytes.Reader) error {
+	p.inventoryMutex.RLock()
+	isShop := windowID == p.shopWindow && p.quickBuy != nil
+	p.inventoryMutex.RUnlock()
+	if !isShop {
+		return nil
+	}
+
+	position := -1
+	for i, quickBuySlot := range quickBuySlots {
+		if quickBuySlot == int(slot) {
+			position = i
+		}
+	}
+	if position == -1 {
+		return nil
+	}
+
+	item, err := readSlot(packetReader)
+	if err != nil {
+		return err
+	}
+
+	p.inventoryMutex.Lock()
+	p.quickBuy[position] = quickBuyItemName(item)
+	p.quickBuyAt = time.Now()
+	p.inventoryMutex.Unlock()
+	return nil
+}
+
+// Returns the item's name without formatting, empty for an empty Quick Buy slot
+func quickBuyItemName(item *ItemStack) string {
+	if item == nil || item.ID == stainedGlassPaneID {
+		return ""
+	}
+	name, _ := getItemDisplay(item.Tag)
+	if name == "" {
+		return fmt.Sprintf("%d:%d", item.ID, item.Damage)
+	}
+	return colorCodeRegex.ReplaceAllString(name, "")
+}
+
+// Handles /quickbuy by showing the Quick Buy layout saved when the item shop was last opened
+func (p *Proxy) handleQuickBuy(w io.Writer) error {
+	p.inventoryMutex.RLock()
+	layout := slices.Clone(p.quickBuy)
+	savedAt := p.quickBuyAt
+	p.inventoryMutex.RUnlock()
+
+	if layout == nil {
+		return p.writeChatMessageToClient("§bGoMCProxy: "+p.translate("quickbuy.not_seen"), ChatTypeChat, w)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("§bGoMCProxy QuickBuy: " + p.translate("quickbuy.saved", time.Since(savedAt).Truncate(time.Second)))
+	for row := range len(layout) / quickBuyRowLength {
+		names := make([]string, quickBuyRowLength)
+		for i, name := range layout[row*quickBuyRowLength : (row+1)*quickBuyRowLength] {
+			if name == "" {
+				names[i] = p.translate("quickbuy.empty")
+			} else {
+				names[i] = "§f" + name
+			}
+		}
+		sb.WriteString("\n" + p.translate("quickbuy.row", row+1) + strings.Join(names, "§7, "))
+	}
+	return p.writeChatMessageToClient(sb.String(), ChatTypeChat, w)
+}
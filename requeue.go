@@ -0,0 +1,98 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"io"
+	"strings"
+	"time"
+)
+
+// Titles Hypixel shows when a game has ended with the color codes stripped, by whether the game was won
+var gameEndTitles = map[string]bool{"VICTORY!": true, "GAME OVER!": false}
+
+// Reads the text of a Title packet without formatting, empty unless it sets the title
+func readTitle(r io.Reader) (string, error) {
+	action, _, err := readVarInt(r)
+	if err != nil {
+		return "", err
+	}
+	// Set Title
+	if action != 0 {
+		return "", nil
+	}
+
+	titleBytes, err := readPrefixedBytes(r)
+	if err != nil {
+		return "", err
+	}
+	return chatComponentText(string(titleBytes)), nil
+}
+
+// Records the game's result when titleText is a game end title, then schedules a requeue if
+// -auto-requeue is set
+func (p *Proxy) handleTitle(titleText string, clientConn io.Writer) error {
+	won, ok := gameEndTitles[titleText]
+	if !ok {
+		return nil
+	}
+	if p.recordGameResult(won) && won {
+		p.recordHighlight("win", "")
+	}
+	if getConfig().AutoRequeueDelay > 0 {
+		return p.scheduleRequeue(clientConn)
+	}
+	return nil
+}
+
+// Sends /play for the mode of the game that just ended after config.AutoRequeueDelay,
+// unless config.MaxRequeues has been reached for this connection
+func (p *Proxy) scheduleRequeue(clientConn io.Writer) error {
+	cfg := getConfig()
+
+	p.commandMutex.Lock()
+	// Hypixel can send the same title more than once
+	if p.requeueTimer != nil || p.locrawMode == "" {
+		p.commandMutex.Unlock()
+		return nil
+	}
+	if p.requeues >= cfg.MaxRequeues {
+		p.commandMutex.Unlock()
+		p.logger.Println("Not requeueing, the maximum amount of requeues has been reached")
+		return nil
+	}
+	p.requeues++
+
+	playCommand := "/play " + strings.ToLower(p.locrawMode)
+	p.requeueTimer = time.AfterFunc(cfg.AutoRequeueDelay, func() {
+		p.commandMutex.Lock()
+		p.requeueTimer = nil
+		p.commandMutex.Unlock()
+
+		if err := p.injectServerbound(createServerboundChatPacket(playCommand), p.serverConn); err != nil {
+			p.errorChecker(err)
+		}
+	})
+	requeues := p.requeues
+	p.commandMutex.Unlock()
+
+	message := "§bGoMCProxy: " + p.translate("requeue.scheduled", cfg.AutoRequeueDelay, requeues, cfg.MaxRequeues)
+	return p.writeChatMessageToClient(message, ChatTypeChat, clientConn)
+}
+
+// Stops a scheduled requeue, it doesn't count towards config.MaxRequeues
+// Returns:
+// bool: true if a requeue was cancelled
+func (p *Proxy) cancelRequeue() bool {
+	p.commandMutex.Lock()
+	defer p.commandMutex.Unlock()
+
+	if p.requeueTimer == nil || !p.requeueTimer.Stop() {
+		return false
+	}
+	p.requeueTimer = nil
+	p.requeues--
+	return true
+}
@@ -0,0 +1,46 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func titlePacket(action int, title string) []byte {
+	var packet bytes.Buffer
+	writeVarInt(&packet, action)
+	if title != "" {
+		writeVarInt(&packet, len(title))
+		packet.WriteString(title)
+	}
+	return packet.Bytes()
+}
+
+func TestReadTitle(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet []byte
+		want   string
+	}{
+		{"object", titlePacket(0, `{"text":"§6§lVICTORY!"}`), "VICTORY!"},
+		{"bare string", titlePacket(0, `"§c§lGAME OVER!"`), "GAME OVER!"},
+		{"extra strings", titlePacket(0, `{"text":"","extra":["§cGAME ",{"text":"OVER!"}]}`), "GAME OVER!"},
+		{"nested extra", titlePacket(0, `{"text":"VIC","extra":[{"text":"TO","extra":["RY!"]}]}`), "VICTORY!"},
+		{"not JSON", titlePacket(0, `VICTORY!`), "VICTORY!"},
+		{"subtitle", titlePacket(1, `{"text":"VICTORY!"}`), ""},
+	}
+	for _, tt := range tests {
+		got, err := readTitle(bytes.NewReader(tt.packet))
+		if err != nil || got != tt.want {
+			t.Errorf("%s: readTitle = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+
+	// A truncated packet is an error for the caller to log, not a panic
+	if _, err := readTitle(bytes.NewReader(titlePacket(0, `{"text":"VICTORY!"}`)[:5])); err == nil {
+		t.Error("no error for a truncated title")
+	}
+}
@@ -0,0 +1,138 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reset policy for the overlay and /session when a player reconnects:
+//
+// A game is identified by the server /locraw reports, like "mini123A". The upgrades and traps belong
+// to the game they were bought in and are only cleared when /locraw reports a Bedwars game on another
+// server, so reconnecting into the same game keeps them. They aren't shown while /locraw reports
+// anything else, like a lobby. With -no-auto-locraw the game can't be told apart on its own, so they
+// are cleared on every respawn like before.
+//
+// The session's results are kept for a player that reconnects within sessionResumeWindow, a game
+// whose result was recorded before the reconnect isn't counted again when it ends. Injected commands
+// that were still queued are sent on the new connection once it is in the Play state, unless they
+// went stale in the meantime.
+
+// How long after a disconnect the session of a player can be resumed
+const sessionResumeWindow = 10 * time.Minute
+
+// The server of the game the upgrades and traps belong to, guarded by gameMutex
+var overlayGameServer string
+
+type resumableSession struct {
+	session      map[BedwarsType]*SessionStats
+	gameServer   string
+	gameRecorded bool
+	commandQueue []queuedPacket
+	savedAt      time.Time
+}
+
+// Sessions of players that disconnected, by lowercase username
+var resumableSessions = make(map[string]resumableSession)
+var resumableSessionsMutex sync.Mutex
+
+// Moves the upgrades and traps over to the game on server, clearing them if they belong to another game
+func enterOverlayGame(server string) {
+	gameMutex.Lock()
+	newGame := server != overlayGameServer
+	overlayGameServer = server
+	gameMutex.Unlock()
+
+	if newGame {
+		clearOverlayGame()
+	}
+}
+
+func clearOverlayGame() {
+	upgradesMutex.Lock()
+	clear(upgrades)
+	upgradesMutex.Unlock()
+	trapsMutex.Lock()
+	traps = nil
+	trapsMutex.Unlock()
+}
+
+// Copies the session's state, the stats are copied as a fetch of them can still finish on this proxy.
+// The queued commands are moved so they are only sent once.
+func (p *Proxy) sessionState() resumableSession {
+	p.commandMutex.Lock()
+	defer p.commandMutex.Unlock()
+
+	state := resumableSession{
+		session:      make(map[BedwarsType]*SessionStats, len(p.session)),
+		gameServer:   p.gameServer,
+		gameRecorded: p.gameRecorded,
+		commandQueue: p.commandQueue,
+		savedAt:      time.Now(),
+	}
+	p.commandQueue = nil
+	for bedwarsType, stats := range p.session {
+		state.session[bedwarsType] = &SessionStats{Wins: stats.Wins, Losses: stats.Losses, Before: stats.Before}
+	}
+	return state
+}
+
+// Keeps the session's state for when the player reconnects
+func (p *Proxy) saveSession() {
+	if p.username == "" {
+		return
+	}
+	state := p.sessionState()
+
+	resumableSessionsMutex.Lock()
+	defer resumableSessionsMutex.Unlock()
+	for key, saved := range resumableSessions {
+		if time.Since(saved.savedAt) > sessionResumeWindow {
+			delete(resumableSessions, key)
+		}
+	}
+	resumableSessions[strings.ToLower(p.username)] = state
+}
+
+// Resumes the session of a player that reconnected, replaced is the session this one replaces, if any
+func (p *Proxy) resumeSession(replaced *Proxy) {
+	var state resumableSession
+	if replaced != nil {
+		state = replaced.sessionState()
+	} else {
+		key := strings.ToLower(p.username)
+		resumableSessionsMutex.Lock()
+		saved, ok := resumableSessions[key]
+		delete(resumableSessions, key)
+		resumableSessionsMutex.Unlock()
+		if !ok || time.Since(saved.savedAt) > sessionResumeWindow {
+			return
+		}
+		state = saved
+	}
+
+	maxAge := getConfig().CommandQueueMaxAge
+	var commandQueue []queuedPacket
+	for _, queued := range state.commandQueue {
+		if time.Since(queued.sendAt) <= maxAge {
+			commandQueue = append(commandQueue, queued)
+		}
+	}
+
+	p.commandMutex.Lock()
+	p.session = state.session
+	p.gameServer = state.gameServer
+	p.gameRecorded = state.gameRecorded
+	// Queued before anything this connection queued during the login
+	p.commandQueue = append(commandQueue, p.commandQueue...)
+	if overflow := len(p.commandQueue) - getConfig().CommandQueueSize; overflow > 0 {
+		p.commandQueue = p.commandQueue[overflow:]
+	}
+	p.commandMutex.Unlock()
+	p.logger.Printf("Resumed the session from the previous connection with %d queued command(s)", len(commandQueue))
+}
@@ -0,0 +1,49 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+// Queued commands survive a reconnect, whether the old connection ended first or was replaced
+func TestResumeSessionCommandQueue(t *testing.T) {
+	fresh := []byte{0x01, 0x04, '/', 'g', 'g', '!'}
+	stale := []byte{0x01, 0x02, '/', 'x'}
+
+	for _, replaced := range []bool{false, true} {
+		old := &Proxy{username: "Steve", logger: log.New(io.Discard, "", 0)}
+		old.commandQueue = []queuedPacket{
+			{stale, time.Now().Add(-getConfig().CommandQueueMaxAge - time.Second)},
+			{fresh, time.Now()},
+		}
+
+		p := &Proxy{username: "Steve", logger: log.New(io.Discard, "", 0)}
+		p.setServerThreshold(-1)
+		if replaced {
+			p.resumeSession(old)
+		} else {
+			old.saveSession()
+			p.resumeSession(nil)
+		}
+		if old.commandQueue != nil {
+			t.Errorf("replaced %v: the old connection kept %d queued commands", replaced, len(old.commandQueue))
+		}
+
+		p.setState(StatePlay)
+		w := &bytes.Buffer{}
+		if err := p.flushCommandQueue(w); err != nil {
+			t.Fatal(err)
+		}
+		packets := readAllPackets(t, w.Bytes())
+		if len(packets) != 1 || !bytes.Equal(packets[0], fresh) {
+			t.Errorf("replaced %v: sent %q after the reconnect, want only the fresh command", replaced, packets)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// A packet rewriting rule from the config file
+type Rule struct {
+	State     string `json:"state"`     // "handshaking", "status", "login" or "play"
+	Direction string `json:"direction"` // "serverbound" or "clientbound"
+	PacketID  int    `json:"packet_id"`
+	Action    string `json:"action"` // "drop", "log" or "replace"
+	// Only for "replace", applied to the String the packet starts with (e.g. the JSON of a Chat Message)
+	Find    string `json:"find"`
+	Replace string `json:"replace"`
+
+	state State
+}
+
+var ruleStates = map[string]State{
+	"handshaking": StateHandshaking,
+	"status":      StateStatus,
+	"login":       StateLogin,
+	"play":        StatePlay,
+}
+
+// Protocol maximum for a String, in bytes
+const maxStringLength = 32767
+
+const maxRules = 64
+
+var rules []Rule
+var rulesMutex sync.RWMutex
+
+// Checks the rules and fills in the parsed state
+func validateRules(newRules []Rule) error {
+	if len(newRules) > maxRules {
+		return fmt.Errorf("At most %d rules are allowed", maxRules)
+	}
+	for i := range newRules {
+		rule := &newRules[i]
+		state, ok := ruleStates[strings.ToLower(rule.State)]
+		if !ok {
+			return fmt.Errorf("Rule %d: invalid state %q", i, rule.State)
+		}
+		rule.state = state
+		if rule.Direction != "serverbound" && rule.Direction != "clientbound" {
+			return fmt.Errorf("Rule %d: invalid direction %q", i, rule.Direction)
+		}
+		switch rule.Action {
+		case "drop", "log":
+		case "replace":
+			if rule.Find == "" {
+				return fmt.Errorf("Rule %d: replace needs a non-empty find", i)
+			}
+			if name, ok := textPackets[rule.Direction][rule.PacketID]; ok && state == StatePlay {
+				return fmt.Errorf("Rule %d: %s packets don't start with a String, replace can't be used for them", i, name)
+			}
+		default:
+			return fmt.Errorf("Rule %d: invalid action %q", i, rule.Action)
+		}
+	}
+	return nil
+}
+
+// Returns whether any rule applies to the packet, without applying them
+func hasRules(state State, clientToServer bool, packetID int) bool {
+	rulesMutex.RLock()
+	defer rulesMutex.RUnlock()
+
+	direction := "clientbound"
+	if clientToServer {
+		direction = "serverbound"
+	}
+	for _, rule := range rules {
+		if rule.state == state && rule.Direction == direction && rule.PacketID == packetID {
+			return true
+		}
+	}
+	return false
+}
+
+// Applies the matching rules in order to packet (packet ID + data)
+// Returns:
+// []byte: the packet, rewritten by replace rules
+// bool: true if the packet should be dropped
+func applyRules(logger *log.Logger, state State, clientToServer bool, packetID int, packet []byte) ([]byte, bool) {
+	rulesMutex.RLock()
+	defer rulesMutex.RUnlock()
+
+	direction := "clientbound"
+	if clientToServer {
+		direction = "serverbound"
+	}
+
+	for _, rule := range rules {
+		if rule.state != state || rule.Direction != direction || rule.PacketID != packetID {
+			continue
+		}
+		switch rule.Action {
+		case "drop":
+			return packet, true
+		case "log":
+			logger.Printf("Rule matched %s packet 0x%02X: %q", direction, packetID, packet)
+		case "replace":
+			rewritten, err := replaceLeadingString(packet, rule.Find, rule.Replace)
+			if err != nil {
+				logger.Printf("Rule for %s packet 0x%02X not applied: %s", direction, packetID, err)
+				continue
+			}
+			packet = rewritten
+		}
+	}
+	return packet, false
+}
+
+// Replaces find in the String following the packet ID, the length prefix is rewritten so the
+// rest of the packet stays intact
+func replaceLeadingString(packet []byte, find string, replace string) ([]byte, error) {
+	reader := bytes.NewReader(packet)
+	packetID, _, err := readVarInt(reader)
+	if err != nil {
+		return nil, err
+	}
+	// Checked before reading since the packet might not start with a String at all
+	valueLength, _, err := readVarInt(reader)
+	if err != nil {
+		return nil, err
+	}
+	if valueLength < 0 || valueLength > reader.Len() {
+		return nil, fmt.Errorf("Packet doesn't start with a String")
+	}
+	value := make([]byte, valueLength)
+	if _, err := io.ReadFull(reader, value); err != nil {
+		return nil, err
+	}
+	if !utf8.Valid(value) {
+		return nil, fmt.Errorf("Packet doesn't start with a String")
+	}
+
+	replaced := strings.ReplaceAll(string(value), find, replace)
+	if len(replaced) > maxStringLength {
+		return nil, fmt.Errorf("Replaced String is longer than %d bytes", maxStringLength)
+	}
+
+	var rewritten bytes.Buffer
+	if err := writeVarInt(&rewritten, packetID); err != nil {
+		return nil, err
+	}
+	if err := writeVarInt(&rewritten, len(replaced)); err != nil {
+		return nil, err
+	}
+	rewritten.WriteString(replaced)
+	// Whatever followed the String
+	rewritten.Write(packet[len(packet)-reader.Len():])
+	return rewritten.Bytes(), nil
+}
@@ -0,0 +1,130 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"io"
+	"strings"
+)
+
+// Results of a Bedwars mode during this connection, for /session
+type SessionStats struct {
+	Wins   int
+	Losses int
+	// Own stats from before the first game of the mode ended, nil if they haven't been fetched
+	Before   *BedwarsStats
+	fetching bool
+}
+
+// Order of the modes in /session
+var sessionModes = []BedwarsType{BedwarsTypeSolo, BedwarsTypeDoubles, BedwarsType3v3v3v3, BedwarsType4v4v4v4, BedwarsType4v4}
+
+// Starts tracking bedwarsType after /locraw reported a game of it on server, fetching the stats to
+// project the session's results onto in the background
+func (p *Proxy) startSessionMode(bedwarsType BedwarsType, server string) {
+	p.commandMutex.Lock()
+	defer p.commandMutex.Unlock()
+
+	// /locraw is sent again after every respawn and reconnect within the same game
+	if server != p.gameServer || server == "" {
+		p.gameRecorded = false
+	}
+	p.gameServer = server
+	stats, ok := p.session[bedwarsType]
+	if !ok {
+		stats = &SessionStats{}
+		p.session[bedwarsType] = stats
+	}
+	// Once a game has ended the API could already include it
+	if p.services.hypixel == nil || stats.Before != nil || stats.fetching || stats.Wins+stats.Losses > 0 {
+		return
+	}
+
+	stats.fetching = true
+	submitted := apiWorkers.submit(func() {
+		before, err := p.services.hypixel.getBedwarsStats(p.uuid, bedwarsType)
+		if err != nil {
+			p.logger.Println("Failed to fetch the session's starting stats:", err)
+		}
+
+		p.commandMutex.Lock()
+		defer p.commandMutex.Unlock()
+		stats.fetching = false
+		if stats.Wins+stats.Losses == 0 {
+			stats.Before = before
+		}
+	})
+	if !submitted {
+		stats.fetching = false
+	}
+}
+
+// Counts the game that just ended towards the mode of the current game, returns false if it had
+// already been counted or there is no current game
+func (p *Proxy) recordGameResult(won bool) bool {
+	p.commandMutex.Lock()
+	defer p.commandMutex.Unlock()
+
+	if p.bedwarsType == nil {
+		return false
+	}
+
+	// Hypixel can send the same title more than once
+	if p.gameRecorded {
+		return false
+	}
+	p.gameRecorded = true
+
+	stats, ok := p.session[*p.bedwarsType]
+	if !ok {
+		stats = &SessionStats{}
+		p.session[*p.bedwarsType] = stats
+	}
+	if won {
+		stats.Wins++
+	} else {
+		stats.Losses++
+	}
+	return true
+}
+
+// Handles /session
+func (p *Proxy) handleSession(w io.Writer) error {
+	p.commandMutex.Lock()
+	var lines []string
+	var wins, losses int
+	for _, bedwarsType := range sessionModes {
+		stats, ok := p.session[bedwarsType]
+		if !ok || stats.Wins+stats.Losses == 0 {
+			continue
+		}
+		wins += stats.Wins
+		losses += stats.Losses
+
+		line := p.translate("session.mode", capitaliseFirst(string(bedwarsType)), stats.Wins, stats.Losses, statRatio(stats.Wins, stats.Losses))
+		if stats.Before != nil {
+			before := statRatio(stats.Before.Wins, stats.Before.Losses)
+			after := statRatio(stats.Before.Wins+stats.Wins, stats.Before.Losses+stats.Losses)
+			line += p.translate("session.wlr_change", before, after)
+		}
+		lines = append(lines, line)
+	}
+	p.commandMutex.Unlock()
+
+	message := "§bGoMCProxy Session: " + p.translate("session.none")
+	if len(lines) > 0 {
+		message = "§bGoMCProxy Session: " + p.translate("session.total", wins, losses, wins+losses, statRatio(wins, losses)) + "\n" + strings.Join(lines, "\n")
+	}
+	return p.writeChatMessageToClient(message, ChatTypeChat, w)
+}
+
+// Like Hypixel, a ratio without anything to divide by is the first stat, e.g. the wins of a player
+// without losses
+func statRatio(stat int, divisor int) float32 {
+	if divisor == 0 {
+		return float32(stat)
+	}
+	return float32(stat) / float32(divisor)
+}
@@ -0,0 +1,182 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Snapshot struct {
+	Stats   *PlayerStats `json:"stats"`
+	TakenAt time.Time    `json:"takenAt"`
+}
+
+// Stats saved with /sc snap to compare against with /sc diff, by UUID without dashes
+type Snapshots struct {
+	path      string // Empty keeps the snapshots in memory only
+	snapshots map[string]*Snapshot
+	mutex     sync.Mutex
+}
+
+// Reads the snapshots at path, a missing file has none
+func loadSnapshots(path string) (*Snapshots, error) {
+	s := &Snapshots{path: path, snapshots: make(map[string]*Snapshot)}
+	if path == "" {
+		return s, nil
+	}
+	err := readJSONFile(path, &s.snapshots)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func snapshotKey(uuid string) string {
+	return strings.ToLower(strings.ReplaceAll(uuid, "-", ""))
+}
+
+// Replaces the player's snapshot
+func (s *Snapshots) put(uuid string, stats *PlayerStats) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.snapshots[snapshotKey(uuid)] = &Snapshot{stats, time.Now()}
+	if s.path == "" {
+		return nil
+	}
+	return writeJSONFile(s.path, s.snapshots)
+}
+
+func (s *Snapshots) get(uuid string) (*Snapshot, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snapshot, ok := s.snapshots[snapshotKey(uuid)]
+	return snapshot, ok
+}
+
+// Handles /sc snap [player], without a player it saves your own stats
+// Returns:
+// bool: true if the snapshot was saved
+func (p *Proxy) handleSnapshot(args []string, w io.Writer) bool {
+	writeMessage := func(text string) {
+		if err := p.writeChatMessageToClient("§bGoMCProxy StatCheck: "+text, ChatTypeChat, w); err != nil {
+			p.errorChecker(err)
+		}
+	}
+
+	if len(args) > 1 {
+		writeMessage(p.translate("snapshots.snap_usage"))
+		return false
+	}
+	playerUuid, playerName := p.uuid, ""
+	if len(args) == 1 {
+		var err error
+		playerUuid, playerName, err = p.services.resolvePlayer(args[0])
+		if err != nil {
+			writeMessage(p.translate(playerProfileErrorKey(err)))
+			return false
+		}
+	}
+
+	playerStats, err := p.services.hypixel.getPlayerStats(playerUuid)
+	if err != nil {
+		writeMessage(p.translate(hypixelErrorKey(err)))
+		return false
+	}
+	if playerName == "" {
+		playerName = playerStats.Player.DisplayName
+	}
+
+	if err := p.services.snapshots.put(playerUuid, playerStats); err != nil {
+		writeMessage(p.translate("snapshots.save_failed", err.Error()))
+		return false
+	}
+	writeMessage(p.translate("snapshots.saved", playerStats.rankPrefix(), playerName))
+	return true
+}
+
+// Handles /sc diff [mode] [player], without a mode it uses the current one and without a player it
+// compares your own stats
+// Returns:
+// bool: true if the changes were shown
+func (p *Proxy) handleSnapshotDiff(args []string, w io.Writer) bool {
+	writeMessage := func(text string) {
+		if err := p.writeChatMessageToClient("§bGoMCProxy StatCheck: "+text, ChatTypeChat, w); err != nil {
+			p.errorChecker(err)
+		}
+	}
+
+	if len(args) > 2 {
+		writeMessage(p.translate("snapshots.diff_usage"))
+		return false
+	}
+	bedwarsType, hasMode := p.currentBedwarsType()
+	if len(args) > 0 {
+		if argType, ok := GetBedwarsType(strings.ToLower(args[0])); ok {
+			bedwarsType, hasMode = argType, true
+			args = args[1:]
+		} else if len(args) == 2 {
+			writeMessage(p.translate("statcheck.invalid_type"))
+			return false
+		}
+	}
+	if !hasMode {
+		writeMessage(p.translate("snapshots.diff_mode_required"))
+		return false
+	}
+
+	playerUuid := p.uuid
+	if len(args) == 1 {
+		var err error
+		playerUuid, _, err = p.services.resolvePlayer(args[0])
+		if err != nil {
+			writeMessage(p.translate(playerProfileErrorKey(err)))
+			return false
+		}
+	}
+
+	snapshot, ok := p.services.snapshots.get(playerUuid)
+	if !ok {
+		writeMessage(p.translate("snapshots.none"))
+		return false
+	}
+	playerStats, err := p.services.hypixel.getPlayerStats(playerUuid)
+	if err != nil {
+		writeMessage(p.translate(hypixelErrorKey(err)))
+		return false
+	}
+
+	before, err := snapshot.Stats.bedwarsStats(bedwarsType)
+	if err != nil {
+		writeMessage(p.translate("statcheck.invalid_type"))
+		return false
+	}
+	after, err := playerStats.bedwarsStats(bedwarsType)
+	if err != nil {
+		writeMessage(p.translate("statcheck.invalid_type"))
+		return false
+	}
+
+	lines := []string{
+		"§bGoMCProxy StatCheck: " + p.translate("snapshots.diff.header",
+			capitaliseFirst(string(bedwarsType)), after.Rank, after.DisplayName, time.Since(snapshot.TakenAt).Truncate(time.Second)),
+		p.translate("snapshots.diff.stars", before.Stars, after.Stars),
+		p.translate("snapshots.diff.wins", after.Wins-before.Wins, after.Losses-before.Losses),
+		p.translate("snapshots.diff.finals", after.FinalKills-before.FinalKills, after.FinalDeaths-before.FinalDeaths),
+		p.translate("snapshots.diff.fkdr", before.FinalKD, after.FinalKD, after.FinalKD-before.FinalKD),
+		p.translate("snapshots.diff.wlr", before.WL, after.WL, after.WL-before.WL),
+	}
+	if err := p.writePagedMessage(strings.Join(lines, "\n"), w); err != nil {
+		p.errorChecker(err)
+	}
+	return true
+}
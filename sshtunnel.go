@@ -0,0 +1,146 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// The SSH server -ssh-tunnel dials the backend through. It is connected to on the first dial and
+// again on the next dial after the connection was lost.
+type SSHTunnel struct {
+	addr   string
+	config *ssh.ClientConfig
+	client *ssh.Client
+	mutex  sync.Mutex
+}
+
+var sshTunnel *SSHTunnel
+
+// Parses -ssh-tunnel user@host[:port], without a port the SSH server is on port 22. It logs in with
+// the unencrypted private key at keyPath and then with password, either can be empty but not both.
+// The server's host key has to be in knownHostsPath, ~/.ssh/known_hosts if it is empty.
+func newSSHTunnel(target string, keyPath string, password string, knownHostsPath string) (*SSHTunnel, error) {
+	at := strings.LastIndex(target, "@")
+	if at <= 0 || at == len(target)-1 {
+		return nil, fmt.Errorf("-ssh-tunnel %s has to be user@host:port", target)
+	}
+	user, addr := target[:at], target[at+1:]
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(strings.Trim(addr, "[]"), "22")
+	}
+
+	var auth []ssh.AuthMethod
+	if keyPath != "" {
+		data, err := os.ReadFile(keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read -ssh-key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		var passphraseMissing *ssh.PassphraseMissingError
+		if errors.As(err, &passphraseMissing) {
+			return nil, fmt.Errorf("-ssh-key %s is encrypted, which isn't supported", keyPath)
+		} else if err != nil {
+			return nil, fmt.Errorf("Invalid -ssh-key %s: %w", keyPath, err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if password != "" {
+		auth = append(auth, ssh.Password(password))
+	}
+	if len(auth) == 0 {
+		return nil, errors.New("-ssh-tunnel needs -ssh-key or -ssh-password to log in with")
+	}
+
+	if knownHostsPath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to find ~/.ssh/known_hosts, give -ssh-known-hosts instead: %w", err)
+		}
+		knownHostsPath = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read the known hosts: %w", err)
+	}
+
+	return &SSHTunnel{
+		addr: addr,
+		config: &ssh.ClientConfig{
+			User: user,
+			Auth: auth,
+			HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+				err := hostKeyCallback(hostname, remote, key)
+				var keyErr *knownhosts.KeyError
+				if errors.As(err, &keyErr) && len(keyErr.Want) == 0 {
+					return fmt.Errorf("%s isn't in %s, connect to it with ssh once to add its host key", hostname, knownHostsPath)
+				} else if errors.As(err, &keyErr) {
+					return fmt.Errorf("the host key of %s doesn't match the one in %s", hostname, knownHostsPath)
+				}
+				return err
+			},
+			Timeout: 10 * time.Second,
+		},
+	}, nil
+}
+
+// Returns the client connected to the SSH server, connecting first if there is none
+func (t *SSHTunnel) connect() (*ssh.Client, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.client != nil {
+		return t.client, nil
+	}
+	client, err := ssh.Dial("tcp", t.addr, t.config)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to the SSH server %s: %w", t.addr, err)
+	}
+	log.Printf("Connected to the SSH server %s", t.addr)
+	t.client = client
+
+	go func() {
+		err := client.Wait()
+		log.Printf("The connection to the SSH server %s was closed: %v", t.addr, err)
+		t.mutex.Lock()
+		if t.client == client {
+			t.client = nil
+		}
+		t.mutex.Unlock()
+	}()
+	return client, nil
+}
+
+// Dials forwardAddr from the SSH server, which resolves it, so 127.0.0.1 is the SSH server itself
+func (t *SSHTunnel) dial(forwardAddr string) (net.Conn, error) {
+	client, err := t.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := client.DialContext(ctx, "tcp", forwardAddr)
+	if errors.Is(err, context.DeadlineExceeded) {
+		// The connection is likely dead without the server having closed it, the next dial reconnects
+		client.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to dial %s through the SSH server %s: %w", forwardAddr, t.addr, err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,312 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const testSSHPassword = "hunter2"
+
+// Listens on a local port, accepting connections with handle until the test ends
+func listenTest(t *testing.T, handle func(net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// An SSH server that only forwards direct-tcpip channels, like ssh -L asks for, and accepts
+// testSSHPassword and clientKey
+// Returns:
+// string: the address it listens on
+// ssh.PublicKey: its host key
+// *atomic.Int32: the number of channels it forwarded
+func startTestSSHServer(t *testing.T, clientKey ssh.PublicKey) (string, ssh.PublicKey, *atomic.Int32) {
+	t.Helper()
+	_, hostPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(_ ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) == testSSHPassword {
+				return nil, nil
+			}
+			return nil, errors.New("wrong password")
+		},
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown key")
+		},
+	}
+	config.AddHostKey(hostSigner)
+	forwarded := &atomic.Int32{}
+
+	addr := listenTest(t, func(conn net.Conn) {
+		_, channels, requests, err := ssh.NewServerConn(conn, config)
+		if err != nil {
+			conn.Close()
+			return
+		}
+		go ssh.DiscardRequests(requests)
+		for newChannel := range channels {
+			var target struct {
+				Host       string
+				Port       uint32
+				OriginHost string
+				OriginPort uint32
+			}
+			if newChannel.ChannelType() != "direct-tcpip" || ssh.Unmarshal(newChannel.ExtraData(), &target) != nil {
+				newChannel.Reject(ssh.UnknownChannelType, "only direct-tcpip is supported")
+				continue
+			}
+			backendConn, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+			if err != nil {
+				newChannel.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+			channel, channelRequests, err := newChannel.Accept()
+			if err != nil {
+				backendConn.Close()
+				continue
+			}
+			forwarded.Add(1)
+			go ssh.DiscardRequests(channelRequests)
+			go func() {
+				io.Copy(channel, backendConn)
+				channel.Close()
+			}()
+			go func() {
+				io.Copy(backendConn, channel)
+				backendConn.Close()
+			}()
+		}
+	})
+	return addr, hostSigner.PublicKey(), forwarded
+}
+
+// Writes the files of a client key and a known_hosts file with the server's host key
+// Returns:
+// string: the path of the private key
+// string: the path of the known_hosts file
+func writeTestSSHFiles(t *testing.T, clientPrivateKey ed25519.PrivateKey, serverAddr string, hostKey ssh.PublicKey) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	block, err := ssh.MarshalPrivateKey(clientPrivateKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	knownHostsPath := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(serverAddr)}, hostKey) + "\n"
+	if err := os.WriteFile(knownHostsPath, []byte(line), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return keyPath, knownHostsPath
+}
+
+// Dials backendAddr through tunnel and checks that what is written comes back
+func checkTunnelEcho(t *testing.T, tunnel *SSHTunnel, backendAddr string) {
+	t.Helper()
+	conn, err := tunnel.dial(backendAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil || string(reply) != "ping" {
+		t.Fatalf("read %q (%v), want the echoed ping", reply, err)
+	}
+}
+
+func TestSSHTunnelDial(t *testing.T) {
+	clientPublicKey, clientPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPublicKey, err := ssh.NewPublicKey(clientPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverAddr, hostKey, _ := startTestSSHServer(t, sshPublicKey)
+	keyPath, knownHostsPath := writeTestSSHFiles(t, clientPrivateKey, serverAddr, hostKey)
+	backendAddr := listenTest(t, func(conn net.Conn) {
+		io.Copy(conn, conn)
+		conn.Close()
+	})
+
+	tests := []struct {
+		name     string
+		keyPath  string
+		password string
+	}{
+		{"key", keyPath, ""},
+		{"password", "", testSSHPassword},
+		{"wrong password after the key", keyPath, "wrong"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tunnel, err := newSSHTunnel("steve@"+serverAddr, tt.keyPath, tt.password, knownHostsPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkTunnelEcho(t, tunnel, backendAddr)
+
+			// After the connection to the SSH server is lost the next dial reconnects
+			tunnel.mutex.Lock()
+			tunnel.client.Close()
+			tunnel.mutex.Unlock()
+			for deadline := time.Now().Add(5 * time.Second); ; {
+				tunnel.mutex.Lock()
+				closed := tunnel.client == nil
+				tunnel.mutex.Unlock()
+				if closed {
+					break
+				} else if time.Now().After(deadline) {
+					t.Fatal("the closed connection wasn't forgotten")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			checkTunnelEcho(t, tunnel, backendAddr)
+		})
+	}
+
+	t.Run("wrong password", func(t *testing.T) {
+		tunnel, err := newSSHTunnel("steve@"+serverAddr, "", "wrong", knownHostsPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tunnel.dial(backendAddr); err == nil {
+			t.Error("logged in with the wrong password")
+		}
+	})
+
+	t.Run("unknown host", func(t *testing.T) {
+		emptyKnownHosts := filepath.Join(t.TempDir(), "known_hosts")
+		if err := os.WriteFile(emptyKnownHosts, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		tunnel, err := newSSHTunnel("steve@"+serverAddr, keyPath, "", emptyKnownHosts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tunnel.dial(backendAddr); err == nil || !strings.Contains(err.Error(), "isn't in") {
+			t.Errorf("dialed an unknown host: %v", err)
+		}
+	})
+}
+
+func TestNewSSHTunnelInvalid(t *testing.T) {
+	knownHostsPath := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(knownHostsPath, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		target   string
+		keyPath  string
+		password string
+	}{
+		{"example.com:22", "", testSSHPassword},
+		{"@example.com:22", "", testSSHPassword},
+		{"steve@", "", testSSHPassword},
+		{"steve@example.com:22", "", ""},
+		{"steve@example.com:22", knownHostsPath, ""}, // Not a private key
+	}
+	for _, tt := range tests {
+		if _, err := newSSHTunnel(tt.target, tt.keyPath, tt.password, knownHostsPath); err == nil {
+			t.Errorf("newSSHTunnel(%q, %q, %q) didn't fail", tt.target, tt.keyPath, tt.password)
+		}
+	}
+
+	// The port defaults to 22
+	tunnel, err := newSSHTunnel("steve@example.com", "", testSSHPassword, knownHostsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tunnel.addr != "example.com:22" {
+		t.Errorf("addr %s, want example.com:22", tunnel.addr)
+	}
+}
+
+// The status cache, /ping and -doctor reach the backend through the tunnel like the players do
+func TestFetchBackendStatusThroughTunnel(t *testing.T) {
+	_, clientPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverAddr, hostKey, forwarded := startTestSSHServer(t, nil)
+	_, knownHostsPath := writeTestSSHFiles(t, clientPrivateKey, serverAddr, hostKey)
+	tunnel, err := newSSHTunnel("steve@"+serverAddr, "", testSSHPassword, knownHostsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshTunnel = tunnel
+	t.Cleanup(func() { sshTunnel = nil })
+
+	const statusJSON = `{"description":{"text":"through the tunnel"}}`
+	backendAddr := listenTest(t, func(conn net.Conn) {
+		defer conn.Close()
+		threshold := -1
+		readPacket(conn, &threshold) // Handshake
+		readPacket(conn, &threshold) // Status Request
+		writePacket(conn, createStringPacket(0x00, statusJSON), threshold)
+	})
+
+	p := &Proxy{forwardAddr: backendAddr, logger: log.New(io.Discard, "", 0)}
+	got, err := p.fetchBackendStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != statusJSON {
+		t.Errorf("status %s, want %s", got, statusJSON)
+	}
+	if n := forwarded.Load(); n != 1 {
+		t.Errorf("the SSH server forwarded %d connections, want the status ping", n)
+	}
+}
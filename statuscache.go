@@ -0,0 +1,113 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// Status Responses of the backend by forward address
+var backendStatusCache = newCache[[]byte]()
+
+// Pings the backend as a server list client would, a single attempt so /ping measures one dial
+// Returns:
+// []byte: the JSON of the backend's Status Response
+func (p *Proxy) fetchBackendStatus() ([]byte, error) {
+	conn, err := dialBackendOnce(p.forwardAddr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		// Connections through -ssh-tunnel have no deadlines, closing it ends a read that hangs
+		timer := time.AfterFunc(10*time.Second, func() { conn.Close() })
+		defer timer.Stop()
+	}
+
+	handshakePacket, err := p.createHandshakePacket(StateStatus)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(handshakePacket); err != nil {
+		return nil, err
+	}
+
+	// Status Request
+	// The status connection has no compression, unlike the play connection
+	threshold := -1
+	if err := writePacket(conn, []byte{0x00}, threshold); err != nil {
+		return nil, err
+	}
+
+	// Status Response
+	_, packetData, err := readPacket(conn, &threshold)
+	if err != nil {
+		return nil, err
+	}
+	packetReader := bytes.NewReader(packetData)
+	packetID, _, err := readVarInt(packetReader)
+	if err != nil {
+		return nil, err
+	}
+	if packetID != 0x00 {
+		return nil, errors.New("Expected a Status Response")
+	}
+	return readPrefixedBytes(packetReader)
+}
+
+// Answers a pinging client from backendStatusCache, fetching the backend's status first if the
+// cached one is older than config.StatusCacheTTL. The client's handshake is read first, if the
+// client isn't a 1.8 client pinging or the backend can't be reached, the client has to be proxied
+// as usual.
+// Returns:
+// net.Conn: the client connection to proxy, with its handshake still unread, or nil if the client has been answered
+func (p *Proxy) answerFromStatusCache(clientConn net.Conn) net.Conn {
+	clientConn.SetDeadline(time.Now().Add(10 * time.Second))
+	defer clientConn.SetDeadline(time.Time{})
+
+	var handshake bytes.Buffer
+	threshold := p.getClientThreshold()
+	protocol, intent, err := readHandshake(io.TeeReader(clientConn, &handshake), &threshold)
+	if err != nil {
+		p.logger.Println("Failed to read the handshake:", err)
+		return nil
+	}
+
+	replayedConn := &replayConn{Conn: clientConn, r: io.MultiReader(&handshake, clientConn)}
+	if protocol != 47 || State(intent) != StateStatus {
+		return replayedConn
+	}
+
+	cfg := getConfig()
+	statusJSON, ok := backendStatusCache.get(p.forwardAddr, cfg.StatusCacheTTL)
+	if !ok {
+		statusJSON, err = p.fetchBackendStatus()
+		if err != nil {
+			p.logger.Println("Failed to fetch the backend's status:", err)
+			return replayedConn
+		}
+		backendStatusCache.put(p.forwardAddr, statusJSON, cfg.CacheSize)
+	}
+
+	p.setState(StateStatus)
+	if err := p.answerStatusJSON(clientConn, statusJSON); err != nil {
+		p.logger.Println("Failed to answer the status request:", err)
+	}
+	return nil
+}
+
+// Connection that reads r instead, for handing on a connection after reading some of it
+type replayConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *replayConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
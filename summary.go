@@ -0,0 +1,182 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The summary Hypixel shows when a Bedwars game ends, framed by lines of ▬ and centred with spaces:
+//
+//	Bed Wars
+//	Winner - [MVP+] Steve          (Winners - [MVP+] Steve, [VIP] Alex in team modes)
+//	1st Killer - [VIP] Alex - 12
+//	2nd Killer - Notch - 8
+//
+// Hypixel sends it as one message with a line per line of chat or as a message per line, both go
+// through addSummaryLine.
+type gameSummary struct {
+	winners []string
+	killers []summaryKiller // Most kills first
+}
+
+type summaryKiller struct {
+	name  string
+	kills int
+}
+
+// Lines of the summary that is being read, more than this isn't a game summary
+const maxSummaryLines = 16
+
+var summaryWinnersRegex = regexp.MustCompile(`^Winners? - (.+)$`)
+
+var summaryKillerRegex = regexp.MustCompile(`^\d(?:st|nd|rd|th) Killer - (.+) - (\d+)$`)
+
+// Returns whether line is a line of ▬ framing the summary
+func isSummarySeparator(line string) bool {
+	return strings.Contains(line, "▬") && strings.Trim(line, "▬ ") == ""
+}
+
+// Returns the name of a player as the summary shows it, e.g. "[MVP+] Steve" or "Red [VIP] Alex"
+func summaryPlayerName(player string) string {
+	fields := strings.Fields(player)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[len(fields)-1]
+}
+
+// Parses the lines between the separators, returns nil if they aren't a Bedwars game summary
+func parseGameSummary(lines []string) *gameSummary {
+	if len(lines) == 0 || lines[0] != "Bed Wars" {
+		return nil
+	}
+	summary := &gameSummary{}
+	for _, line := range lines[1:] {
+		if match := summaryWinnersRegex.FindStringSubmatch(line); match != nil {
+			for _, winner := range strings.Split(match[1], ",") {
+				if name := summaryPlayerName(winner); name != "" {
+					summary.winners = append(summary.winners, name)
+				}
+			}
+		} else if match := summaryKillerRegex.FindStringSubmatch(line); match != nil {
+			kills, err := strconv.Atoi(match[2])
+			if err != nil {
+				continue
+			}
+			summary.killers = append(summary.killers, summaryKiller{summaryPlayerName(match[1]), kills})
+		}
+	}
+	if summary.winners == nil {
+		return nil
+	}
+	return summary
+}
+
+// Feeds a clientbound chat message's lines into the summary being read, only called by the
+// clientbound proxyTraffic
+func (p *Proxy) detectGameSummary(message string, clientConn io.Writer) error {
+	for _, line := range strings.Split(colorCodeRegex.ReplaceAllString(message, ""), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !isSummarySeparator(line) {
+			if p.summaryLines != nil {
+				p.summaryLines = append(p.summaryLines, line)
+				if len(p.summaryLines) > maxSummaryLines {
+					p.summaryLines = nil
+				}
+			}
+			continue
+		}
+
+		// A separator without lines before it opens a summary, e.g. after one that was missed
+		if len(p.summaryLines) == 0 {
+			p.summaryLines = make([]string, 0, maxSummaryLines)
+			continue
+		}
+		summary := parseGameSummary(p.summaryLines)
+		p.summaryLines = nil
+		if summary != nil {
+			if err := p.handleGameSummary(summary, clientConn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Counts the game's result towards /session and the highlights, which the title normally already
+// did, and shows the recap with -game-recap
+func (p *Proxy) handleGameSummary(summary *gameSummary, clientConn io.Writer) error {
+	won := containsFold(summary.winners, p.username)
+	if p.recordGameResult(won) && won {
+		p.recordHighlight("win", summary.playerDetail(p.username))
+	}
+
+	if !getConfig().GameRecap {
+		return nil
+	}
+	return p.writeChatMessageToClient(p.formatGameRecap(summary, won), ChatTypeChat, clientConn)
+}
+
+// Describes name's place among the top killers, e.g. "1st killer with 12 kills", empty if they aren't one
+func (s *gameSummary) playerDetail(name string) string {
+	for i, killer := range s.killers {
+		if strings.EqualFold(killer.name, name) {
+			return fmt.Sprintf("%s killer with %d kills", ordinal(i+1), killer.kills)
+		}
+	}
+	return ""
+}
+
+func (p *Proxy) formatGameRecap(summary *gameSummary, won bool) string {
+	var sb strings.Builder
+	sb.WriteString("§bGoMCProxy Recap: ")
+	if won {
+		sb.WriteString(p.translate("recap.victory"))
+	} else {
+		sb.WriteString(p.translate("recap.defeat"))
+	}
+	if bedwarsType, ok := p.currentBedwarsType(); ok {
+		sb.WriteString(p.translate("recap.mode", capitaliseFirst(string(bedwarsType))))
+	}
+
+	highlight := func(name string) string {
+		if strings.EqualFold(name, p.username) {
+			return "§a" + name + "§r"
+		}
+		return "§f" + name + "§r"
+	}
+	winners := make([]string, len(summary.winners))
+	for i, winner := range summary.winners {
+		winners[i] = highlight(winner)
+	}
+	sb.WriteString("\n" + p.translate("recap.winners", strings.Join(winners, ", ")))
+	for i, killer := range summary.killers {
+		sb.WriteString("\n" + p.translate("recap.killer", ordinal(i+1), highlight(killer.name), killer.kills))
+	}
+	return sb.String()
+}
+
+// Returns n with its English ordinal suffix, e.g. "2nd"
+func ordinal(n int) string {
+	suffix := "th"
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+	case n%10 == 1:
+		suffix = "st"
+	case n%10 == 2:
+		suffix = "nd"
+	case n%10 == 3:
+		suffix = "rd"
+	}
+	return strconv.Itoa(n) + suffix
+}
@@ -0,0 +1,166 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+)
+
+// A scoreboard team, Bedwars puts every player of a team color in one of them
+type Team struct {
+	Prefix  string
+	Suffix  string
+	Color   byte // Color code, e.g. 'c' for red, 0 if the team has none
+	Players map[string]struct{}
+}
+
+// Team modes of the Teams packet
+const (
+	teamCreate        = 0
+	teamRemove        = 1
+	teamUpdate        = 2
+	teamAddPlayers    = 3
+	teamRemovePlayers = 4
+)
+
+// Color codes by the color index of the Teams packet
+const teamColorCodes = "0123456789abcdef"
+
+var colorOnlyCodeRegex = regexp.MustCompile(`§([0-9a-f])`)
+
+// Reads a Teams packet and keeps track of the teams and which team every player is on
+func (p *Proxy) handleTeams(packetReader *bytes.Reader) error {
+	name, err := readPrefixedBytes(packetReader)
+	if err != nil {
+		return err
+	}
+	mode, err := packetReader.ReadByte()
+	if err != nil {
+		return err
+	}
+
+	p.teamsMutex.Lock()
+	defer p.teamsMutex.Unlock()
+
+	team, ok := p.teams[string(name)]
+	switch mode {
+	case teamCreate, teamUpdate:
+		if !ok {
+			team = &Team{Players: make(map[string]struct{})}
+			p.teams[string(name)] = team
+		}
+		if err := team.readInfo(packetReader); err != nil {
+			return err
+		}
+		if mode == teamUpdate {
+			return nil
+		}
+	case teamRemove:
+		if ok {
+			for player := range team.Players {
+				delete(p.playerTeams, player)
+			}
+			delete(p.teams, string(name))
+		}
+		return nil
+	case teamAddPlayers, teamRemovePlayers:
+		if !ok {
+			return fmt.Errorf("Players changed of unknown team %q", name)
+		}
+	default:
+		return fmt.Errorf("Unknown team mode %d", mode)
+	}
+
+	count, _, err := readVarInt(packetReader)
+	if err != nil {
+		return err
+	}
+	for range count {
+		player, err := readPrefixedBytes(packetReader)
+		if err != nil {
+			return err
+		}
+		if mode == teamRemovePlayers {
+			delete(team.Players, string(player))
+			delete(p.playerTeams, string(player))
+			continue
+		}
+		// A player can only be on one team
+		if previous, ok := p.teams[p.playerTeams[string(player)]]; ok {
+			delete(previous.Players, string(player))
+		}
+		team.Players[string(player)] = struct{}{}
+		p.playerTeams[string(player)] = string(name)
+	}
+	return nil
+}
+
+// Reads the display name, prefix, suffix, friendly fire, name tag visibility and color
+func (t *Team) readInfo(r *bytes.Reader) error {
+	if _, err := readPrefixedBytes(r); err != nil {
+		return err
+	}
+	prefix, err := readPrefixedBytes(r)
+	if err != nil {
+		return err
+	}
+	suffix, err := readPrefixedBytes(r)
+	if err != nil {
+		return err
+	}
+	if _, err := r.ReadByte(); err != nil {
+		return err
+	}
+	if _, err := readPrefixedBytes(r); err != nil {
+		return err
+	}
+	color, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+
+	t.Prefix = string(prefix)
+	t.Suffix = string(suffix)
+	// -1 means no color, Hypixel colors the prefix instead
+	if int(color) < len(teamColorCodes) {
+		t.Color = teamColorCodes[color]
+	} else if matches := colorOnlyCodeRegex.FindAllStringSubmatch(t.Prefix, -1); matches != nil {
+		t.Color = matches[len(matches)-1][1][0]
+	} else {
+		t.Color = 0
+	}
+	return nil
+}
+
+// Returns:
+// byte: the color code of the player's team, e.g. 'c' for red
+// bool: false if the player isn't on a team with a color
+func (p *Proxy) teamColor(player string) (byte, bool) {
+	p.teamsMutex.Lock()
+	defer p.teamsMutex.Unlock()
+	team, ok := p.teams[p.playerTeams[player]]
+	if !ok || team.Color == 0 {
+		return 0, false
+	}
+	return team.Color, true
+}
+
+// Returns the players on each team color
+func (p *Proxy) playersByTeamColor() map[byte][]string {
+	p.teamsMutex.Lock()
+	defer p.teamsMutex.Unlock()
+	players := make(map[byte][]string)
+	for _, team := range p.teams {
+		if team.Color == 0 {
+			continue
+		}
+		for player := range team.Players {
+			players[team.Color] = append(players[team.Color], player)
+		}
+	}
+	return players
+}
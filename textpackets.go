@@ -0,0 +1,72 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Play packets carrying text the player wrote, after a Position instead of at the start. Replace
+// rules would read the Position as a String, so they can't be set for these.
+var textPackets = map[string]map[int]string{
+	"serverbound": {0x12: "Update Sign"},
+	"clientbound": {0x33: "Update Sign"},
+}
+
+// Plugin channels of a book being edited and a book being signed, the payload is the book's Slot
+func isBookChannel(channel string) bool {
+	return channel == "MC|BEdit" || channel == "MC|BSign"
+}
+
+// Logs the lines of a serverbound Update Sign with -log-player-text
+func (p *Proxy) logSignUpdate(packetReader *bytes.Reader) error {
+	x, y, z, err := readPosition(packetReader)
+	if err != nil {
+		return err
+	}
+	lines := make([]string, 4)
+	for i := range lines {
+		line, err := readPrefixedBytes(packetReader)
+		if err != nil {
+			return err
+		}
+		lines[i] = chatComponentText(string(line))
+	}
+	if packetReader.Len() > 0 {
+		return fmt.Errorf("%d bytes after the sign's lines", packetReader.Len())
+	}
+	p.logger.Printf("Sign at %d, %d, %d: %q", x, y, z, lines)
+	return nil
+}
+
+// Logs the title and pages of a book sent on a book channel with -log-player-text
+func (p *Proxy) logBookEdit(channel string, payload []byte) error {
+	book, err := readSlot(bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	if book == nil {
+		return errors.New("The book is an empty slot")
+	}
+
+	pages, _ := book.Tag["pages"].(NBTList)
+	texts := make([]string, 0, len(pages))
+	for _, page := range pages {
+		if text, ok := page.(string); ok {
+			texts = append(texts, text)
+		}
+	}
+
+	action := "Edited a book"
+	if channel == "MC|BSign" {
+		title, _ := book.Tag["title"].(string)
+		action = fmt.Sprintf("Signed the book %q", title)
+	}
+	p.logger.Printf("%s, %d pages: %q", action, len(texts), strings.Join(texts, " | "))
+	return nil
+}
@@ -0,0 +1,65 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// Writes are split into chunks of a second's worth of bytes divided by this, so big packets are paced too
+const throttleChunksPerSecond = 20
+
+// Paces the writes to a connection to limit bytes per second, set with -bandwidth-limit. The bytes
+// are written in order and unchanged, so the packet framing isn't affected.
+type throttledConn struct {
+	net.Conn
+	limit     int
+	next      time.Time // When the bytes written so far have been paid for
+	mutex     sync.Mutex
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newThrottledConn(conn net.Conn, limit int) *throttledConn {
+	return &throttledConn{Conn: conn, limit: limit, closed: make(chan struct{})}
+}
+
+func (c *throttledConn) Write(b []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	chunkSize := max(c.limit/throttleChunksPerSecond, 1)
+	written := 0
+	for written < len(b) {
+		if wait := time.Until(c.next); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-c.closed:
+				timer.Stop()
+				return written, net.ErrClosed
+			}
+		}
+
+		n, err := c.Conn.Write(b[written:min(written+chunkSize, len(b))])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if now := time.Now(); c.next.Before(now) {
+			c.next = now
+		}
+		c.next = c.next.Add(time.Duration(n) * time.Second / time.Duration(c.limit))
+	}
+	return written, nil
+}
+
+// Wakes up a Write that is waiting for its turn and closes the connection
+func (c *throttledConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
@@ -5,12 +5,22 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 type APIProfile struct {
@@ -19,19 +29,59 @@ type APIProfile struct {
 }
 
 var InvalidPlayer = errors.New("Invalid player")
+var InvalidPlayerName = errors.New("Invalid player name")
 
-var apiProfileCache = make(map[string]*APIProfile)
+// Java names are 3-16 characters but older accounts can be shorter, Bedrock names linked through Geyser start with a "."
+var playerNameRegex = regexp.MustCompile(`^\.?[0-9A-Za-z_]{1,16}$`)
 
-func getPlayerProfile(name string) (*APIProfile, error) {
-	if apiProfile, ok := apiProfileCache[name]; ok {
-		if apiProfile != nil {
-			return apiProfile, nil
-		}
+// With or without dashes
+var uuidRegex = regexp.MustCompile(`^([0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|[0-9a-fA-F]{32})$`)
+
+// Lowercases a UUID matching uuidRegex and puts the dashes in
+func normalizeUUID(uuid string) string {
+	uuid = strings.ToLower(strings.ReplaceAll(uuid, "-", ""))
+	return uuid[:8] + "-" + uuid[8:12] + "-" + uuid[12:16] + "-" + uuid[16:20] + "-" + uuid[20:]
+}
+
+// Joins the host and port of -listenhost and -listenport or -forwardhost and -forwardport into an
+// address, hostFlag and portFlag name the flags in the errors. IPv6 literals can be given with or
+// without brackets, a host that already includes a port is rejected.
+func joinHostPort(host string, port string, hostFlag string, portFlag string) (string, error) {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return "", fmt.Errorf("-%s %s includes a port, give the port with -%s instead", hostFlag, host, portFlag)
+	}
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+	if strings.ContainsAny(host, "[]/ ") || (strings.Contains(host, ":") && net.ParseIP(host) == nil) {
+		return "", fmt.Errorf("-%s %s isn't a valid host name or IP address", hostFlag, host)
+	}
+	if portNumber, err := strconv.Atoi(port); err != nil || portNumber < 1 || portNumber > 65535 {
+		return "", fmt.Errorf("-%s %s isn't a port, it has to be a number from 1 to 65535", portFlag, port)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+func (s *Services) getPlayerProfile(name string) (*APIProfile, error) {
+	if !playerNameRegex.MatchString(name) {
+		return nil, InvalidPlayerName
 	}
-	resp, err := http.Get("https://api.mojang.com/users/profiles/minecraft/" + name)
-	if err != nil || resp.StatusCode != 200 {
-		apiProfileCache[name] = nil
+	if apiProfile, ok := s.profiles.get(strings.ToLower(name), 0); ok {
+		return apiProfile, nil
+	}
+	resp, err := http.Get("https://api.mojang.com/users/profiles/minecraft/" + url.PathEscape(name))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent, http.StatusNotFound:
+		// The request was fine, there just is no player with this name
 		return nil, InvalidPlayer
+	default:
+		return nil, fmt.Errorf("Unexpected response from Mojang: %s", resp.Status)
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -45,11 +95,116 @@ func getPlayerProfile(name string) (*APIProfile, error) {
 		return nil, err
 	}
 
-	apiProfileCache[name] = &apiProfile
+	s.profiles.put(strings.ToLower(name), &apiProfile, getConfig().CacheSize)
 
 	return &apiProfile, nil
 }
 
+// The first bytes of a gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Reads the JSON file at path into v. Gzipped files are decompressed whatever their name, so a file
+// can be renamed to or from .gz without converting it.
+func readJSONFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if bytes.HasPrefix(data, gzipMagic) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		// The checksum is only checked at the end of the stream
+		data, err = io.ReadAll(zr)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := zr.Close(); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Writes v as indented JSON to a temporary file first, so a crash can't leave the file at path half
+// written. The JSON is gzipped if path ends in .gz.
+func writeJSONFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(path, ".gz") {
+		var compressed bytes.Buffer
+		zw := gzip.NewWriter(&compressed)
+		if _, err := zw.Write(data); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		data = compressed.Bytes()
+	}
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, path)
+}
+
+// Looks up the UUID of a player by name. A UUID skips the Mojang lookup, the name is empty then and
+// has to be taken from Hypixel instead.
+// Returns:
+// string: the UUID
+// string: the name with the right capitalisation
+func (s *Services) resolvePlayer(nameOrUUID string) (string, string, error) {
+	if uuidRegex.MatchString(nameOrUUID) {
+		return nameOrUUID, "", nil
+	}
+	apiProfile, err := s.getPlayerProfile(nameOrUUID)
+	if err != nil {
+		return "", "", err
+	}
+	return apiProfile.Id, apiProfile.Name, nil
+}
+
+// Turns a getPlayerProfile error into the key of a message for the client
+func playerProfileErrorKey(err error) string {
+	switch {
+	case errors.Is(err, InvalidPlayerName):
+		return "error.invalid_player_name"
+	case errors.Is(err, InvalidPlayer):
+		return "error.invalid_player"
+	default:
+		return "error.player_lookup"
+	}
+}
+
+// Width of the label column and each player column in /compare, in characters
+const comparisonLabelWidth = 10
+const comparisonColumnWidth = 18
+
+// Formats one row of a two column comparison, the higher value is green and the lower value red.
+// Columns are padded with spaces which assumes a monospace chat font.
+func formatComparisonRow(label string, left string, right string, leftValue float64, rightValue float64) string {
+	leftColor, rightColor := "§f", "§f"
+	if leftValue > rightValue {
+		leftColor, rightColor = "§a", "§c"
+	} else if leftValue < rightValue {
+		leftColor, rightColor = "§c", "§a"
+	}
+	return "§7" + padRight(label, comparisonLabelWidth) + leftColor + padRight(left, comparisonColumnWidth) + rightColor + right
+}
+
+// Pads s with spaces to width visible characters, color codes don't count towards the width
+func padRight(s string, width int) string {
+	visible := utf8.RuneCountInString(colorCodeRegex.ReplaceAllString(s, ""))
+	if visible >= width {
+		return s + " "
+	}
+	return s + strings.Repeat(" ", width-visible)
+}
+
 func capitaliseFirst(s string) string {
 	if s == "" {
 		return s
@@ -139,3 +294,422 @@ func getUpgradeInformation(upgrade string, bedwarsType BedwarsType) (string, str
 	}
 	return "", "", 0
 }
+
+type NBTTagType byte
+
+const (
+	NBTTagEnd NBTTagType = iota
+	NBTTagByte
+	NBTTagShort
+	NBTTagInt
+	NBTTagLong
+	NBTTagFloat
+	NBTTagDouble
+	NBTTagByteArray
+	NBTTagString
+	NBTTagList
+	NBTTagCompound
+	NBTTagIntArray
+)
+
+// Values are stored as int8, int16, int32, int64, float32, float64, []byte, string, NBTList, NBTCompound or []int32
+type NBTCompound map[string]any
+
+type NBTList []any
+
+// Reads a named root tag, which for item stacks is always a compound
+// Returns:
+// string: root name
+// NBTCompound: root compound, nil if the tag is TAG_End (no NBT)
+func readNBT(r io.Reader) (string, NBTCompound, error) {
+	var tagType [1]byte
+	if _, err := io.ReadFull(r, tagType[:]); err != nil {
+		return "", nil, err
+	}
+	if NBTTagType(tagType[0]) == NBTTagEnd {
+		return "", nil, nil
+	}
+	if NBTTagType(tagType[0]) != NBTTagCompound {
+		return "", nil, fmt.Errorf("NBT root tag is not a compound (type %d)", tagType[0])
+	}
+
+	name, err := readNBTString(r)
+	if err != nil {
+		return "", nil, err
+	}
+
+	payload, err := readNBTPayload(r, NBTTagCompound, 0)
+	if err != nil {
+		return "", nil, err
+	}
+	return name, payload.(NBTCompound), nil
+}
+
+// Maximum nesting of lists and compounds, protects against malicious payloads
+const nbtMaxDepth = 512
+
+func readNBTPayload(r io.Reader, tagType NBTTagType, depth int) (any, error) {
+	if depth > nbtMaxDepth {
+		return nil, errors.New("NBT nested too deep")
+	}
+
+	switch tagType {
+	case NBTTagByte:
+		var v int8
+		err := binary.Read(r, binary.BigEndian, &v)
+		return v, err
+	case NBTTagShort:
+		var v int16
+		err := binary.Read(r, binary.BigEndian, &v)
+		return v, err
+	case NBTTagInt:
+		var v int32
+		err := binary.Read(r, binary.BigEndian, &v)
+		return v, err
+	case NBTTagLong:
+		var v int64
+		err := binary.Read(r, binary.BigEndian, &v)
+		return v, err
+	case NBTTagFloat:
+		var v float32
+		err := binary.Read(r, binary.BigEndian, &v)
+		return v, err
+	case NBTTagDouble:
+		var v float64
+		err := binary.Read(r, binary.BigEndian, &v)
+		return v, err
+	case NBTTagByteArray:
+		length, err := readNBTLength(r)
+		if err != nil {
+			return nil, err
+		}
+		// Grown while reading, the length alone can't make it allocate more than the payload holds
+		var v bytes.Buffer
+		v.Grow(min(length, 1024))
+		if _, err := io.CopyN(&v, r, int64(length)); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		return v.Bytes(), nil
+	case NBTTagString:
+		return readNBTString(r)
+	case NBTTagList:
+		var elementType [1]byte
+		if _, err := io.ReadFull(r, elementType[:]); err != nil {
+			return nil, err
+		}
+		length, err := readNBTLength(r)
+		if err != nil {
+			return nil, err
+		}
+		list := make(NBTList, 0, min(length, 1024))
+		for range length {
+			element, err := readNBTPayload(r, NBTTagType(elementType[0]), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, element)
+		}
+		return list, nil
+	case NBTTagCompound:
+		compound := NBTCompound{}
+		for {
+			var childType [1]byte
+			if _, err := io.ReadFull(r, childType[:]); err != nil {
+				return nil, err
+			}
+			if NBTTagType(childType[0]) == NBTTagEnd {
+				return compound, nil
+			}
+			name, err := readNBTString(r)
+			if err != nil {
+				return nil, err
+			}
+			child, err := readNBTPayload(r, NBTTagType(childType[0]), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			compound[name] = child
+		}
+	case NBTTagIntArray:
+		length, err := readNBTLength(r)
+		if err != nil {
+			return nil, err
+		}
+		v := make([]int32, 0, min(length, 1024))
+		for range length {
+			var element int32
+			if err := binary.Read(r, binary.BigEndian, &element); err != nil {
+				return nil, err
+			}
+			v = append(v, element)
+		}
+		return v, nil
+	default:
+		return nil, fmt.Errorf("Unknown NBT tag type %d", tagType)
+	}
+}
+
+// Reads the signed int length used by arrays and lists
+func readNBTLength(r io.Reader) (int, error) {
+	var length int32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return 0, err
+	}
+	if length < 0 {
+		return 0, errors.New("Negative NBT length")
+	}
+	return int(length), nil
+}
+
+// NBT strings are prefixed with an unsigned short instead of a VarInt
+func readNBTString(r io.Reader) (string, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return "", err
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// Reads the custom name and lore from an item stack's tag.display compound
+// Returns:
+// string: display name, empty if the item has no custom name
+// []string: lore lines
+func getItemDisplay(tag NBTCompound) (string, []string) {
+	display, ok := tag["display"].(NBTCompound)
+	if !ok {
+		return "", nil
+	}
+
+	name, _ := display["Name"].(string)
+
+	var lore []string
+	loreList, _ := display["Lore"].(NBTList)
+	for _, line := range loreList {
+		if s, ok := line.(string); ok {
+			lore = append(lore, s)
+		}
+	}
+	return name, lore
+}
+
+type ItemStack struct {
+	ID     int16
+	Count  int8
+	Damage int16
+	Tag    NBTCompound
+}
+
+// Returns nil for an empty slot
+func readSlot(r io.Reader) (*ItemStack, error) {
+	var id int16
+	if err := binary.Read(r, binary.BigEndian, &id); err != nil {
+		return nil, err
+	}
+	if id == -1 {
+		return nil, nil
+	}
+
+	item := ItemStack{ID: id}
+	if err := binary.Read(r, binary.BigEndian, &item.Count); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.BigEndian, &item.Damage); err != nil {
+		return nil, err
+	}
+
+	_, tag, err := readNBT(r)
+	if err != nil {
+		return nil, err
+	}
+	item.Tag = tag
+	return &item, nil
+}
+
+type MetadataType byte
+
+const (
+	MetadataByte MetadataType = iota
+	MetadataShort
+	MetadataInt
+	MetadataFloat
+	MetadataString
+	MetadataSlot
+	MetadataPosition
+	MetadataRotation
+)
+
+// Ends the metadata instead of an entry
+const metadataEnd = 0x7F
+
+type Rotation struct {
+	Pitch, Yaw, Roll float32
+}
+
+// Entity metadata by index. Values are stored as int8, int16, int32, float32, string, *ItemStack
+// (nil for an empty slot), BlockPosition or Rotation.
+type EntityMetadata map[byte]any
+
+// Reads 1.8 entity metadata as sent in Entity Metadata, Spawn Mob and Spawn Player. Every entry
+// starts with a byte holding the type in the upper 3 bits and the index in the lower 5, the list
+// is ended by 0x7F.
+func readEntityMetadata(r io.Reader) (EntityMetadata, error) {
+	metadata := make(EntityMetadata)
+	for {
+		var key [1]byte
+		if _, err := io.ReadFull(r, key[:]); err != nil {
+			return nil, err
+		}
+		if key[0] == metadataEnd {
+			return metadata, nil
+		}
+
+		index := key[0] & 0x1F
+		var value any
+		var err error
+		switch MetadataType(key[0] >> 5) {
+		case MetadataByte:
+			var v int8
+			err = binary.Read(r, binary.BigEndian, &v)
+			value = v
+		case MetadataShort:
+			var v int16
+			err = binary.Read(r, binary.BigEndian, &v)
+			value = v
+		case MetadataInt:
+			var v int32
+			err = binary.Read(r, binary.BigEndian, &v)
+			value = v
+		case MetadataFloat:
+			var v float32
+			err = binary.Read(r, binary.BigEndian, &v)
+			value = v
+		case MetadataString:
+			value, err = readMetadataString(r)
+		case MetadataSlot:
+			value, err = readSlot(r)
+		case MetadataPosition:
+			var v [3]int32
+			err = binary.Read(r, binary.BigEndian, &v)
+			value = BlockPosition{int(v[0]), int(v[1]), int(v[2])}
+		case MetadataRotation:
+			var v Rotation
+			err = binary.Read(r, binary.BigEndian, &v)
+			value = v
+		}
+		if err != nil {
+			return nil, err
+		}
+		metadata[index] = value
+	}
+}
+
+func readMetadataString(r io.Reader) (string, error) {
+	length, _, err := readVarInt(r)
+	if err != nil {
+		return "", err
+	}
+	if length < 0 || length > maxStringLength {
+		return "", fmt.Errorf("Invalid metadata string length %d", length)
+	}
+	value := make([]byte, length)
+	if _, err := io.ReadFull(r, value); err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+// The MC|Brand payload is a single prefixed string, like "Hypixel BungeeCord (2024.1.1) <- vanilla"
+func parseBrand(payload []byte) (string, error) {
+	r := bytes.NewReader(payload)
+	length, _, err := readVarInt(r)
+	if err != nil {
+		return "", err
+	}
+	if length != r.Len() {
+		return "", fmt.Errorf("Brand length %d doesn't match the %d bytes after it", length, r.Len())
+	}
+	return string(payload[len(payload)-length:]), nil
+}
+
+var enchantmentNames = map[int16]string{
+	0:  "Protection",
+	1:  "Fire Protection",
+	2:  "Feather Falling",
+	3:  "Blast Protection",
+	4:  "Projectile Protection",
+	5:  "Respiration",
+	6:  "Aqua Affinity",
+	7:  "Thorns",
+	8:  "Depth Strider",
+	16: "Sharpness",
+	17: "Smite",
+	18: "Bane of Arthropods",
+	19: "Knockback",
+	20: "Fire Aspect",
+	21: "Looting",
+	32: "Efficiency",
+	33: "Silk Touch",
+	34: "Unbreaking",
+	35: "Fortune",
+	48: "Power",
+	49: "Punch",
+	50: "Flame",
+	51: "Infinity",
+	61: "Luck of the Sea",
+	62: "Lure",
+}
+
+// Reads the tag.ench list into readable "Name level" strings
+func getItemEnchantments(tag NBTCompound) []string {
+	enchList, _ := tag["ench"].(NBTList)
+	enchantments := make([]string, 0, len(enchList))
+	for _, e := range enchList {
+		ench, ok := e.(NBTCompound)
+		if !ok {
+			continue
+		}
+		id, _ := ench["id"].(int16)
+		lvl, _ := ench["lvl"].(int16)
+
+		name, ok := enchantmentNames[id]
+		if !ok {
+			name = fmt.Sprintf("Unknown (%d)", id)
+		}
+		enchantments = append(enchantments, fmt.Sprintf("%s %d", name, lvl))
+	}
+	return enchantments
+}
+
+// Positions are packed into a long as x (26 bits), y (12 bits), z (26 bits), all signed two's complement.
+// Out of range coordinates wrap around like they do in the vanilla encoding.
+func encodePosition(x int, y int, z int) int64 {
+	return (int64(x)&0x3FFFFFF)<<38 | (int64(y)&0xFFF)<<26 | int64(z)&0x3FFFFFF
+}
+
+func decodePosition(packed int64) (int, int, int) {
+	// Shifting the field to the top and back with an arithmetic shift sign extends it
+	x := int(packed >> 38)
+	y := int(packed << 26 >> 52)
+	z := int(packed << 38 >> 38)
+	return x, y, z
+}
+
+func readPosition(r io.Reader) (int, int, int, error) {
+	var packed int64
+	if err := binary.Read(r, binary.BigEndian, &packed); err != nil {
+		return 0, 0, 0, err
+	}
+	x, y, z := decodePosition(packed)
+	return x, y, z, nil
+}
+
+func writePosition(w io.Writer, x int, y int, z int) error {
+	return binary.Write(w, binary.BigEndian, encodePosition(x, y, z))
+}
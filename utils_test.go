@@ -0,0 +1,410 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// Builds NBT the way the notchian server writes it
+type nbtBuilder struct {
+	bytes.Buffer
+}
+
+func (b *nbtBuilder) tag(tagType NBTTagType, name string) *nbtBuilder {
+	b.WriteByte(byte(tagType))
+	b.str(name)
+	return b
+}
+
+func (b *nbtBuilder) str(s string) *nbtBuilder {
+	binary.Write(b, binary.BigEndian, uint16(len(s)))
+	b.WriteString(s)
+	return b
+}
+
+func (b *nbtBuilder) int16(v int16) *nbtBuilder {
+	binary.Write(b, binary.BigEndian, v)
+	return b
+}
+
+func (b *nbtBuilder) int32(v int32) *nbtBuilder {
+	binary.Write(b, binary.BigEndian, v)
+	return b
+}
+
+func (b *nbtBuilder) end() *nbtBuilder {
+	b.WriteByte(byte(NBTTagEnd))
+	return b
+}
+
+// The tag of a Bedwars item shop entry: enchanted, with flags hidden and a name and lore
+func shopItemNBT() []byte {
+	b := &nbtBuilder{}
+	b.tag(NBTTagCompound, "")
+	b.tag(NBTTagList, "ench")
+	b.WriteByte(byte(NBTTagCompound))
+	b.int32(1)
+	b.tag(NBTTagShort, "id").int16(16)
+	b.tag(NBTTagShort, "lvl").int16(1)
+	b.end()
+	b.tag(NBTTagInt, "HideFlags").int32(254)
+	b.tag(NBTTagCompound, "display")
+	b.tag(NBTTagString, "Name").str("§aStone Sword")
+	b.tag(NBTTagList, "Lore")
+	b.WriteByte(byte(NBTTagString))
+	b.int32(3)
+	b.str("§7Cost: §f10 Iron")
+	b.str("")
+	b.str("§eClick to purchase!")
+	b.end()
+	b.tag(NBTTagByte, "Unbreakable")
+	b.WriteByte(1)
+	b.end()
+	return b.Bytes()
+}
+
+func TestReadNBTShopItem(t *testing.T) {
+	name, tag, err := readNBT(bytes.NewReader(shopItemNBT()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "" {
+		t.Errorf("root name = %q, want empty", name)
+	}
+
+	want := NBTCompound{
+		"ench":      NBTList{NBTCompound{"id": int16(16), "lvl": int16(1)}},
+		"HideFlags": int32(254),
+		"display": NBTCompound{
+			"Name": "§aStone Sword",
+			"Lore": NBTList{"§7Cost: §f10 Iron", "", "§eClick to purchase!"},
+		},
+		"Unbreakable": int8(1),
+	}
+	if !reflect.DeepEqual(tag, want) {
+		t.Errorf("tag = %#v, want %#v", tag, want)
+	}
+
+	displayName, lore := getItemDisplay(tag)
+	if displayName != "§aStone Sword" {
+		t.Errorf("display name = %q", displayName)
+	}
+	if !reflect.DeepEqual(lore, []string{"§7Cost: §f10 Iron", "", "§eClick to purchase!"}) {
+		t.Errorf("lore = %q", lore)
+	}
+}
+
+func TestReadNBTArrays(t *testing.T) {
+	b := &nbtBuilder{}
+	b.tag(NBTTagCompound, "root")
+	b.tag(NBTTagByteArray, "bytes").int32(3)
+	b.Write([]byte{1, 2, 3})
+	b.tag(NBTTagIntArray, "ints").int32(2).int32(-1).int32(7)
+	b.tag(NBTTagList, "empty")
+	b.WriteByte(byte(NBTTagEnd))
+	b.int32(0)
+	b.end()
+
+	name, tag, err := readNBT(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := NBTCompound{"bytes": []byte{1, 2, 3}, "ints": []int32{-1, 7}, "empty": NBTList{}}
+	if name != "root" || !reflect.DeepEqual(tag, want) {
+		t.Errorf("got %q %#v, want root %#v", name, tag, want)
+	}
+}
+
+func TestReadNBTNoTag(t *testing.T) {
+	_, tag, err := readNBT(bytes.NewReader([]byte{byte(NBTTagEnd)}))
+	if err != nil || tag != nil {
+		t.Errorf("got %v, %v, want no tag", tag, err)
+	}
+}
+
+func TestReadNBTTruncated(t *testing.T) {
+	sample := shopItemNBT()
+	for i := range len(sample) - 1 {
+		if _, _, err := readNBT(bytes.NewReader(sample[:i])); err == nil {
+			t.Errorf("no error for the sample truncated to %d of %d bytes", i, len(sample))
+		}
+	}
+}
+
+func TestReadNBTInvalidLengths(t *testing.T) {
+	arrayWithLength := func(tagType NBTTagType, length int32) []byte {
+		b := &nbtBuilder{}
+		b.tag(NBTTagCompound, "")
+		b.tag(tagType, "a").int32(length)
+		// A few bytes of payload, far less than the length claims
+		b.Write([]byte{0, 0, 0, 0, 0, 0, 0, 0})
+		return b.Bytes()
+	}
+	listWithLength := func(length int32) []byte {
+		b := &nbtBuilder{}
+		b.tag(NBTTagCompound, "")
+		b.tag(NBTTagList, "a")
+		b.WriteByte(byte(NBTTagInt))
+		b.int32(length)
+		b.Write([]byte{0, 0, 0, 0})
+		return b.Bytes()
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"huge byte array", arrayWithLength(NBTTagByteArray, 0x7FFFFFFF)},
+		{"huge int array", arrayWithLength(NBTTagIntArray, 0x7FFFFFFF)},
+		{"huge list", listWithLength(0x7FFFFFFF)},
+		{"negative byte array", arrayWithLength(NBTTagByteArray, -1)},
+		{"negative int array", arrayWithLength(NBTTagIntArray, -1)},
+		{"negative list", listWithLength(-1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			if _, _, err := readNBT(bytes.NewReader(tt.data)); err == nil {
+				t.Error("no error")
+			}
+			runtime.ReadMemStats(&after)
+			// Reading the few elements there are, not allocating for the claimed length
+			if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+				t.Errorf("allocated %d bytes", allocated)
+			}
+		})
+	}
+}
+
+func TestReadNBTTooDeep(t *testing.T) {
+	b := &nbtBuilder{}
+	b.tag(NBTTagCompound, "")
+	for range nbtMaxDepth + 1 {
+		b.tag(NBTTagCompound, "a")
+	}
+	if _, _, err := readNBT(bytes.NewReader(b.Bytes())); err == nil {
+		t.Error("no error for NBT nested too deep")
+	}
+}
+
+func TestReadSlot(t *testing.T) {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, int16(272))
+	b.WriteByte(1)
+	binary.Write(&b, binary.BigEndian, int16(0))
+	b.Write(shopItemNBT())
+	binary.Write(&b, binary.BigEndian, int16(-1))
+
+	r := bytes.NewReader(b.Bytes())
+	item, err := readSlot(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ID != 272 || item.Count != 1 || item.Damage != 0 {
+		t.Errorf("item = %+v", item)
+	}
+	if name, _ := getItemDisplay(item.Tag); name != "§aStone Sword" {
+		t.Errorf("display name = %q", name)
+	}
+
+	empty, err := readSlot(r)
+	if err != nil || empty != nil {
+		t.Errorf("got %v, %v, want an empty slot", empty, err)
+	}
+}
+
+func TestPositionRoundTrip(t *testing.T) {
+	const maxXZ = 1<<25 - 1
+	const minXZ = -1 << 25
+	tests := []struct {
+		x, y, z int
+	}{
+		{0, 0, 0},
+		{1, 64, -1},
+		{-1, -1, -1},
+		{maxXZ, 255, maxXZ},
+		{minXZ, 0, minXZ},
+		{minXZ, 2047, maxXZ},
+		{maxXZ, -2048, minXZ},
+		// The world border
+		{-30000000, 100, 29999999},
+	}
+	for _, tt := range tests {
+		x, y, z := decodePosition(encodePosition(tt.x, tt.y, tt.z))
+		if x != tt.x || y != tt.y || z != tt.z {
+			t.Errorf("(%d, %d, %d) came back as (%d, %d, %d)", tt.x, tt.y, tt.z, x, y, z)
+		}
+
+		var b bytes.Buffer
+		if err := writePosition(&b, tt.x, tt.y, tt.z); err != nil {
+			t.Fatal(err)
+		}
+		x, y, z, err := readPosition(&b)
+		if err != nil || x != tt.x || y != tt.y || z != tt.z {
+			t.Errorf("(%d, %d, %d) was read as (%d, %d, %d), %v", tt.x, tt.y, tt.z, x, y, z, err)
+		}
+	}
+}
+
+func TestPositionFields(t *testing.T) {
+	// Player Block Placement's special position, every bit set
+	if packed := encodePosition(-1, -1, -1); packed != -1 {
+		t.Errorf("(-1, -1, -1) packed to %#x, want -1", packed)
+	}
+	if x, y, z := decodePosition(-1); x != -1 || y != -1 || z != -1 {
+		t.Errorf("-1 decoded to (%d, %d, %d)", x, y, z)
+	}
+
+	// Like the notchian BlockPos, y is a signed 12 bit field, so 4095 is the same as -1
+	if encodePosition(0, 4095, 0) != encodePosition(0, -1, 0) {
+		t.Error("y 4095 isn't packed like -1")
+	}
+	if _, y, _ := decodePosition(encodePosition(0, 4095, 0)); y != -1 {
+		t.Errorf("y 4095 decoded to %d, want -1", y)
+	}
+	// The fields don't bleed into each other
+	if packed := encodePosition(0, 4095, 0); packed != 0xFFF<<26 {
+		t.Errorf("y 4095 packed to %#x", packed)
+	}
+	if packed := encodePosition(1<<25, 0, 0); packed != -1<<63 {
+		t.Errorf("x 2^25 packed to %#x, want only the x sign bit", packed)
+	}
+	if x, _, _ := decodePosition(encodePosition(1<<25, 0, 0)); x != -1<<25 {
+		t.Errorf("x 2^25 wrapped to %d, want -2^25", x)
+	}
+	if packed := encodePosition(0, 0, -1<<25); packed != 1<<25 {
+		t.Errorf("z -2^25 packed to %#x", packed)
+	}
+}
+
+func metadataKey(metadataType MetadataType, index byte) byte {
+	return byte(metadataType)<<5 | index
+}
+
+// Entity metadata with an entry of every type
+func allTypesMetadata() []byte {
+	b := &nbtBuilder{}
+	b.WriteByte(metadataKey(MetadataByte, 0))
+	b.WriteByte(0x02)
+	b.WriteByte(metadataKey(MetadataShort, 1))
+	b.int16(300)
+	b.WriteByte(metadataKey(MetadataInt, 7))
+	b.int32(-5)
+	b.WriteByte(metadataKey(MetadataFloat, 6))
+	binary.Write(b, binary.BigEndian, float32(20))
+	b.WriteByte(metadataKey(MetadataString, 2))
+	writeVarInt(b, len("§cRed §fSteve"))
+	b.WriteString("§cRed §fSteve")
+	b.WriteByte(metadataKey(MetadataSlot, 10))
+	b.int16(272)
+	b.WriteByte(1)
+	b.int16(0)
+	b.Write(shopItemNBT())
+	b.WriteByte(metadataKey(MetadataSlot, 11))
+	b.int16(-1)
+	b.WriteByte(metadataKey(MetadataPosition, 12))
+	b.int32(-100).int32(64).int32(2000)
+	b.WriteByte(metadataKey(MetadataRotation, 31))
+	binary.Write(b, binary.BigEndian, Rotation{1.5, -90, 0})
+	b.WriteByte(metadataEnd)
+	return b.Bytes()
+}
+
+func TestReadEntityMetadata(t *testing.T) {
+	metadata, err := readEntityMetadata(bytes.NewReader(allTypesMetadata()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slot, ok := metadata[10].(*ItemStack)
+	if !ok || slot.ID != 272 || slot.Count != 1 {
+		t.Errorf("slot = %#v", metadata[10])
+	} else if name, _ := getItemDisplay(slot.Tag); name != "§aStone Sword" {
+		t.Errorf("slot display name = %q", name)
+	}
+	delete(metadata, 10)
+
+	want := EntityMetadata{
+		0:  int8(2),
+		1:  int16(300),
+		7:  int32(-5),
+		6:  float32(20),
+		2:  "§cRed §fSteve",
+		11: (*ItemStack)(nil),
+		12: BlockPosition{-100, 64, 2000},
+		31: Rotation{1.5, -90, 0},
+	}
+	if !reflect.DeepEqual(metadata, want) {
+		t.Errorf("metadata = %#v, want %#v", metadata, want)
+	}
+}
+
+// Spawn Player metadata of a player as Hypixel sends it
+func TestReadEntityMetadataPlayer(t *testing.T) {
+	b := &nbtBuilder{}
+	b.WriteByte(metadataKey(MetadataByte, 0))
+	b.WriteByte(0)
+	b.WriteByte(metadataKey(MetadataShort, 1))
+	b.int16(300)
+	b.WriteByte(metadataKey(MetadataString, 2))
+	b.WriteByte(0)
+	b.WriteByte(metadataKey(MetadataFloat, 6))
+	binary.Write(b, binary.BigEndian, float32(20))
+	b.WriteByte(metadataKey(MetadataInt, 7))
+	b.int32(0)
+	b.WriteByte(metadataKey(MetadataByte, 10))
+	b.WriteByte(0x7F)
+	b.WriteByte(metadataKey(MetadataFloat, 17))
+	binary.Write(b, binary.BigEndian, float32(0))
+	b.WriteByte(metadataKey(MetadataInt, 18))
+	b.int32(42)
+	b.WriteByte(metadataEnd)
+	// The rest of the packet isn't read
+	b.WriteByte(0xAA)
+
+	r := bytes.NewReader(b.Bytes())
+	metadata, err := readEntityMetadata(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metadata) != 8 || metadata[6] != float32(20) || metadata[10] != int8(0x7F) || metadata[18] != int32(42) || metadata[2] != "" {
+		t.Errorf("metadata = %#v", metadata)
+	}
+	if r.Len() != 1 {
+		t.Errorf("%d bytes left after the metadata, want the 1 after it", r.Len())
+	}
+}
+
+func TestReadEntityMetadataEmpty(t *testing.T) {
+	metadata, err := readEntityMetadata(bytes.NewReader([]byte{metadataEnd}))
+	if err != nil || len(metadata) != 0 {
+		t.Errorf("got %#v, %v, want empty metadata", metadata, err)
+	}
+}
+
+func TestReadEntityMetadataTruncated(t *testing.T) {
+	sample := allTypesMetadata()
+	for i := range len(sample) - 1 {
+		if _, err := readEntityMetadata(bytes.NewReader(sample[:i])); err == nil {
+			t.Errorf("no error for the metadata truncated to %d of %d bytes", i, len(sample))
+		}
+	}
+
+	// A string longer than it can be
+	b := &nbtBuilder{}
+	b.WriteByte(metadataKey(MetadataString, 2))
+	writeVarInt(b, maxStringLength+1)
+	b.WriteString("a")
+	b.WriteByte(metadataEnd)
+	if _, err := readEntityMetadata(bytes.NewReader(b.Bytes())); err == nil {
+		t.Error("no error for a string longer than the maximum")
+	}
+}
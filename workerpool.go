@@ -0,0 +1,33 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+// Runs jobs on a fixed amount of goroutines, used for commands that call the Hypixel or Mojang API
+// so they never block packet forwarding and can't exceed the API rate limits with unbounded concurrency
+type WorkerPool struct {
+	jobs chan func()
+}
+
+func newWorkerPool(workers int, queueSize int) *WorkerPool {
+	pool := &WorkerPool{make(chan func(), queueSize)}
+	for range workers {
+		go func() {
+			for job := range pool.jobs {
+				job()
+			}
+		}()
+	}
+	return pool
+}
+
+// Returns false without running job if the queue is full
+func (wp *WorkerPool) submit(job func()) bool {
+	select {
+	case wp.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
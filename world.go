@@ -0,0 +1,241 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const blockBed = 26
+
+type BlockPosition struct {
+	X, Y, Z int
+}
+
+// Block states are the block ID shifted left by 4 with the metadata in the lower 4 bits,
+// beds have bit 0x8 of the metadata set for the head half
+func isBedHead(blockState int) bool {
+	return blockState>>4 == blockBed && blockState&0x8 != 0
+}
+
+// Bytes per 16x16x16 chunk section
+const sectionBlocksSize = 4096 * 2
+const sectionLightSize = 4096 / 2
+const biomesSize = 256
+
+// Finds the bed heads in the block arrays of chunk data, which start with a little endian block
+// state for every block of every section in primaryBitMask
+func findBedHeads(chunkX int, chunkZ int, primaryBitMask uint16, data []byte) ([]BlockPosition, error) {
+	var beds []BlockPosition
+	offset := 0
+	for sectionY := range 16 {
+		if primaryBitMask&(1<<sectionY) == 0 {
+			continue
+		}
+		if offset+sectionBlocksSize > len(data) {
+			return nil, errors.New("Chunk data too short")
+		}
+		section := data[offset : offset+sectionBlocksSize]
+		for i := 0; i < len(section); i += 2 {
+			blockState := int(section[i]) | int(section[i+1])<<8
+			if !isBedHead(blockState) {
+				continue
+			}
+			index := i / 2
+			beds = append(beds, BlockPosition{
+				X: chunkX*16 + index&0xF,
+				Y: sectionY*16 + index>>8,
+				Z: chunkZ*16 + (index>>4)&0xF,
+			})
+		}
+		offset += sectionBlocksSize
+	}
+	return beds, nil
+}
+
+// Size of one chunk's data in Chunk Data and Map Chunk Bulk
+func chunkDataSize(primaryBitMask uint16, skyLight bool, groundUpContinuous bool) int {
+	sections := 0
+	for sectionY := range 16 {
+		if primaryBitMask&(1<<sectionY) != 0 {
+			sections++
+		}
+	}
+	size := sections * (sectionBlocksSize + sectionLightSize)
+	if skyLight {
+		size += sections * sectionLightSize
+	}
+	if groundUpContinuous {
+		size += biomesSize
+	}
+	return size
+}
+
+// Forgets the beds in a chunk, for unloads and chunks that are sent again in full
+func (p *Proxy) forgetBedsInChunk(chunkX int, chunkZ int) {
+	for bed := range p.beds {
+		if bed.X>>4 == chunkX && bed.Z>>4 == chunkZ {
+			delete(p.beds, bed)
+		}
+	}
+}
+
+// Chunk Data
+func (p *Proxy) handleChunkData(packetReader *bytes.Reader) error {
+	var header struct {
+		ChunkX             int32
+		ChunkZ             int32
+		GroundUpContinuous bool
+		PrimaryBitMask     uint16
+	}
+	if err := binary.Read(packetReader, binary.BigEndian, &header); err != nil {
+		return err
+	}
+	data, err := readPrefixedBytes(packetReader)
+	if err != nil {
+		return err
+	}
+
+	chunkX, chunkZ := int(header.ChunkX), int(header.ChunkZ)
+	if header.GroundUpContinuous {
+		// Either a full chunk replacing the old one or, with an empty bitmask, an unload
+		p.forgetBedsInChunk(chunkX, chunkZ)
+	}
+
+	beds, err := findBedHeads(chunkX, chunkZ, header.PrimaryBitMask, data)
+	if err != nil {
+		return err
+	}
+	for _, bed := range beds {
+		p.beds[bed] = struct{}{}
+	}
+	return nil
+}
+
+// Map Chunk Bulk
+func (p *Proxy) handleMapChunkBulk(packetReader *bytes.Reader) error {
+	var skyLight bool
+	if err := binary.Read(packetReader, binary.BigEndian, &skyLight); err != nil {
+		return err
+	}
+	chunkCount, _, err := readVarInt(packetReader)
+	if err != nil {
+		return err
+	}
+	// Every chunk has 10 bytes of metadata, more chunks than that can't be in the packet
+	if chunkCount < 0 || chunkCount > packetReader.Len()/10 {
+		return fmt.Errorf("Invalid chunk count %d", chunkCount)
+	}
+
+	type chunkMeta struct {
+		ChunkX         int32
+		ChunkZ         int32
+		PrimaryBitMask uint16
+	}
+	metas := make([]chunkMeta, chunkCount)
+	if err := binary.Read(packetReader, binary.BigEndian, metas); err != nil {
+		return err
+	}
+
+	for _, meta := range metas {
+		// Map Chunk Bulk chunks are always ground-up continuous
+		data := make([]byte, chunkDataSize(meta.PrimaryBitMask, skyLight, true))
+		if _, err := io.ReadFull(packetReader, data); err != nil {
+			return err
+		}
+
+		chunkX, chunkZ := int(meta.ChunkX), int(meta.ChunkZ)
+		p.forgetBedsInChunk(chunkX, chunkZ)
+		beds, err := findBedHeads(chunkX, chunkZ, meta.PrimaryBitMask, data)
+		if err != nil {
+			return err
+		}
+		for _, bed := range beds {
+			p.beds[bed] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// Updates the tracked beds for a single block change
+// Returns:
+// bool: true if a tracked bed has been destroyed
+func (p *Proxy) updateBlock(position BlockPosition, blockState int) bool {
+	if isBedHead(blockState) {
+		p.beds[position] = struct{}{}
+		return false
+	}
+	if _, ok := p.beds[position]; ok {
+		delete(p.beds, position)
+		return true
+	}
+	return false
+}
+
+// Block Change
+// Returns:
+// []BlockPosition: destroyed beds
+func (p *Proxy) handleBlockChange(packetReader *bytes.Reader) ([]BlockPosition, error) {
+	x, y, z, err := readPosition(packetReader)
+	if err != nil {
+		return nil, err
+	}
+	blockState, _, err := readVarInt(packetReader)
+	if err != nil {
+		return nil, err
+	}
+
+	position := BlockPosition{x, y, z}
+	if p.updateBlock(position, blockState) {
+		return []BlockPosition{position}, nil
+	}
+	return nil, nil
+}
+
+// Multi Block Change
+// Returns:
+// []BlockPosition: destroyed beds
+func (p *Proxy) handleMultiBlockChange(packetReader *bytes.Reader) ([]BlockPosition, error) {
+	var chunk struct {
+		ChunkX int32
+		ChunkZ int32
+	}
+	if err := binary.Read(packetReader, binary.BigEndian, &chunk); err != nil {
+		return nil, err
+	}
+	recordCount, _, err := readVarInt(packetReader)
+	if err != nil {
+		return nil, err
+	}
+
+	var destroyed []BlockPosition
+	for range recordCount {
+		var record struct {
+			HorizontalPosition byte // X in the high 4 bits, Z in the low 4 bits
+			Y                  byte
+		}
+		if err := binary.Read(packetReader, binary.BigEndian, &record); err != nil {
+			return nil, err
+		}
+		blockState, _, err := readVarInt(packetReader)
+		if err != nil {
+			return nil, err
+		}
+
+		position := BlockPosition{
+			X: int(chunk.ChunkX)*16 + int(record.HorizontalPosition>>4),
+			Y: int(record.Y),
+			Z: int(chunk.ChunkZ)*16 + int(record.HorizontalPosition&0xF),
+		}
+		if p.updateBlock(position, blockState) {
+			destroyed = append(destroyed, position)
+		}
+	}
+	return destroyed, nil
+}
@@ -0,0 +1,36 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHandleMapChunkBulkChunkCount(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet []byte
+	}{
+		// VarInt 2^31-1, which would have allocated gigabytes of chunk metadata
+		{"huge", []byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0x07}},
+		// VarInt -1
+		{"negative", []byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0x0F}},
+		// Two chunks but the metadata of only one
+		{"truncated", append([]byte{0x01, 0x02}, make([]byte, 10)...)},
+	}
+	for _, tt := range tests {
+		p := &Proxy{beds: make(map[BlockPosition]struct{})}
+		if err := p.handleMapChunkBulk(bytes.NewReader(tt.packet)); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+
+	// A packet without chunks is fine
+	p := &Proxy{beds: make(map[BlockPosition]struct{})}
+	if err := p.handleMapChunkBulk(bytes.NewReader([]byte{0x01, 0x00})); err != nil {
+		t.Error(err)
+	}
+}